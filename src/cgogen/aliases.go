@@ -0,0 +1,171 @@
+package cgogen
+
+import (
+	"go/ast"
+	"path/filepath"
+)
+
+/*
+Type aliases are the type they stand for, so they get no C type of their own.
+Before a source is processed the aliases used by its functions and types are
+replaced with their targets, whether declared by the source, by another source
+of its package or by a source of another package of the run
+
+	type Amount = Coins
+	func Balance() Amount    // wrapped as func Balance() Coins
+
+Defined types are typedefs of the C type of the type they are defined as, and
+converted between C and Go as it is, through its converter when it has one
+
+	type Timeout time.Duration    // typedef GoInt64_ pkg__Timeout;
+*/
+
+// Type aliased by a source of the run, as declared in its package
+type aliasTarget struct {
+	packageName string
+	typeExpr    ast.Expr
+	// Whether the alias is declared by the source file being processed
+	local bool
+}
+
+// Returns whether the type spec declares an alias
+func isAliasSpec(typeSpec *ast.TypeSpec) bool {
+	return typeSpec.Assign.IsValid()
+}
+
+// Returns the target of the alias named by the type expression, if it is one
+func (g *Generator) findAlias(fast *ast.File, typeExpr ast.Expr) (aliasTarget, bool) {
+	switch t := typeExpr.(type) {
+	case *ast.Ident:
+		if typeSpec := findTypeSpec(fast, t.Name); typeSpec != nil {
+			if !isAliasSpec(typeSpec) {
+				return aliasTarget{}, false
+			}
+			return aliasTarget{fast.Name.Name, typeSpec.Type, true}, true
+		}
+		return g.sourceAlias(fast, fast.Name.Name+packageSeparator+t.Name)
+	case *ast.SelectorExpr:
+		if identExpr, isIdent := (t.X).(*ast.Ident); isIdent {
+			return g.sourceAlias(fast, identExpr.Name+packageSeparator+t.Sel.Name)
+		}
+	}
+	return aliasTarget{}, false
+}
+
+// Returns the target of the alias declared by a source of the run, recording its directory
+// in the package of the file
+func (g *Generator) sourceAlias(fast *ast.File, name string) (aliasTarget, bool) {
+	target, found := g.typeAliases[name]
+	if found {
+		g.constPackagesLock.Lock()
+		g.addResolvedDir(fast, filepath.Dir(g.typeSources[name]))
+		g.constPackagesLock.Unlock()
+	}
+	return target, found
+}
+
+// Returns the target of an alias as written in the package of the source,
+// qualifying the types of the package of the alias with its name.
+// Returns false if the target can't be written there.
+func qualifyAliasTarget(fast *ast.File, target aliasTarget, pos ast.Node) (ast.Expr, bool) {
+	identExpr, isIdent := (target.typeExpr).(*ast.Ident)
+	if !isIdent {
+		// Types used by the target are written as in the package of the alias
+		return target.typeExpr, target.packageName == fast.Name.Name
+	}
+	if target.packageName == fast.Name.Name || IsBasicGoType(identExpr.Name) || identExpr.Name == "error" {
+		// Diagnostics point to where the alias is used
+		return &ast.Ident{NamePos: pos.Pos(), Name: identExpr.Name}, true
+	}
+	return &ast.SelectorExpr{X: &ast.Ident{NamePos: pos.Pos(), Name: target.packageName}, Sel: identExpr}, true
+}
+
+// Replaces the aliases used by the type expression with their targets
+func (g *Generator) resolveAliasesIn(fast *ast.File, typeExpr ast.Expr, visiting map[ast.Expr]bool) ast.Expr {
+	if target, isAlias := g.findAlias(fast, typeExpr); isAlias {
+		if visiting[target.typeExpr] {
+			// Invalid cycle of aliases, reported by the Go compiler
+			return typeExpr
+		}
+		resolved, ok := qualifyAliasTarget(fast, target, typeExpr)
+		if !ok {
+			return typeExpr
+		}
+		if !target.local && resolved == target.typeExpr {
+			// Declared by another source, whose aliases are resolved when it is processed
+			return resolved
+		}
+		visiting[target.typeExpr] = true
+		defer delete(visiting, target.typeExpr)
+		return g.resolveAliasesIn(fast, resolved, visiting)
+	}
+	switch t := typeExpr.(type) {
+	case *ast.StarExpr:
+		t.X = g.resolveAliasesIn(fast, t.X, visiting)
+	case *ast.ArrayType:
+		t.Elt = g.resolveAliasesIn(fast, t.Elt, visiting)
+	case *ast.Ellipsis:
+		t.Elt = g.resolveAliasesIn(fast, t.Elt, visiting)
+	case *ast.MapType:
+		t.Key = g.resolveAliasesIn(fast, t.Key, visiting)
+		t.Value = g.resolveAliasesIn(fast, t.Value, visiting)
+	case *ast.ChanType:
+		t.Value = g.resolveAliasesIn(fast, t.Value, visiting)
+	case *ast.FuncType:
+		g.resolveAliasesInFields(fast, t.Params, visiting)
+		g.resolveAliasesInFields(fast, t.Results, visiting)
+	case *ast.StructType:
+		g.resolveAliasesInFields(fast, t.Fields, visiting)
+	}
+	return typeExpr
+}
+
+func (g *Generator) resolveAliasesInFields(fast *ast.File, fields *ast.FieldList, visiting map[ast.Expr]bool) {
+	if fields == nil {
+		return
+	}
+	for _, field := range fields.List {
+		typeExpr := field.Type
+		field.Type = g.resolveAliasesIn(fast, field.Type, visiting)
+		if len(field.Names) == 0 && field.Type != typeExpr {
+			// Embedded aliases name their field
+			field.Names = []*ast.Ident{{NamePos: typeExpr.Pos(), Name: embeddedFieldName(typeExpr)}}
+		}
+	}
+}
+
+// Replaces the aliases used by the functions and the types of the source file with their targets
+func (g *Generator) resolveAliases(fast *ast.File) {
+	for _, _decl := range fast.Decls {
+		switch decl := (_decl).(type) {
+		case *ast.FuncDecl:
+			g.resolveAliasesInFields(fast, decl.Recv, make(map[ast.Expr]bool))
+			g.resolveAliasesIn(fast, decl.Type, make(map[ast.Expr]bool))
+		case *ast.GenDecl:
+			for _, s := range decl.Specs {
+				if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec && !isAliasSpec(typeSpec) {
+					typeSpec.Type = g.resolveAliasesIn(fast, typeSpec.Type, make(map[ast.Expr]bool))
+				}
+			}
+		}
+	}
+}
+
+// Returns the C type of the type the alias stands for, empty if it isn't named
+func (g *Generator) aliasSymbol(fast *ast.File, typeSpec *ast.TypeSpec) string {
+	switch t := g.resolveAliasesIn(fast, typeSpec.Type, make(map[ast.Expr]bool)).(type) {
+	case *ast.Ident:
+		if ctype, isBasic := GetCTypeFromGoType(t.Name); isBasic {
+			return ctype
+		}
+		return fast.Name.Name + packageSeparator + t.Name
+	case *ast.SelectorExpr:
+		if converter := g.findConverter(fast, t); converter != nil {
+			return converter.CType
+		}
+		if identExpr, isIdent := (t.X).(*ast.Ident); isIdent {
+			return identExpr.Name + packageSeparator + t.Sel.Name
+		}
+	}
+	return ""
+}
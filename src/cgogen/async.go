@@ -0,0 +1,193 @@
+package cgogen
+
+import (
+	"go/ast"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+/*
+Functions listed in a CGOGEN ASYNC setting also get an asynchronous wrapper
+
+	<PREFIX>_<package>_<Func>_Async(<inputs>, <PREFIX>_<package>_<Func>_Callback callback,
+		void* userData, Context__Handle* request)
+
+It returns at once and calls the synchronous wrapper on a goroutine. When the call
+completes, callback is invoked with the error code, pointers to the outputs,
+valid only during the callback, and userData. Cancelling the request handle
+through the cancellation tokens API invokes the callback with the error code of
+the cancellation and NULL outputs once the synchronous wrapper returns, so the
+inputs are no longer read. Context parameters of the function receive the
+request, derived from the token passed by the caller, to return early.
+
+Outputs allocated by the synchronous wrapper are freed once the callback
+returns, or before the callback of a cancellation. Outputs that are slices of flat elements are copied into buffers given
+by the caller, as to the synchronous wrapper, so they are parameters of the
+asynchronous wrapper too
+
+	<PREFIX>_<package>_<Func>_Async(<inputs>, GoSlice_* <output>, ...)
+
+Inputs and output buffers must stay valid until the callback is invoked, and
+the request handle must be freed after it. The cancellation tokens API must be
+generated in the same package.
+*/
+
+// Parameter of a generated wrapper
+type wrapperParam struct {
+	name     string
+	typeName string
+	isOutput bool
+	// Whether the wrapper fails with SKY_ERROR_NULL_ARGUMENT when it is NULL
+	checksNull bool
+}
+
+func (g *Generator) isAsyncFunction(packageName string, funcName string) bool {
+	return g.asyncFunctions[funcName] || g.asyncFunctions[packageName+"."+funcName]
+}
+
+// Returns the C type of a wrapper output given its Go type, without the pointer
+func outputCType(typeName string) (string, bool) {
+	typeName = strings.TrimPrefix(typeName, "*")
+	if strings.HasPrefix(typeName, "C.") {
+		return typeName[len("C."):], true
+	}
+	return GetCTypeFromGoType(typeName)
+}
+
+// Returns jen code for a pointer to a C type
+func cPointerCode(ctype string) *jen.Statement {
+	if ctype == "void*" {
+		return jen.Op("*").Qual("unsafe", "Pointer")
+	}
+	return jen.Op("*").Qual("C", ctype)
+}
+
+// Adds the asynchronous variant of the wrapper cfuncName
+func (g *Generator) addAsyncWrapper(fast *ast.File, fdecl *ast.FuncDecl, outFile *jen.File, cfuncName string, params []wrapperParam) {
+	callbackType := cfuncName + "_Callback"
+	invokeName := cfuncName + "_InvokeCallback"
+
+	// C function pointers can only be called from C
+	callbackArgs := []string{"GoUint32_ code"}
+	var outputCTypes []string
+	for _, param := range params {
+		if !param.isOutput {
+			continue
+		}
+		ctype, ok := outputCType(param.typeName)
+		if !ok {
+			g.reportWarningAt(fast, fdecl.Name, "asynchronous wrapper of %s not generated, unknown C type of %s",
+				cfuncName, param.typeName)
+			return
+		}
+		outputCTypes = append(outputCTypes, ctype)
+		callbackArgs = append(callbackArgs, ctype+"* "+param.name)
+	}
+	callbackArgs = append(callbackArgs, "void* userData")
+	argNames := make([]string, 0, len(callbackArgs))
+	for _, arg := range callbackArgs {
+		argNames = append(argNames, arg[strings.LastIndex(arg, " ")+1:])
+	}
+	outFile.CgoPreamble("typedef void (*" + callbackType + ")(" + strings.Join(callbackArgs, ", ") + ");\n" +
+		"static void " + invokeName + "(" + callbackType + " callback, " + strings.Join(callbackArgs, ", ") + ") {\n" +
+		"\tcallback(" + strings.Join(argNames, ", ") + ");\n" +
+		"}")
+
+	var asyncParams []jen.Code
+	var callArgs []jen.Code
+	var outputVars []jen.Code
+	completedArgs := []jen.Code{jen.Id("_callback"), jen.Qual("C", "GoUint32_").Call(jen.Id("code"))}
+	canceledArgs := []jen.Code{jen.Id("_callback"),
+		jen.Qual("C", "GoUint32_").Call(jen.Id("libErrorCode").Call(jen.Id("err")))}
+	outputIndex := 0
+	for _, param := range params {
+		if param.isOutput && param.typeName == "*C.GoSlice_" {
+			// Buffer of the caller
+			outputIndex++
+			asyncParams = append(asyncParams, jen.Id(param.name).Id(param.typeName))
+			callArgs = append(callArgs, jen.Id(param.name))
+			completedArgs = append(completedArgs, jen.Id(param.name))
+			canceledArgs = append(canceledArgs, jen.Nil())
+			continue
+		}
+		if param.isOutput {
+			ctype := outputCTypes[outputIndex]
+			outputIndex++
+			outputVars = append(outputVars, jen.Var().Id(param.name).Id(strings.TrimPrefix(param.typeName, "*")))
+			callArgs = append(callArgs, jen.Op("&").Id(param.name))
+			completedArgs = append(completedArgs, jen.Parens(cPointerCode(ctype)).
+				Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Op("&").Id(param.name))))
+			canceledArgs = append(canceledArgs, jen.Nil())
+			continue
+		}
+		asyncParams = append(asyncParams, jen.Id(param.name).Id(param.typeName))
+		if param.typeName == "C."+contextHandleType {
+			callArgs = append(callArgs, jen.Id("request"))
+		} else {
+			callArgs = append(callArgs, jen.Id(param.name))
+		}
+	}
+	completedArgs = append(completedArgs, jen.Id("_userData"))
+	canceledArgs = append(canceledArgs, jen.Id("_userData"))
+	asyncParams = append(asyncParams,
+		jen.Id("_callback").Qual("C", callbackType),
+		jen.Id("_userData").Qual("unsafe", "Pointer"),
+		jen.Id("_request").Op("*").Qual("C", contextHandleType))
+
+	// The caller may pass a token as parent of the request
+	parent := jen.Qual("context", "Background").Call()
+	body := jenCodeToArray(g.getNullArgumentCheckCode("_callback"), g.getNullArgumentCheckCode("_request"))
+	for _, param := range params {
+		if !param.isOutput && param.typeName == "C."+contextHandleType {
+			name := strings.TrimPrefix(param.name, "_")
+			body = append(body, g.getContextParameterCode(name)...)
+			parent = jen.Id(name)
+			break
+		}
+	}
+	// The callback of a cancellation waits for the call, inputs and buffers of the caller
+	// must not be used after it
+	freeOutputs := g.freeAsyncOutputsCode(fast, cfuncName, params)
+	worker := append(outputVars,
+		jen.Id("code").Op(":=").Id(cfuncName).Call(callArgs...),
+		jen.If(jen.Id("err").Op(":=").Id("requestCtx").Dot("Err").Call(), jen.Id("err").Op("!=").Nil()).Block(
+			freeOutputs,
+			jen.Qual("C", invokeName).Call(canceledArgs...),
+			jen.Return(),
+		),
+		jen.Qual("C", invokeName).Call(completedArgs...),
+		freeOutputs,
+	)
+	body = append(body,
+		jen.List(jen.Id("requestCtx"), jen.Id("cancelRequest")).Op(":=").Qual("context", "WithCancel").Call(parent),
+		jen.Id("request").Op(":=").Id("registerContextToken").Call(jen.Id("requestCtx"), jen.Id("cancelRequest")),
+		jen.Op("*").Id("_request").Op("=").Id("request"),
+		jen.Go().Func().Params().Block(append([]jen.Code{jen.Defer().Id("cancelRequest").Call()}, worker...)...).Call(),
+		jen.Return(),
+	)
+
+	asyncName := cfuncName + "_Async"
+	outFile.Comment("export " + asyncName) //nolint staticcheck
+	outFile.Func().Id(asyncName).Params(asyncParams...).
+		Parens(jen.Id(returnVarName).Id("uint32")).Block(body...)
+}
+
+// Returns a statement freeing the outputs of the asynchronous wrapper of cfuncName allocated by the
+// synchronous wrapper, once passed to the callback
+func (g *Generator) freeAsyncOutputsCode(fast *ast.File, cfuncName string, params []wrapperParam) jen.Code {
+	allocated := g.allocatedParams(fast, params)
+	if len(allocated) == 0 {
+		return jen.Null()
+	}
+	var args []jen.Code
+	for _, param := range allocated {
+		if param.isOutput {
+			args = append(args, jen.Op("&").Id(param.name))
+		} else {
+			// Inputs copied back belong to the caller
+			args = append(args, jen.Nil())
+		}
+	}
+	return jen.Id(cfuncName + "_Free").Call(args...)
+}
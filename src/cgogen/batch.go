@@ -0,0 +1,177 @@
+package cgogen
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Source file being wrapped and the state of its generation
+type fileJob struct {
+	path         string
+	outputFileGO string
+	outputFileCH string
+	// Positions of the parsed source file
+	fset *token.FileSet
+	// Imports of the source file
+	importDefs []*ast.GenDecl
+	// Helper functions and C types already added to the output file
+	generatedHelpers map[string]bool
+	// Wrappers exported, called by the smoke tests
+	wrappers []exportedWrapper
+	// Parameters of the wrapper being generated filled by copyToC_ helpers
+	allocatedOutputs []allocatedOutput
+	// Types of the copyFromC_ helpers reading the parameters of the wrapper being generated, by parameter
+	inputHelpers map[string]string
+	// Hashes of the outputs saved, keyed by path
+	savedOutputs map[string]string
+	// Wrapping of the exported API, for the coverage report
+	coverage []coverageEntry
+	// Hash of the inputs recorded in the manifest
+	inputHash string
+	// Headers of other sources included by the types header
+	includes []string
+	// Go code of the wrappers and C code of the types generated
+	goCode    string
+	typesCode string
+	// Go code of the layout test of the wrappers, with -layouttest
+	layoutTestCode string
+	// Whether the outputs were generated, false if they were up to date
+	generated bool
+}
+
+func newFileJob(path string, outputFileGO string, outputFileCH string) *fileJob {
+	return &fileJob{
+		path:             path,
+		outputFileGO:     outputFileGO,
+		outputFileCH:     outputFileCH,
+		generatedHelpers: make(map[string]bool),
+		savedOutputs:     make(map[string]string),
+	}
+}
+
+// Saves an output of the source file and records its hash for the manifest
+func (g *Generator) saveOutput(job *fileJob, fileName string, text string) {
+	g.saveTextToFile(fileName, text)
+	job.savedOutputs[fileName] = hashText(text)
+}
+
+func (g *Generator) startFileJob(fast *ast.File, job *fileJob) {
+	g.fileJobsLock.Lock()
+	defer g.fileJobsLock.Unlock()
+	g.fileJobs[fast] = job
+}
+
+func (g *Generator) finishFileJob(fast *ast.File) {
+	g.fileJobsLock.Lock()
+	defer g.fileJobsLock.Unlock()
+	delete(g.fileJobs, fast)
+}
+
+// Returns the job processing the source file
+func (g *Generator) jobOf(fast *ast.File) *fileJob {
+	g.fileJobsLock.Lock()
+	defer g.fileJobsLock.Unlock()
+	return g.fileJobs[fast]
+}
+
+// Dependant types and functions found by the sources of a run, which are processed one at a time
+type dependencyRegistry struct {
+	types     []string
+	functions []string
+}
+
+func (g *Generator) loadDependencies() {
+	if g.cfg.TypeDependencyFile != "" {
+		g.dependencies.types = g.loadDependencyFile(g.cfg.TypeDependencyFile, "|")
+	}
+	if g.cfg.FuncDependencyFile != "" {
+		g.dependencies.functions = g.loadDependencyFile(g.cfg.FuncDependencyFile, "\n")
+	}
+}
+
+// Saves the dependencies sorted, whatever the order of the sources
+func (g *Generator) saveDependencies() {
+	types := sortedCopy(g.dependencies.types)
+	functions := sortedCopy(g.dependencies.functions)
+	if g.cfg.TypeDependencyFile != "" {
+		g.saveDependencyFile(g.cfg.TypeDependencyFile, types, "|")
+	} else {
+		fmt.Println("Dependant Types: ", types)
+	}
+	if g.cfg.FuncDependencyFile != "" {
+		g.saveDependencyFile(g.cfg.FuncDependencyFile, functions, "\r\n")
+	} else {
+		fmt.Println("Dependant Functions: ", functions)
+	}
+}
+
+func sortedCopy(list []string) []string {
+	sorted := append([]string(nil), list...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Reads the sources of a batch, one per line as -i SOURCE [-g GO_FILE] [-h HEADER_FILE]
+func LoadBatchFile(path string) ([]Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sources []Source
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		flags := flag.NewFlagSet(fmt.Sprintf("%s:%d", path, lineNumber), flag.ContinueOnError)
+		source := flags.String("i", "", "PATH to source file")
+		outputFileGO := flags.String("g", "", "PATH to destination file for go code")
+		outputFileCH := flags.String("h", "", "PATH to destination file for header C code")
+		if err := flags.Parse(strings.Fields(line)); err != nil {
+			return nil, err
+		}
+		if *source == "" {
+			return nil, fmt.Errorf("%s:%d: missing source file", path, lineNumber)
+		}
+		sources = append(sources, Source{Path: *source, OutputFileGO: *outputFileGO, OutputFileCH: *outputFileCH})
+	}
+	return sources, scanner.Err()
+}
+
+// Processes the sources on a pool of workers.
+// Outputs are the same as processing them in order, one per run.
+func (g *Generator) runFileJobs(jobs []*fileJob, workers int) {
+	if g.cfg.ProcessDependencies && workers > 1 {
+		// Each source sees the dependant types found by the previous ones
+		g.reportWarning("Processing sources in order to analyze dependencies, ignoring %d workers", workers)
+		workers = 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan *fileJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				g.doGoFile(job)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+package cgogen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Runs the sources of the case with the number of workers given, returning the outputs
+// and the coverage report saved in dir, keyed by path relative to dir
+func runBatchTest(t *testing.T, caseDir string, dir string, workers int) map[string]string {
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	g := newTestGenerator(t, caseDir)
+	g.cfg.Workers = workers
+	g.cfg.CoverageTextFile = filepath.Join(dir, "coverage.txt")
+	var sources []Source
+	for _, source := range caseSources(t, caseDir) {
+		rel, _ := filepath.Rel(caseDir, source.Path)
+		source.OutputFileGO = filepath.Join(dir, rel+".wrap.go")
+		source.OutputFileCH = filepath.Join(dir, rel+".h")
+		if err := os.MkdirAll(filepath.Dir(source.OutputFileGO), 0755); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, source)
+	}
+	g.doGoFiles(sources)
+	outputs := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		outputs[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs["diagnostics"] = diagnosticsText(g)
+	return outputs
+}
+
+// Sources processed in parallel get the same outputs as processed one at a time
+func TestBatchWorkers(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "cgogen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	out := filepath.Join(tmpDir, "out")
+	for _, caseDir := range caseDirs(t, filepath.Join("testdata", "wrap")) {
+		caseDir := caseDir
+		t.Run(filepath.Base(caseDir), func(t *testing.T) {
+			sequential := runBatchTest(t, caseDir, out, 1)
+			parallel := runBatchTest(t, caseDir, out, 8)
+			for path, text := range sequential {
+				if parallelText, found := parallel[path]; !found {
+					t.Errorf("%s saved by 1 worker only", path)
+				} else if parallelText != text {
+					t.Errorf("%s differs between 1 and 8 workers:\n%s", path,
+						unifiedDiff("1 worker", "8 workers", text, parallelText))
+				}
+			}
+			for path := range parallel {
+				if _, found := sequential[path]; !found {
+					t.Errorf("%s saved by 8 workers only", path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package cgogen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+/*
+With the go tool and a C compiler on the path, the wrappers generated for every
+case of testdata/wrap are also compiled, unless the tests run with -short. The
+packages of the case are copied to a GOPATH as example.com/lib/CASE, and the
+wrappers, the types headers, the cancellation tokens API and stubs of the
+library functions they call to a package main, which is vetted and tested under
+cgocheck=2, and the smoke test of every file is run. The package is also built as
+a C archive to compile and run the C smoke test of -verify. Cases whose types headers
+include each other are skipped. Optional files of the case:
+
+	library.h.txt   C types of the library used by the types headers, such as handles
+	library.go.txt  library functions used by the wrappers of the case, such as handles
+	checks.go.txt   checks of the generated conversions, appended to buildChecks by init
+*/
+
+// Library functions and C types every wrapper package is built with
+const buildLibraryStub = `package main
+
+import (
+	"errors"
+	"reflect"
+	"unsafe"
+)
+
+/*
+#include <stdlib.h>
+#include <string.h>
+
+#include "skytypes.h"
+*/
+import "C"
+
+const (
+	SKY_ERROR                = 0x7FFFFFFF
+	SKY_BAD_HANDLE           = 0x7F000001
+	SKY_ERROR_NULL_ARGUMENT  = 0x7F000002
+	SKY_ERROR_INVALID_LENGTH = 0x7F000003
+)
+
+func libErrorCode(err error) uint32 {
+	if err != nil {
+		return SKY_ERROR
+	}
+	return 0
+}
+
+// Copies the slice into the buffer of dst, setting its length to that needed
+func copyToGoSlice(src reflect.Value, dst *C.GoSlice_) {
+	n := src.Len()
+	size := int(src.Type().Elem().Size())
+	if int(dst.cap) >= n && n > 0 {
+		C.memcpy(dst.data, unsafe.Pointer(src.Pointer()), C.size_t(n*size))
+	}
+	dst.len = C.GoInt_(n)
+}
+
+func copyString(src string, dst *C.GoString_) {
+	dst.p = C.CString(src)
+	dst.n = C.GoInt_(len(src))
+}
+
+func copyToStringMap(src map[string]string, dst *C.GoStringMap_) {}
+
+// Check of the generated conversions
+type buildCheck struct {
+	name string
+	run  func() error
+}
+
+var buildChecks []buildCheck
+
+var errCheck = errors.New("check failed")
+
+func main() {}
+`
+
+// Test running the checks of the case
+const buildChecksTest = `package main
+
+import "testing"
+
+func TestBuildChecks(t *testing.T) {
+	for _, check := range buildChecks {
+		if err := check.run(); err != nil {
+			t.Errorf("%s: %v", check.name, err)
+		}
+	}
+}
+`
+
+// C types of the library the types headers are included after
+const buildTypesHeader = `#pragma once
+#include "prims.h"
+typedef struct { const char *p; GoInt_ n; } GoString_;
+typedef struct { void *data; GoInt_ len; GoInt_ cap; } GoSlice_;
+typedef void *GoMap_;
+typedef GoMap_ GoStringMap_;
+typedef void *GoChan_;
+typedef struct { void *t; void *v; } GoInterface_;
+typedef GoUint64_ Handle;
+`
+
+func writeBuildFile(t *testing.T, path string, text string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Copies the Go files of the case and of its subdirectories to dst
+func copyCasePackages(t *testing.T, dir string, dst string) {
+	for _, pattern := range []string{"*.go", filepath.Join("*", "*.go")} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range matches {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel, _ := filepath.Rel(dir, file)
+			writeBuildFile(t, filepath.Join(dst, rel), string(data))
+		}
+	}
+}
+
+// Returns the optional file of the case, empty if missing
+func readCaseFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func runBuildCommand(t *testing.T, dir string, env []string, args ...string) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+// Builds the wrappers as a C archive, then compiles and runs the C smoke test of -verify
+func runCSmokeTest(t *testing.T, dir string, env []string, wrappers []exportedWrapper) {
+	// C files of the package directory would be compiled by cgo
+	smokeDir := filepath.Join(filepath.Dir(dir), "csmoke")
+	archive := filepath.Join(smokeDir, verifyArchive)
+	runBuildCommand(t, dir, env, "build", "-buildmode=c-archive", "-o", archive, ".")
+	if t.Failed() {
+		return
+	}
+	program := filepath.Join(smokeDir, "smoke.c")
+	writeBuildFile(t, program, generateCSmokeTest(verifyHeader, wrappers))
+	binary := filepath.Join(smokeDir, "smoke")
+	compiler := cCompiler()
+	args := append(compiler[1:], "-o", binary, "-I", dir, program, archive)
+	compile := exec.Command(compiler[0], append(args, cLinkFlags(runtime.GOOS)...)...)
+	if output, err := compile.CombinedOutput(); err != nil {
+		t.Fatalf("compiling the C smoke test failed: %v\n%s", err, output)
+	}
+	if output, err := exec.Command(binary).CombinedOutput(); err != nil {
+		t.Errorf("C smoke test failed: %v\n%s", err, output)
+	}
+}
+
+func TestWrapBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the wrappers is skipped with -short")
+	}
+	for _, tool := range []string{"go", "cc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("building the wrappers needs %s: %v", tool, err)
+		}
+	}
+	for _, dir := range caseDirs(t, filepath.Join("testdata", "wrap")) {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			gopath, err := ioutil.TempDir("", "cgogen")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(gopath)
+			caseName := filepath.Base(dir)
+			copyCasePackages(t, dir, filepath.Join(gopath, "src", testImportPath+caseName))
+			out := filepath.Join(gopath, "src", "wrappers")
+
+			g := newTestGenerator(t, dir)
+			sources := caseSources(t, dir)
+			g.indexTypes(sources)
+			header := buildTypesHeader + readCaseFile(t, filepath.Join(dir, "library.h.txt"))
+			var jobs []*fileJob
+			var smokeTags []string
+			var wrappers []exportedWrapper
+			for _, source := range sources {
+				job := newFileJob(source.Path, "", source.OutputFileCH)
+				jobs = append(jobs, job)
+				g.generateFile(job, true, true)
+				rel, _ := filepath.Rel(dir, source.Path)
+				name := strings.TrimSuffix(rel, ".go")
+				writeBuildFile(t, filepath.Join(out, helperFileTag(name)+".wrap.go"), job.goCode)
+				writeBuildFile(t, filepath.Join(out, name+".h"), job.typesCode)
+				if job.layoutTestCode != "" {
+					writeBuildFile(t, filepath.Join(out, layoutTestFileName(helperFileTag(name)+".wrap.go")),
+						job.layoutTestCode)
+				}
+				header += "#include \"" + filepath.ToSlash(name) + ".h\"\n"
+				smoke := &bytes.Buffer{}
+				if err := g.generateSmokeTest(job).Render(smoke); err != nil {
+					t.Fatal(err)
+				}
+				writeBuildFile(t, filepath.Join(out, smokeTestTag(job)+".go"), smoke.String())
+				smokeTags = append(smokeTags, smokeTestTag(job))
+				wrappers = append(wrappers, job.wrappers...)
+			}
+			reported := len(g.Diagnostics())
+			if g.checkIncludeCycles(jobs); len(g.Diagnostics()) > reported {
+				t.Skip("types headers including each other can't be compiled")
+			}
+			contextAPI, err := g.ContextAPI()
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeBuildFile(t, filepath.Join(out, "context.go"), contextAPI)
+			writeBuildFile(t, filepath.Join(out, "prims.h"), g.PrimitivesHeader())
+			writeBuildFile(t, filepath.Join(out, "skytypes.h"), header)
+			writeBuildFile(t, filepath.Join(out, "library.go"), buildLibraryStub)
+			writeBuildFile(t, filepath.Join(out, "checks_test.go"), buildChecksTest)
+			if library := readCaseFile(t, filepath.Join(dir, "library.go.txt")); library != "" {
+				writeBuildFile(t, filepath.Join(out, "case_library.go"), library)
+			}
+			if checks := readCaseFile(t, filepath.Join(dir, "checks.go.txt")); checks != "" {
+				writeBuildFile(t, filepath.Join(out, "case_checks.go"), checks)
+			}
+
+			env := append(os.Environ(), "GOPATH="+gopath, "GO111MODULE=off", "CGO_ENABLED=1")
+			runBuildCommand(t, out, env, "vet", ".")
+			runCSmokeTest(t, out, env, wrappers)
+			if goVersionAtLeast(1, 21) {
+				env = append(env, "GOEXPERIMENT=cgocheck2")
+			} else {
+				env = append(env, "GODEBUG=cgocheck=2")
+			}
+			runBuildCommand(t, out, env, "test", ".")
+			for _, tag := range smokeTags {
+				runBuildCommand(t, out, env, "run", "-tags", tag, ".")
+			}
+		})
+	}
+}
@@ -1,14 +1,17 @@
-package main
+package cgogen
 
 import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"reflect"
 	"strings"
 )
 
 type CCompiler struct {
+	g            *Generator
+	fset         *token.FileSet
 	source       *ast.File
 	ccode        *CCode
 	includes     []string
@@ -25,6 +28,8 @@ type CCode struct {
 	vardefs   []VarDef
 	forwards  []string
 	functions map[string]*Function
+	// Keys of functions in source order, the order of their prototypes and bodies
+	functionNames []string
 }
 
 type ConstDef struct {
@@ -64,8 +69,8 @@ type Parameter struct {
 	ctype string
 }
 
-func NewCompiler() (compiler *CCompiler) {
-	compiler = &CCompiler{}
+func NewCompiler(g *Generator, fset *token.FileSet) (compiler *CCompiler) {
+	compiler = &CCompiler{g: g, fset: fset}
 	compiler.ccode = &CCode{}
 	compiler.ccode.functions = make(map[string]*Function)
 	compiler.defStack = append(compiler.defStack, compiler.ccode)
@@ -107,8 +112,8 @@ func (c *CCompiler) GetHeaderCode() (header string) {
 	}
 
 	header += "\n\n"
-	for _, funcDef := range c.ccode.functions {
-		header += c.createSignature(funcDef) + ";\n"
+	for _, name := range c.ccode.functionNames {
+		header += c.createSignature(c.ccode.functions[name]) + ";\n"
 	}
 
 	return
@@ -117,7 +122,8 @@ func (c *CCompiler) GetHeaderCode() (header string) {
 func (c *CCompiler) GetCCode() (code string) {
 	code = fmt.Sprintf("#include \"%s.h\"\n", c.source.Name.Name)
 	code += "\n\n"
-	for _, funcDef := range c.ccode.functions {
+	for _, name := range c.ccode.functionNames {
+		funcDef := c.ccode.functions[name]
 		code += c.createSignature(funcDef)
 		code += funcDef.body + "\n"
 	}
@@ -130,6 +136,11 @@ func (c *CCompiler) Compile(source *ast.File) {
 	c.processImplementation()
 }
 
+// Reports an error at the node of the source being compiled
+func (c *CCompiler) reportErrorAt(node ast.Node, msg string, a ...interface{}) {
+	c.g.addDiagnostic(c.fset.Position(node.Pos()), SeverityError, msg, a...)
+}
+
 func (c *CCompiler) pushStack() {
 	c.defStack = append(c.defStack, &CCode{})
 }
@@ -138,7 +149,7 @@ func (c *CCompiler) popStack() {
 	if len(c.defStack) > 0 {
 		c.defStack = c.defStack[:len(c.defStack)-1]
 	} else {
-		reportError("Poping empty stack")
+		c.g.reportError("Poping empty stack")
 	}
 }
 
@@ -146,7 +157,7 @@ func (c *CCompiler) getTopOfStack() *CCode {
 	if len(c.defStack) > 0 {
 		return c.defStack[len(c.defStack)-1]
 	} else {
-		reportError("Poping empty stack")
+		c.g.reportError("Poping empty stack")
 		return nil
 	}
 }
@@ -247,7 +258,7 @@ func (c *CCompiler) processVarExpression(decl *ast.GenDecl) {
 func (c *CCompiler) processUnknown(decl ast.Decl) {
 	s := reflect.ValueOf(decl).Elem()
 	typeOfT := s.Type()
-	reportError("Don't know what to do with: %s", typeOfT)
+	c.reportErrorAt(decl, "Don't know what to do with: %s", typeOfT)
 }
 
 func (c *CCompiler) processImport(decl *ast.GenDecl) {
@@ -296,7 +307,7 @@ func (c *CCompiler) processTypeExpression(type_expr ast.Expr) (code string, resu
 	} else {
 		x := reflect.ValueOf(type_expr).Elem()
 		typeOfT := x.Type()
-		reportError("Unknown type: %s", typeOfT)
+		c.reportErrorAt(type_expr, "Unknown type: %s", typeOfT)
 	}
 	return
 }
@@ -333,7 +344,7 @@ func (c *CCompiler) processIntegerConstExpression(expr ast.Expr, isForArray bool
 			return litExpr.Value, true
 		} else {
 			if isForArray {
-				reportError("Array length must be integer")
+				c.reportErrorAt(litExpr, "Array length must be integer")
 			}
 			return "", false
 		}
@@ -359,13 +370,13 @@ func (c *CCompiler) processIntegerConstExpression(expr ast.Expr, isForArray bool
 			return identExpr.Name + packageSeparator + selectorExpr.Sel.Name, true
 		} else {
 			if isForArray {
-				reportError("Selector with complex expression in array length")
+				c.reportErrorAt(selectorExpr, "Selector with complex expression in array length")
 			}
 			return "", false
 		}
 	} else {
 		if isForArray {
-			reportError("Can't deal with this array len type %s", getTypeOfVar(expr))
+			c.reportErrorAt(expr, "Can't deal with this array len type %s", getTypeOfVar(expr))
 		}
 	}
 	return "", false
@@ -380,13 +391,13 @@ func (c *CCompiler) processArray(arrayExpr *ast.ArrayType) (string, bool) {
 	} else {
 		arrayLenCode, ok = c.processIntegerConstExpression(arrayExpr.Len, true)
 		if !ok {
-			reportError("Couldn't process array length expression")
+			c.reportErrorAt(arrayExpr.Len, "Couldn't process array length expression")
 		}
 	}
 	if ok {
 		arrayElemCode, ok = c.processTypeExpression(arrayExpr.Elt)
 	} else {
-		reportError("Couldn't process array length expression")
+		c.reportErrorAt(arrayExpr.Len, "Couldn't process array length expression")
 	}
 	if ok {
 		if arrayExpr.Len == nil {
@@ -415,7 +426,7 @@ func (c *CCompiler) processSelector(selectorExpr *ast.SelectorExpr) (string, boo
 	if isIdent {
 		return identExpr.Name + packageSeparator + selectorExpr.Sel.Name, true
 	} else {
-		reportError("Selector with complex expression")
+		c.reportErrorAt(selectorExpr, "Selector with complex expression")
 		return "", false
 	}
 }
@@ -437,19 +448,12 @@ func (c *CCompiler) processIdentifier(identExpr *ast.Ident) string {
 func (c *CCompiler) processStructType(typeStruct *ast.StructType) (string, bool) {
 	c_code := "struct{\n"
 	for _, field := range typeStruct.Fields.List {
-		var names []string
-		for _, fieldName := range field.Names {
-			names = append(names, fieldName.Name)
-		}
-		if len(names) == 0 {
-			names = append(names, "_unnamed")
-		}
-		for _, fieldName := range names {
+		for _, fieldName := range structFieldNames(field) {
 			code, ok := c.processTypeExpression(field.Type)
 			if ok {
 				c_code += buildTypeWithVarName(code, fieldName) + ";\n"
 			} else {
-				reportError("Couldn't process %s", field.Type)
+				c.reportErrorAt(field, "Couldn't process %s", types.ExprString(field.Type))
 			}
 		}
 	}
@@ -492,7 +496,7 @@ func (c *CCompiler) processFunctionBody(fdecl *ast.FuncDecl) {
 	if found {
 		function.body = c.generateBlock(fdecl.Body)
 	} else {
-		reportError("Function name %s.%s not found to generate body", packageName, funcName)
+		c.reportErrorAt(fdecl, "Function name %s.%s not found to generate body", packageName, funcName)
 	}
 }
 
@@ -517,7 +521,11 @@ func (c *CCompiler) processFunctionPrototype(fdecl *ast.FuncDecl) {
 	resultType := c.getFuncResultType(fdecl)
 	f.parameters = parameters
 	f.returnType = resultType
-	c.ccode.functions[f.packageName+"."+f.originalName] = &f
+	key := f.packageName + "." + f.originalName
+	if _, found := c.ccode.functions[key]; !found {
+		c.ccode.functionNames = append(c.ccode.functionNames, key)
+	}
+	c.ccode.functions[key] = &f
 }
 
 func (c *CCompiler) getFuncReceiverParam(fdecl *ast.FuncDecl) *Parameter {
@@ -566,7 +574,7 @@ func (c *CCompiler) getFuncParams(fdecl *ast.FuncDecl) (parameters []Parameter)
 				parameters = append(parameters, p)
 			}
 		} else {
-			reportError("Couldn't process parameter %d in function %s", index+1, fdecl.Name.Name)
+			c.reportErrorAt(param, "Couldn't process parameter %d in function %s", index+1, fdecl.Name.Name)
 		}
 	}
 	return
@@ -597,7 +605,7 @@ func (c *CCompiler) getFuncResultType(fdecl *ast.FuncDecl) (r string) {
 					parameters = append(parameters, p)
 				}
 			} else {
-				reportError("Couldn't process return parameter %d in function %s", index, fdecl.Name.Name)
+				c.reportErrorAt(param, "Couldn't process return parameter %d in function %s", index, fdecl.Name.Name)
 			}
 		}
 	}
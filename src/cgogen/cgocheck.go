@@ -0,0 +1,484 @@
+package cgogen
+
+import (
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+/*
+Generated wrappers must follow the cgo pointer passing rules: C memory never
+receives Go pointers and Go values never hold pointers read from C memory.
+Values holding Go pointers are copied field by field into memory allocated
+with C.calloc, or passed as handles. Functions using types that can't be
+copied that way are not wrapped.
+
+With -cgocheck the wrappers are verified by building a smoke test and running
+it with GODEBUG=cgocheck=2, or built with GOEXPERIMENT=cgocheck2 on Go 1.21 and
+later. Values of every type with conversion helpers are populated in Go, with
+non-empty strings, slices and maps and nested structs and pointers, converted
+to C memory, back to Go, and freed. The wrappers of the functions of setting
+CGOGEN SMOKE are also called, with populated inputs converted to C memory the
+same way and outputs in C memory, flat slices having a buffer to be copied
+into, then their outputs are freed. Other functions may not accept arbitrary
+values, they aren't called. Any panic fails the smoke test.
+*/
+
+// Returns whether values of the type can cross the C boundary without breaking the pointer rules
+func (g *Generator) followsPointerRules(fast *ast.File, typeExpr ast.Expr) bool {
+	if isContextType(fast, typeExpr) || g.findConverter(fast, typeExpr) != nil {
+		return true
+	}
+	if _, isHandle := g.handleTypeKey(fast, typeExpr); isHandle {
+		return true
+	}
+	switch t := typeExpr.(type) {
+	case *ast.StarExpr:
+		return g.followsPointerRules(fast, t.X)
+	case *ast.Ellipsis:
+		return g.followsPointerRules(fast, t.Elt)
+	case *ast.Ident:
+		if IsBasicGoType(t.Name) || g.isInCustomTypesList(t.Name) || g.isInplaceConvertType(t.Name) {
+			return true
+		}
+		for name := range g.arrayTypes {
+			if name == t.Name {
+				// Converted by the library
+				return true
+			}
+		}
+	case *ast.SelectorExpr:
+		if isUnsafePointer(t) {
+			return true
+		}
+	case *ast.ArrayType:
+		if g.isFlatSlice(fast, t) {
+			// Read in place from C memory and copied into C memory
+			return true
+		}
+	case *ast.MapType, *ast.InterfaceType:
+		// Converted by the library
+		return true
+	}
+	return g.isFlatType(fast, typeExpr) || g.needsDeepConversion(fast, typeExpr)
+}
+
+// Returns the receiver, parameter or result of the function breaking the pointer rules, if any
+func (g *Generator) findPointerRulesViolation(fast *ast.File, fdecl *ast.FuncDecl) (*ast.Field, bool) {
+	var fields []*ast.Field
+	if fdecl.Recv != nil {
+		fields = append(fields, fdecl.Recv.List...)
+	}
+	fields = append(fields, fdecl.Type.Params.List...)
+	if fdecl.Type.Results != nil {
+		fields = append(fields, fdecl.Type.Results.List...)
+	}
+	for _, field := range fields {
+		if !g.followsPointerRules(fast, field.Type) {
+			return field, true
+		}
+	}
+	return nil, false
+}
+
+func (g *Generator) isSmokeFunction(packageName string, funcName string) bool {
+	return g.smokeFunctions[funcName] || g.smokeFunctions[packageName+"."+funcName]
+}
+
+// Returns the build tag of the smoke test of the output file
+func smokeTestTag(job *fileJob) string {
+	return "cgogen_smoke_" + helperFileTag(job.path)
+}
+
+// Prefixes of the conversion helpers called by the smoke test, in the order they are called
+var smokeTestHelperPrefixes = []string{"copyFromC_", "copyToC_", "freeC_"}
+
+// Levels of pointers, slices and maps populated in the values of the smoke test
+const smokeTestDepth = 3
+
+// Elements and element size of the buffers the outputs of flat slices are copied into
+const (
+	smokeTestBufferLen      = 16
+	smokeTestBufferElemSize = 4096
+)
+
+// Returns the statement calling f of type reflect.Value with the arguments of a helper
+func smokeTestCallHelper(f string, args ...jen.Code) *jen.Statement {
+	return jen.Id(f).Dot("Call").Call(jen.Id("smokeTestArgs").Call(append([]jen.Code{jen.Id(f)}, args...)...))
+}
+
+// Returns the statements populating a new Go value of the type the helper toC converts from
+func smokeTestNewGoValue() []jen.Code {
+	return []jen.Code{
+		jen.Id("goValue").Op(":=").Qual("reflect", "New").Call(
+			jen.Id("toC").Dot("Type").Call().Dot("In").Call(jen.Lit(0)).Dot("Elem").Call()),
+		jen.Id("smokeTestPopulate").Call(jen.Id("goValue").Dot("Elem").Call(), jen.Id("smokeTestDepth"), jen.False()),
+	}
+}
+
+// Returns the smoke test converting populated values with the conversion helpers of the
+// output file and calling the wrappers of the functions of setting CGOGEN SMOKE
+func (g *Generator) generateSmokeTest(job *fileJob) *jen.File {
+	outFile := jen.NewFile("main")
+	outFile.HeaderComment("//go:build " + smokeTestTag(job))
+	outFile.HeaderComment("// +build " + smokeTestTag(job))
+	outFile.CgoPreamble(`
+	  #include <stdlib.h>
+
+	  #include "` + g.includePrefix + `types.h"`)
+
+	// Helpers of a type share the name of the type
+	helpers := make(map[string][]jen.Code)
+	var typeNames []string
+	for name := range job.generatedHelpers {
+		for index, prefix := range smokeTestHelperPrefixes {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			typeName := strings.TrimPrefix(name, prefix)
+			if _, found := helpers[typeName]; !found {
+				helpers[typeName] = []jen.Code{jen.Nil(), jen.Nil(), jen.Nil()}
+				typeNames = append(typeNames, typeName)
+			}
+			helpers[typeName][index] = jen.Id(name)
+		}
+	}
+	sort.Strings(typeNames)
+	var helperValues []jen.Code
+	for _, typeName := range typeNames {
+		if _, hasToC := job.generatedHelpers["copyToC_"+typeName]; hasToC {
+			// Values are populated in Go and converted to C first
+			helperValues = append(helperValues, jen.Values(append([]jen.Code{jen.Lit(typeName)}, helpers[typeName]...)...))
+		}
+	}
+	outFile.Comment("Conversion helpers of a type")
+	outFile.Type().Id("smokeTestHelper").Struct(
+		jen.Id("name").String(),
+		jen.List(jen.Id("fromC"), jen.Id("toC"), jen.Id("free")).Interface(),
+	)
+	outFile.Var().Id("smokeTestHelpers").Op("=").Index().Id("smokeTestHelper").Values(helperValues...)
+
+	var wrapperValues []jen.Code
+	for _, wrapper := range job.wrappers {
+		if !wrapper.smoke {
+			continue
+		}
+		free := jen.Nil()
+		if wrapper.free != "" {
+			free = jen.Id(wrapper.free)
+		}
+		var outputs, inputHelpers, freed []jen.Code
+		for index, param := range wrapper.params {
+			outputs = append(outputs, jen.Lit(param.isOutput))
+			inputHelpers = append(inputHelpers, jen.Lit(wrapper.inputHelpers[param.name]))
+			for _, freeParam := range wrapper.freeParams {
+				if freeParam.name == param.name {
+					freed = append(freed, jen.Lit(index))
+				}
+			}
+		}
+		wrapperValues = append(wrapperValues, jen.Values(jen.Lit(wrapper.name), jen.Id(wrapper.name), free,
+			jen.Index().Bool().Values(outputs...), jen.Index().String().Values(inputHelpers...),
+			jen.Index().Int().Values(freed...)))
+	}
+	outFile.Comment("Wrapper called by the smoke test, with the function freeing its outputs. For every parameter,")
+	outFile.Comment("whether it is an output and the helpers of its type, if any, and the parameters of the function freeing them")
+	outFile.Type().Id("smokeTestWrapper").Struct(
+		jen.Id("name").String(),
+		jen.List(jen.Id("wrapper"), jen.Id("free")).Interface(),
+		jen.Id("outputs").Index().Bool(),
+		jen.Id("helpers").Index().String(),
+		jen.Id("freed").Index().Int(),
+	)
+	outFile.Var().Id("smokeTestWrappers").Op("=").Index().Id("smokeTestWrapper").Values(wrapperValues...)
+
+	outFile.Comment("Helpers by name")
+	outFile.Var().Id("smokeTestHelpersByName").Op("=").Make(jen.Map(jen.String()).Id("smokeTestHelper"))
+
+	outFile.Const().Defs(
+		jen.Id("smokeTestDepth").Op("=").Lit(smokeTestDepth),
+		jen.Id("smokeTestBufferLen").Op("=").Lit(smokeTestBufferLen),
+		jen.Id("smokeTestBufferElemSize").Op("=").Lit(smokeTestBufferElemSize),
+	)
+
+	outFile.Comment("Returns the arguments of a helper, with a new map of the pointers already converted if it takes one")
+	outFile.Func().Id("smokeTestArgs").Params(jen.Id("f").Qual("reflect", "Value"),
+		jen.Id("args").Op("...").Qual("reflect", "Value")).Index().Qual("reflect", "Value").Block(
+		jen.If(jen.Id("f").Dot("Type").Call().Dot("NumIn").Call().Op(">").Len(jen.Id("args"))).Block(
+			jen.Id("args").Op("=").Append(jen.Id("args"),
+				jen.Qual("reflect", "MakeMap").Call(jen.Id("f").Dot("Type").Call().Dot("In").Call(jen.Len(jen.Id("args"))))),
+		),
+		jen.Return(jen.Id("args")),
+	)
+
+	outFile.Comment("Returns a zero value of the pointed type in C memory, so storing Go pointers in it fails")
+	outFile.Func().Id("smokeTestNewC").Params(jen.Id("t").Qual("reflect", "Type")).Params(
+		jen.Qual("reflect", "Value"), jen.Func().Params()).Block(
+		jen.Id("p").Op(":=").Qual("C", "calloc").Call(jen.Lit(1),
+			jen.Qual("C", "size_t").Call(jen.Id("t").Dot("Elem").Call().Dot("Size").Call().Op("+").Lit(1))),
+		jen.Return(jen.Qual("reflect", "NewAt").Call(jen.Id("t").Dot("Elem").Call(), jen.Id("p")),
+			jen.Func().Params().Block(jen.Qual("C", "free").Call(jen.Id("p")))),
+	)
+
+	intKinds := []jen.Code{jen.Qual("reflect", "Int"), jen.Qual("reflect", "Int8"), jen.Qual("reflect", "Int16"),
+		jen.Qual("reflect", "Int32"), jen.Qual("reflect", "Int64")}
+	uintKinds := []jen.Code{jen.Qual("reflect", "Uint"), jen.Qual("reflect", "Uint8"), jen.Qual("reflect", "Uint16"),
+		jen.Qual("reflect", "Uint32"), jen.Qual("reflect", "Uint64"), jen.Qual("reflect", "Uintptr")}
+	forElements := func(populate ...jen.Code) *jen.Statement {
+		return jen.For(jen.Id("i").Op(":=").Lit(0), jen.Id("i").Op("<").Id("v").Dot("Len").Call(), jen.Id("i").Op("++")).Block(populate...)
+	}
+	outFile.Comment("Sets every field and element of the value, and its pointers, slices and maps up to depth levels.")
+	outFile.Comment("Pointers of C values are left nil, they can't point to Go memory.")
+	outFile.Func().Id("smokeTestPopulate").Params(jen.Id("v").Qual("reflect", "Value"), jen.Id("depth").Int(),
+		jen.Id("inC").Bool()).Block(
+		jen.Switch(jen.Id("v").Dot("Kind").Call()).Block(
+			jen.Case(jen.Qual("reflect", "Bool")).Block(jen.Id("v").Dot("SetBool").Call(jen.True())),
+			jen.Case(intKinds...).Block(jen.Id("v").Dot("SetInt").Call(jen.Int64().Call(jen.Id("depth").Op("+").Lit(1)))),
+			jen.Case(uintKinds...).Block(jen.Id("v").Dot("SetUint").Call(jen.Uint64().Call(jen.Id("depth").Op("+").Lit(1)))),
+			jen.Case(jen.Qual("reflect", "Float32"), jen.Qual("reflect", "Float64")).Block(
+				jen.Id("v").Dot("SetFloat").Call(jen.Float64().Call(jen.Id("depth")).Op("+").Lit(0.5))),
+			jen.Case(jen.Qual("reflect", "String")).Block(jen.Id("v").Dot("SetString").Call(jen.Lit("smoke"))),
+			jen.Case(jen.Qual("reflect", "Array")).Block(
+				forElements(jen.Id("smokeTestPopulate").Call(jen.Id("v").Dot("Index").Call(jen.Id("i")), jen.Id("depth"), jen.Id("inC"))),
+			),
+			jen.Case(jen.Qual("reflect", "Struct")).Block(
+				jen.For(jen.Id("i").Op(":=").Lit(0), jen.Id("i").Op("<").Id("v").Dot("NumField").Call(), jen.Id("i").Op("++")).Block(
+					jen.If(jen.Id("v").Dot("Field").Call(jen.Id("i")).Dot("CanSet").Call()).Block(
+						jen.Id("smokeTestPopulate").Call(jen.Id("v").Dot("Field").Call(jen.Id("i")), jen.Id("depth"), jen.Id("inC")),
+					),
+				),
+			),
+			jen.Case(jen.Qual("reflect", "Slice")).Block(
+				jen.If(jen.Id("depth").Op(">").Lit(0)).Block(
+					jen.Id("v").Dot("Set").Call(jen.Qual("reflect", "MakeSlice").Call(jen.Id("v").Dot("Type").Call(), jen.Lit(2), jen.Lit(2))),
+					forElements(jen.Id("smokeTestPopulate").Call(jen.Id("v").Dot("Index").Call(jen.Id("i")),
+						jen.Id("depth").Op("-").Lit(1), jen.Id("inC"))),
+				),
+			),
+			jen.Case(jen.Qual("reflect", "Map")).Block(
+				jen.If(jen.Id("depth").Op(">").Lit(0)).Block(
+					jen.Id("v").Dot("Set").Call(jen.Qual("reflect", "MakeMap").Call(jen.Id("v").Dot("Type").Call())),
+					jen.Id("key").Op(":=").Qual("reflect", "New").Call(jen.Id("v").Dot("Type").Call().Dot("Key").Call()).Dot("Elem").Call(),
+					jen.Id("elem").Op(":=").Qual("reflect", "New").Call(jen.Id("v").Dot("Type").Call().Dot("Elem").Call()).Dot("Elem").Call(),
+					jen.Id("smokeTestPopulate").Call(jen.Id("key"), jen.Id("depth").Op("-").Lit(1), jen.Id("inC")),
+					jen.Id("smokeTestPopulate").Call(jen.Id("elem"), jen.Id("depth").Op("-").Lit(1), jen.Id("inC")),
+					jen.Id("v").Dot("SetMapIndex").Call(jen.Id("key"), jen.Id("elem")),
+				),
+			),
+			jen.Case(jen.Qual("reflect", "Ptr")).Block(
+				jen.If(jen.Id("depth").Op(">").Lit(0).Op("&&").Op("!").Id("inC")).Block(
+					jen.Id("v").Dot("Set").Call(jen.Qual("reflect", "New").Call(jen.Id("v").Dot("Type").Call().Dot("Elem").Call())),
+					jen.Id("smokeTestPopulate").Call(jen.Id("v").Dot("Elem").Call(), jen.Id("depth").Op("-").Lit(1), jen.Id("inC")),
+				),
+			),
+		),
+	)
+
+	outFile.Comment("Converts a populated Go value to C memory and back to Go, then frees the C value")
+	outFile.Func().Id("smokeTestRoundTrip").Params(jen.Id("helper").Id("smokeTestHelper")).Uint32().Block(append(
+		append([]jen.Code{jen.Id("toC").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("helper").Dot("toC"))},
+			smokeTestNewGoValue()...),
+		jen.List(jen.Id("cValue"), jen.Id("free")).Op(":=").Id("smokeTestNewC").Call(
+			jen.Id("toC").Dot("Type").Call().Dot("In").Call(jen.Lit(1))),
+		jen.Defer().Id("free").Call(),
+		smokeTestCallHelper("toC", jen.Id("goValue"), jen.Id("cValue")),
+		jen.Id("code").Op(":=").Id("uint32").Call(jen.Lit(0)),
+		jen.If(jen.Id("helper").Dot("fromC").Op("!=").Nil()).Block(
+			jen.Id("fromC").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("helper").Dot("fromC")),
+			jen.Id("goCopy").Op(":=").Qual("reflect", "New").Call(
+				jen.Id("fromC").Dot("Type").Call().Dot("In").Call(jen.Lit(1)).Dot("Elem").Call()),
+			jen.Id("code").Op("=").Id("uint32").Call(smokeTestCallHelper("fromC", jen.Id("cValue"), jen.Id("goCopy")).
+				Index(jen.Lit(0)).Dot("Uint").Call()),
+		),
+		jen.If(jen.Id("helper").Dot("free").Op("!=").Nil()).Block(
+			jen.Id("freeC").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("helper").Dot("free")),
+			smokeTestCallHelper("freeC", jen.Id("cValue")),
+		),
+		jen.Return(jen.Id("code")),
+	)...)
+
+	outFile.Comment("Returns a populated input of a wrapper, in C memory converted by the named helpers if they")
+	outFile.Comment("convert to C, and the function freeing it")
+	outFile.Func().Id("smokeTestInput").Params(jen.Id("t").Qual("reflect", "Type"), jen.Id("helperName").String()).Params(
+		jen.Qual("reflect", "Value"), jen.Func().Params()).Block(append(append([]jen.Code{
+		jen.Id("cType").Op(":=").Id("t"),
+		jen.If(jen.Id("t").Dot("Kind").Call().Op("==").Qual("reflect", "Ptr")).Block(
+			jen.Id("cType").Op("=").Id("t").Dot("Elem").Call(),
+		),
+		jen.List(jen.Id("helper"), jen.Id("found")).Op(":=").Id("smokeTestHelpersByName").Index(jen.Id("helperName")),
+		jen.If(jen.Op("!").Id("found").Op("&&").Id("t").Dot("Kind").Call().Op("!=").Qual("reflect", "Ptr")).Block(
+			jen.Id("value").Op(":=").Qual("reflect", "New").Call(jen.Id("t")).Dot("Elem").Call(),
+			jen.Id("smokeTestPopulate").Call(jen.Id("value"), jen.Id("smokeTestDepth"), jen.True()),
+			jen.Return(jen.Id("value"), jen.Func().Params().Block()),
+		),
+		jen.If(jen.Op("!").Id("found")).Block(
+			jen.Comment("C values without helpers, such as primitives"),
+			jen.List(jen.Id("cValue"), jen.Id("free")).Op(":=").Id("smokeTestNewC").Call(jen.Id("t")),
+			jen.Id("smokeTestPopulate").Call(jen.Id("cValue").Dot("Elem").Call(), jen.Id("smokeTestDepth"), jen.True()),
+			jen.Return(jen.Id("cValue"), jen.Id("free")),
+		),
+		jen.List(jen.Id("cValue"), jen.Id("free")).Op(":=").Id("smokeTestNewC").Call(
+			jen.Qual("reflect", "TypeOf").Call(jen.Id("helper").Dot("toC")).Dot("In").Call(jen.Lit(1))),
+		jen.Id("toC").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("helper").Dot("toC")),
+	}, smokeTestNewGoValue()...),
+		smokeTestCallHelper("toC", jen.Id("goValue"), jen.Id("cValue")),
+		jen.Id("freeValue").Op(":=").Func().Params().Block(
+			jen.If(jen.Id("helper").Dot("free").Op("!=").Nil()).Block(
+				jen.Id("freeC").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("helper").Dot("free")),
+				smokeTestCallHelper("freeC", jen.Id("cValue")),
+			),
+			jen.Id("free").Call(),
+		),
+		jen.Comment("Helpers of slices convert GoSlice_ values, the type of the parameter may be a typedef"),
+		jen.Id("value").Op(":=").Qual("reflect", "NewAt").Call(jen.Id("cType"),
+			jen.Qual("unsafe", "Pointer").Call(jen.Id("cValue").Dot("Pointer").Call())),
+		jen.If(jen.Id("t").Dot("Kind").Call().Op("==").Qual("reflect", "Ptr")).Block(
+			jen.Return(jen.Id("value"), jen.Id("freeValue")),
+		),
+		jen.Return(jen.Id("value").Dot("Elem").Call(), jen.Id("freeValue")),
+	)...)
+
+	outFile.Comment("Calls the wrapper with populated inputs and outputs in C memory, then frees its outputs")
+	outFile.Func().Id("smokeTestCall").Params(jen.Id("wrapper").Id("smokeTestWrapper")).Uint32().Block(
+		jen.Id("f").Op(":=").Qual("reflect", "ValueOf").Call(jen.Id("wrapper").Dot("wrapper")),
+		jen.Id("args").Op(":=").Make(jen.Index().Qual("reflect", "Value"), jen.Id("f").Dot("Type").Call().Dot("NumIn").Call()),
+		jen.Var().Id("frees").Index().Func().Params(),
+		jen.Defer().Func().Params().Block(
+			jen.For(jen.List(jen.Id("_"), jen.Id("free")).Op(":=").Range().Id("frees")).Block(jen.Id("free").Call()),
+		).Call(),
+		jen.For(jen.Id("i").Op(":=").Range().Id("args")).Block(
+			jen.Var().Id("free").Func().Params(),
+			jen.If(jen.Op("!").Id("wrapper").Dot("outputs").Index(jen.Id("i"))).Block(
+				jen.List(jen.Id("args").Index(jen.Id("i")), jen.Id("free")).Op("=").Id("smokeTestInput").Call(
+					jen.Id("f").Dot("Type").Call().Dot("In").Call(jen.Id("i")), jen.Id("wrapper").Dot("helpers").Index(jen.Id("i"))),
+				jen.Id("frees").Op("=").Append(jen.Id("frees"), jen.Id("free")),
+				jen.Continue(),
+			),
+			jen.List(jen.Id("args").Index(jen.Id("i")), jen.Id("free")).Op("=").Id("smokeTestNewC").Call(
+				jen.Id("f").Dot("Type").Call().Dot("In").Call(jen.Id("i"))),
+			jen.Id("frees").Op("=").Append(jen.Id("frees"), jen.Id("free")),
+			jen.If(jen.List(jen.Id("slice"), jen.Id("isSlice")).Op(":=").Id("args").Index(jen.Id("i")).Dot("Interface").Call().Assert(
+				jen.Op("*").Qual("C", "GoSlice_")), jen.Id("isSlice")).Block(
+				jen.Comment("Buffer the elements of flat slices are copied into"),
+				jen.Id("buffer").Op(":=").Qual("C", "calloc").Call(jen.Id("smokeTestBufferLen"), jen.Id("smokeTestBufferElemSize")),
+				jen.Id("frees").Op("=").Append(jen.Id("frees"), jen.Func().Params().Block(jen.Qual("C", "free").Call(jen.Id("buffer")))),
+				jen.List(jen.Id("slice").Dot("data"), jen.Id("slice").Dot("cap")).Op("=").List(jen.Id("buffer"), jen.Id("smokeTestBufferLen")),
+			),
+		),
+		jen.Id("code").Op(":=").Id("uint32").Call(jen.Id("f").Dot("Call").Call(jen.Id("args")).Index(jen.Lit(0)).Dot("Uint").Call()),
+		jen.If(jen.Id("code").Op("==").Lit(0).Op("&&").Id("wrapper").Dot("free").Op("!=").Nil()).Block(
+			jen.Var().Id("freed").Index().Qual("reflect", "Value"),
+			jen.For(jen.List(jen.Id("_"), jen.Id("i")).Op(":=").Range().Id("wrapper").Dot("freed")).Block(
+				jen.Id("freed").Op("=").Append(jen.Id("freed"), jen.Id("args").Index(jen.Id("i"))),
+			),
+			jen.Qual("reflect", "ValueOf").Call(jen.Id("wrapper").Dot("free")).Dot("Call").Call(jen.Id("freed")),
+		),
+		jen.Return(jen.Id("code")),
+	)
+
+	outFile.Comment("Runs a step of the smoke test, any panic fails it")
+	outFile.Func().Id("smokeTestRun").Params(jen.Id("name").String(), jen.Id("step").Func().Params().Uint32()).
+		Params(jen.Id("ok").Bool()).Block(
+		jen.Defer().Func().Params().Block(
+			jen.If(jen.Id("r").Op(":=").Recover(), jen.Id("r").Op("!=").Nil()).Block(
+				jen.Id("ok").Op("=").False(),
+				jen.Qual("fmt", "Println").Call(jen.Id("name"), jen.Lit("panic:"), jen.Id("r")),
+			),
+		).Call(),
+		jen.Id("code").Op(":=").Id("step").Call(),
+		jen.Qual("runtime", "GC").Call(),
+		jen.Qual("fmt", "Println").Call(jen.Id("name"), jen.Id("code")),
+		jen.Return(jen.True()),
+	)
+
+	outFile.Func().Id("init").Params().Block(
+		jen.For(jen.List(jen.Id("_"), jen.Id("helper")).Op(":=").Range().Id("smokeTestHelpers")).Block(
+			jen.Id("smokeTestHelpersByName").Index(jen.Id("helper").Dot("name")).Op("=").Id("helper"),
+		),
+		jen.Id("failed").Op(":=").Lit(0),
+		jen.For(jen.List(jen.Id("_"), jen.Id("helper")).Op(":=").Range().Id("smokeTestHelpers")).Block(
+			jen.Id("helper").Op(":=").Id("helper"),
+			jen.If(jen.Op("!").Id("smokeTestRun").Call(jen.Id("helper").Dot("name"), jen.Func().Params().Uint32().Block(
+				jen.Return(jen.Id("smokeTestRoundTrip").Call(jen.Id("helper"))),
+			))).Block(jen.Id("failed").Op("++")),
+		),
+		jen.For(jen.List(jen.Id("_"), jen.Id("wrapper")).Op(":=").Range().Id("smokeTestWrappers")).Block(
+			jen.Id("wrapper").Op(":=").Id("wrapper"),
+			jen.If(jen.Op("!").Id("smokeTestRun").Call(jen.Id("wrapper").Dot("name"), jen.Func().Params().Uint32().Block(
+				jen.Return(jen.Id("smokeTestCall").Call(jen.Id("wrapper"))),
+			))).Block(jen.Id("failed").Op("++")),
+		),
+		jen.Qual("os", "Exit").Call(jen.Id("failed")),
+	)
+	return outFile
+}
+
+// Builds and runs the smoke test of the wrappers in the directory of the output file under cgocheck=2
+func (g *Generator) verifyCgocheck(job *fileJob) error {
+	dir := filepath.Dir(job.outputFileGO)
+	smokeFile := filepath.Join(dir, smokeTestTag(job)+".go")
+	if err := g.generateSmokeTest(job).Save(smokeFile); err != nil {
+		return err
+	}
+	defer os.Remove(smokeFile)
+	tmpDir, err := ioutil.TempDir("", "cgogen")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binary := filepath.Join(tmpDir, "smoke")
+	build := exec.Command("go", "build", "-tags", smokeTestTag(job), "-o", binary, ".")
+	build.Dir = dir
+	build.Env = os.Environ()
+	run := exec.Command(binary)
+	run.Env = os.Environ()
+	if goVersionAtLeast(1, 21) {
+		// cgocheck=2 is a build experiment since Go 1.21
+		build.Env = append(build.Env, "GOEXPERIMENT=cgocheck2")
+	} else {
+		run.Env = append(run.Env, "GODEBUG=cgocheck=2")
+	}
+	if output, err := build.CombinedOutput(); err != nil {
+		return fmt.Errorf("building smoke test failed: %v\n%s", err, output)
+	}
+	output, err := run.CombinedOutput()
+	g.applog("Smoke test output:\n%s", output)
+	if err != nil {
+		return fmt.Errorf("smoke test failed under cgocheck=2: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// Returns whether the go tool is at least the version given
+func goVersionAtLeast(major int, minor int) bool {
+	output, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return false
+	}
+	version := strings.TrimPrefix(strings.TrimSpace(string(output)), "go")
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	goMajor, errMajor := strconv.Atoi(parts[0])
+	minorDigits := strings.FieldsFunc(parts[1], func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if len(minorDigits) == 0 {
+		return false
+	}
+	goMinor, errMinor := strconv.Atoi(minorDigits[0])
+	if errMajor != nil || errMinor != nil {
+		return false
+	}
+	return goMajor > major || (goMajor == major && goMinor >= minor)
+}
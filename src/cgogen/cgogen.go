@@ -0,0 +1,1749 @@
+package cgogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+var returnVarName = "____error_code"
+var returnErrName = "____return_err"
+
+//Processes the sources, saving their outputs
+func (g *Generator) doGoFiles(sources []Source) {
+	count := g.diagnosticsCount()
+	jobs := make([]*fileJob, 0, len(sources))
+	for _, source := range sources {
+		jobs = append(jobs, newFileJob(source.Path, source.OutputFileGO, source.OutputFileCH))
+	}
+	if g.cfg.ProcessDependencies {
+		g.loadDependencies()
+	}
+	g.indexTypes(sources)
+	if g.cfg.ManifestFile != "" && !g.cfg.Check {
+		g.hashInputs(jobs)
+	}
+	g.runFileJobs(jobs, g.cfg.Workers)
+	if g.cfg.ProcessTypes {
+		g.checkIncludeCycles(jobs)
+	}
+	if g.cfg.ProcessDependencies {
+		g.saveDependencies()
+	}
+	if g.cfg.CoverageFile != "" || g.cfg.CoverageTextFile != "" {
+		g.saveCoverageReport(jobs)
+	}
+	// Outputs of all the sources are saved before building them
+	for _, job := range jobs {
+		if !job.generated || g.cfg.Check {
+			continue
+		}
+		if job.outputFileGO != "" && g.cfg.VerifyCgocheck {
+			if err := g.verifyCgocheck(job); err != nil {
+				g.reportError("%s: %v", job.outputFileGO, err)
+			}
+		}
+	}
+	if g.cfg.Verify && !g.cfg.Check {
+		g.verifyBindings(jobs)
+	}
+	// Sources are regenerated until their diagnostics are fixed
+	if g.cfg.ManifestFile != "" && !g.cfg.Check && g.errorsSince(count) == nil {
+		for _, job := range jobs {
+			if job.generated {
+				g.updateManifest(g.cfg.ManifestFile, job)
+			}
+		}
+	}
+}
+
+func (g *Generator) doGoFile(job *fileJob) {
+	if g.cfg.ManifestFile != "" && !g.cfg.Check {
+		if g.isUpToDate(g.cfg.ManifestFile, job) {
+			g.applog("Skipping %v, unchanged since the last run", job.path)
+			return
+		}
+	}
+	if !g.generateFile(job, g.cfg.ProcessFunctions, g.cfg.ProcessTypes) {
+		return
+	}
+	if g.cfg.ProcessTypes {
+		if job.outputFileCH != "" {
+			g.saveOutput(job, job.outputFileCH, job.typesCode)
+		} else {
+			fmt.Println(job.typesCode)
+		}
+	}
+	if g.cfg.ProcessFunctions {
+		if job.outputFileGO != "" {
+			g.saveOutput(job, job.outputFileGO, job.goCode)
+		} else {
+			fmt.Print(job.goCode)
+		}
+	}
+	if job.layoutTestCode != "" && job.outputFileGO != "" {
+		g.saveOutput(job, layoutTestFileName(job.outputFileGO), job.layoutTestCode)
+	}
+	job.generated = true
+	g.applog("Finished %v", job.path)
+}
+
+//Generates the wrappers of the functions and the C types of the source file.
+//Returns false if the source file couldn't be parsed.
+func (g *Generator) generateFile(job *fileJob, processFunctions bool, processTypes bool) bool {
+	g.applog("Opening %v \n", job.path)
+	fo, err := os.Open(job.path)
+	if err != nil {
+		g.reportError("%v", err)
+		return false
+	}
+
+	defer fo.Close()
+
+	job.fset = token.NewFileSet()
+	fast, err := parser.ParseFile(job.fset, job.path, fo, parser.AllErrors|parser.ParseComments)
+	if err != nil {
+		g.reportParseError(err)
+		return false
+	}
+	g.startFileJob(fast, job)
+	defer g.finishFileJob(fast)
+	g.resolveAliases(fast)
+
+	packagePath := ""
+	if g.getPackagePathFromFilename {
+		packagePath = getPackagePathFromFileName(job.path) + "/" + fast.Name.Name
+		g.applog("Package Path: %s ", packagePath)
+	}
+	if packagePath == "" {
+		packagePath = fast.Name.Name
+	}
+
+	// Dependencies are shared by the sources, processed in order when analyzed
+	var dependantFunctions *[]string
+	dependantTypes := new([]string)
+	if g.cfg.ProcessDependencies {
+		dependantFunctions = &g.dependencies.functions
+		dependantTypes = &g.dependencies.types
+	}
+
+	var outFile *jen.File
+
+	if processFunctions {
+		outFile = jen.NewFile("main")
+
+		outFile.CgoPreamble(`
+	  #include <string.h>
+	  #include <stdlib.h>
+	  
+	  #include "` + g.includePrefix + `types.h"`)
+	}
+
+	typeDefs := make([]*ast.GenDecl, 0)
+
+	// Imports are needed to resolve the types of the wrappers
+	for _, _decl := range fast.Decls {
+		if decl, ok := (_decl).(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			job.importDefs = append(job.importDefs, decl)
+		}
+	}
+	for _, _decl := range fast.Decls {
+
+		if processFunctions {
+			if decl, ok := (_decl).(*ast.FuncDecl); ok {
+
+				var plist *[]string
+				if g.cfg.ProcessDependencies {
+					plist = dependantTypes
+				}
+				if isDependant := g.processFunc(fast, decl, outFile, plist); isDependant && dependantFunctions != nil {
+					addDependant(dependantFunctions, packagePath+" "+decl.Name.Name)
+				}
+			}
+		}
+		if processTypes {
+			if decl, ok := (_decl).(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+				typeDefs = append(typeDefs, decl)
+			}
+		}
+	}
+	if processTypes {
+		job.includes = g.typeDeclsHeaders(fast, job, typeDefs)
+		typesCode, typeSpecs := g.processTypeDefs(fast, typeDefs, dependantTypes)
+		if typesCode != "" {
+			header := "#pragma once\n"
+			if strings.Contains(typesCode, "offsetof(") {
+				header += "#include <stddef.h>\n"
+			}
+			job.typesCode = header + includeDirectives(job, job.includes) + typesCode
+		}
+		if processFunctions && g.cfg.LayoutTest && g.addLayoutChecks(fast, outFile, typeSpecs) {
+			if text, err := g.renderGoFile(generateLayoutTest(job)); err == nil {
+				job.layoutTestCode = text
+			} else {
+				g.reportError("%s: %v", job.path, err)
+			}
+		}
+	}
+	if processFunctions {
+		if text, err := g.renderGoFile(outFile); err == nil {
+			job.goCode = text
+		} else {
+			g.reportError("%s: %v", job.path, err)
+		}
+	}
+	return true
+}
+
+func (g *Generator) doFullTranspile() {
+	if g.cfg.FullTranspileDir == "" {
+		g.reportError("Must specify full transpile source directory")
+		return
+	}
+	if g.cfg.FullTranspileOut == "" {
+		g.reportError("Must specify full transpile destination directory")
+		return
+	}
+	files := g.transpile(g.cfg.FullTranspileDir)
+	if !g.cfg.Check {
+		g.cleanDir(g.cfg.FullTranspileOut)
+	}
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		g.saveTextToFile(filepath.Join(g.cfg.FullTranspileOut, fileName), files[fileName])
+	}
+}
+
+//Saves text to the file unless it already has that content, so its modification time is kept.
+//In check mode the text is only compared with the file.
+func (g *Generator) saveTextToFile(fileName string, text string) {
+	if g.cfg.Check {
+		g.checkOutput(fileName, text)
+		return
+	}
+	if current, err := ioutil.ReadFile(fileName); err == nil && string(current) == text {
+		g.applog("Unchanged %s", fileName)
+		return
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		g.reportError("%v", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.WriteString(text); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		g.reportError("%v", err)
+	}
+}
+
+func (g *Generator) saveDependencyFile(path string, list []string, separator string) {
+	g.saveTextToFile(path, strings.Join(list, separator))
+}
+
+func (g *Generator) loadDependencyFile(path string, separator string) (list []string) {
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		buf := new(bytes.Buffer)
+		if _, err = buf.ReadFrom(f); err != nil {
+			g.reportError("%v", err)
+			return
+		}
+		contents := buf.String()
+		tlist := strings.Split(contents, separator)
+		for _, str := range tlist {
+			nstr := strings.Replace(str, "\r", "", -1)
+			nstr = strings.Replace(nstr, "\n", "", -1)
+			if nstr != "" {
+				list = append(list, nstr)
+			}
+		}
+	}
+	return
+}
+
+func isAsciiUpper(c rune) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+//Returns the path of the package imported
+func (g *Generator) findImportPath(fast *ast.File, importName string) (string, bool) {
+	for _, importDef := range g.jobOf(fast).importDefs {
+		for _, s := range importDef.Specs {
+			if importSpec, isImportSpec := (s).(*ast.ImportSpec); isImportSpec {
+				name := ""
+				path := importSpec.Path.Value
+
+				path = strings.TrimPrefix(path, "\"")
+
+				path = strings.TrimSuffix(path, "\"")
+
+				if importSpec.Name != nil {
+					name = importSpec.Name.Name
+				} else {
+					pathParts := strings.Split(path, "/")
+					if len(pathParts) > 0 {
+						name = pathParts[len(pathParts)-1]
+					}
+				}
+				if name == importName {
+					return path, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func (g *Generator) isLibName(fast *ast.File, importName string) bool {
+	path, result := g.findImportPath(fast, importName)
+	if result {
+		return strings.HasPrefix(path, g.packagePath)
+	} else {
+		return false
+	}
+}
+
+func (g *Generator) isExternalName(fast *ast.File, importName string) bool {
+	path, result := g.findImportPath(fast, importName)
+	if result {
+		return strings.HasPrefix(path, "github.com/") || strings.HasPrefix(path, "golang.org/")
+	} else {
+		return false
+	}
+}
+
+func (g *Generator) typeSpecStr(fast *ast.File, _typeExpr *ast.Expr, packageName string, isOutput bool) (string, bool) {
+	addPointer := false
+	spec := ""
+	if isContextType(fast, *_typeExpr) {
+		if isOutput {
+			return "", false
+		}
+		return "C." + contextHandleType, true
+	}
+	for _typeExpr != nil {
+		if converter := g.findConverter(fast, *_typeExpr); converter != nil {
+			return "*C." + converter.CType, true
+		}
+		if arrayExpr, isArray := (*_typeExpr).(*ast.ArrayType); isArray {
+			if arrayExpr.Len != nil || isOutput {
+				return "*C.GoSlice_", true
+			} else {
+				spec += "[]"
+				_typeExpr = &arrayExpr.Elt
+				continue
+			}
+		}
+		if starExpr, isStar := (*_typeExpr).(*ast.StarExpr); isStar {
+			spec += "*"
+			_typeExpr = &starExpr.X
+			continue
+		}
+		if ellipsisExpr, isEllipsis := (*_typeExpr).(*ast.Ellipsis); isEllipsis {
+			tspec, ok := g.typeSpecStr(fast, &ellipsisExpr.Elt, packageName, isOutput)
+			if ok {
+				spec += "..." + tspec
+				_typeExpr = nil
+				continue
+			} else {
+				return "", false
+			}
+		}
+		if _, isFunc := (*_typeExpr).(*ast.FuncType); isFunc {
+			return "", false
+		}
+		if _, isStruct := (*_typeExpr).(*ast.StructType); isStruct {
+			spec += "struct{}"
+			_typeExpr = nil
+			continue
+		}
+		if _, isIntf := (*_typeExpr).(*ast.InterfaceType); isIntf {
+			return "", false
+		}
+		if _, isChan := (*_typeExpr).(*ast.ChanType); isChan {
+			// TODO: Improve func type translation
+			spec += "C.GoChan_"
+			_typeExpr = nil
+			continue
+		}
+		if mapExpr, isMap := (*_typeExpr).(*ast.MapType); isMap {
+			tspeckey, okkey := g.typeSpecStr(fast, &mapExpr.Key, packageName, false)
+			tspecvalue, okvalue := g.typeSpecStr(fast, &mapExpr.Key, packageName, false)
+			if okkey && okvalue {
+				return spec + "map[" + tspeckey + "]" + tspecvalue, true
+			} else {
+				return "", false
+			}
+		}
+		identExpr, isIdent := (*_typeExpr).(*ast.Ident)
+		selExpr, isSelector := (*_typeExpr).(*ast.SelectorExpr)
+		if isIdent || isSelector {
+			isDealt := false
+			externPackage := packageName
+			typeName := ""
+			if isIdent {
+				typeName = identExpr.Name
+				isDealt = g.isInHandleTypesList(typeName)
+				if isDealt {
+					spec = g.getHandleName(typeName)
+				} else if g.isInCustomTypesList(typeName) {
+					spec = g.getCustomTypeName(typeName)
+					isDealt = true
+				}
+			} else {
+				typeName = selExpr.Sel.Name
+				identSelExpr, isSelIdent := (selExpr.X).(*ast.Ident)
+				if isUnsafePointer(selExpr) {
+					return spec + "unsafe.Pointer", true
+				}
+				if isSelIdent {
+					externPackage = identSelExpr.Name
+					isDealt = g.isInHandleTypesList(externPackage + "." + typeName)
+					if isDealt {
+						spec = g.getHandleName(externPackage + "." + typeName)
+					} else if g.isInCustomTypesList(externPackage + "." + typeName) {
+						spec = g.getCustomTypeName(externPackage + "." + typeName)
+						isDealt = true
+					} else if basicType, isBasic := g.externalBasicType(fast, selExpr); isBasic {
+						//Passed as a pointer to its basic type, as named types of the library
+						if spec == "" && !addPointer {
+							addPointer = true
+						}
+						cType, _ := GetCTypeFromGoType(basicType)
+						spec += "C." + cType
+						isDealt = true
+					} else if !g.isLibName(fast, externPackage) {
+						return externPackage, false
+					}
+				}
+			}
+			if !isDealt {
+				if g.isInHandleTypesList(externPackage + packageSeparator + typeName) {
+					spec = g.getHandleName(externPackage + packageSeparator + typeName)
+				} else if g.isInCustomTypesList(externPackage + packageSeparator + typeName) {
+					spec = g.getCustomTypeName(externPackage + packageSeparator + typeName)
+				} else {
+					isExported := isAsciiUpper(rune(typeName[0]))
+					if spec == "" && !addPointer && isExported {
+						addPointer = true
+					}
+					if isExported {
+						spec += "C." + externPackage + packageSeparator
+					} else {
+						if !IsBasicGoType(typeName) {
+							return "", false //Don't deal with unexported types
+						}
+					}
+					spec += typeName
+				}
+			}
+			_typeExpr = nil
+		} else {
+			g.applog("No rules to follow with %s", (*_typeExpr).(*ast.Ident))
+			_typeExpr = nil
+		}
+	}
+	if addPointer {
+		return "*" + spec, true
+	}
+	return spec, true
+}
+
+func argName(name string) string {
+	return "_" + name
+}
+
+func resultName(name string) string {
+	return "__" + name
+}
+
+func (g *Generator) isInHandleTypesList(typeName string) bool {
+	_, ok := g.handleTypes[typeName]
+	return ok
+}
+
+func (g *Generator) isInCustomTypesList(typeName string) bool {
+	_, ok := g.customTypesMap[typeName]
+	return ok
+}
+
+func (g *Generator) getHandleName(typeName string) string {
+	return "*C." + g.handleTypes[typeName] + packageSeparator + "Handle"
+}
+
+func (g *Generator) getSliceName(typeName string) string {
+	return g.arrayTypes[typeName] + "__" + typeName
+}
+
+func (g *Generator) getCustomTypeName(typeName string) string {
+	return "*C." + g.customTypesMap[typeName]
+}
+
+/*
+Get the package path from file name. Assumes that file is formed by joining path folders with dot
+Example: pack.folder1.folder2  ==>  pack/folder1/folder2
+*/
+func getPackagePathFromFileName(filePath string) string {
+	packagePath := ""
+	folders := strings.Split(filePath, "/")
+	if len(folders) > 0 {
+		fileName := folders[len(folders)-1]
+		packageFolders := strings.Split(fileName, ".")
+		if len(packageFolders) > 2 {
+			packageFolders = packageFolders[:len(packageFolders)-2]
+			var result []string
+			for _, s := range packageFolders {
+				if s == "internal" || s == "example" {
+					break
+				} else {
+					result = append(result, s)
+				}
+			}
+			packagePath = strings.Join(result, "/")
+		}
+	}
+	return packagePath
+}
+
+//Returns the import path of the package being wrapped
+func (g *Generator) wrappedPackageImportPath(fast *ast.File) string {
+	path := ""
+	if g.getPackagePathFromFilename {
+		path = g.jobOf(fast).path
+	}
+	return g.sourceImportPath(path, fast.Name.Name)
+}
+
+//Returns the import path of the package of a source file
+func (g *Generator) sourceImportPath(path string, packageName string) string {
+	if g.cfg.ImportPath != "" {
+		return g.cfg.ImportPath
+	}
+	packagePath := ""
+	if g.getPackagePathFromFilename {
+		packagePath = getPackagePathFromFileName(path)
+	}
+	if packagePath == "" {
+		packagePath = packageName
+	}
+	return g.mainPackagePath + packagePath
+}
+
+//Returns the import path of the package of a file, wrapped or parsed to resolve types
+func (g *Generator) packageImportPath(fast *ast.File) string {
+	if g.jobOf(fast) != nil {
+		return g.wrappedPackageImportPath(fast)
+	}
+	g.constPackagesLock.Lock()
+	defer g.constPackagesLock.Unlock()
+	if p, found := g.filePackages[fast]; found {
+		return p.importPath
+	}
+	return fast.Name.Name
+}
+
+//Create code for wrapper function
+func (g *Generator) processFunc(fast *ast.File, fdecl *ast.FuncDecl, outFile *jen.File, dependantTypes *[]string) (isDependant bool) {
+	isDependant = false
+
+	funcName := fdecl.Name.Name
+
+	if !fdecl.Name.IsExported() || strings.HasPrefix(funcName, "Must") {
+		g.applog("Skipping %v \n", funcName)
+		if fdecl.Name.IsExported() {
+			g.recordFuncCoverage(fast, fdecl, coverageEntry{Reason: "functions with the Must prefix panic on failure"})
+		}
+		return
+	}
+
+	if field, found := g.findPointerRulesViolation(fast, fdecl); found {
+		g.reportWarningAt(fast, field, "%s not wrapped, type %s can't be passed without breaking cgo pointer rules",
+			funcName, types.ExprString(field.Type))
+		g.recordFuncCoverage(fast, fdecl, coverageEntry{
+			Reason:    "can't be passed without breaking cgo pointer rules",
+			Offending: describeField(fdecl, field),
+		})
+		return
+	}
+	if field, found := findContextResult(fast, fdecl); found {
+		g.reportWarningAt(fast, field, "%s not wrapped, contexts can't be returned to C", funcName)
+		g.recordFuncCoverage(fast, fdecl, coverageEntry{
+			Reason:    "contexts can't be returned",
+			Offending: describeField(fdecl, field),
+		})
+		return
+	}
+	coverage := coverageEntry{Wrapped: true}
+	job := g.jobOf(fast)
+	job.allocatedOutputs = nil
+	job.inputHelpers = make(map[string]string)
+
+	g.applog("Processing %v \n", funcName)
+	var blockParams []jen.Code
+
+	var params jen.Statement
+	var wrapperParams []wrapperParam
+	var validateCode []jen.Code
+	var isPointerRecv bool
+	var copyBackCode []jen.Code
+	if receiver := fdecl.Recv; receiver != nil {
+		// Method
+		_type := &receiver.List[0].Type
+		typeName := ""
+		if starExpr, _isPointerRecv := (*_type).(*ast.StarExpr); _isPointerRecv {
+			_type = &starExpr.X
+			isPointerRecv = _isPointerRecv
+		}
+		if identExpr, isIdent := (*_type).(*ast.Ident); isIdent {
+			typeName = identExpr.Name
+		}
+		recvParamName := receiver.List[0].Names[0].Name
+		recvParam := jen.Id(argName(recvParamName))
+		typeSpec, ok := g.typeSpecStr(fast, _type, fast.Name.Name, false)
+		if !ok || isTypeSpecInDependantList(typeSpec, dependantTypes) {
+			isDependant = true
+			g.setDependant(&coverage, fast, fdecl, receiver.List[0], ok, false)
+			if g.cfg.IgnoreDependants {
+				//TODO: stdevEclipse Check if type can be replaced by another type or handle
+				coverage.Wrapped = false
+				g.recordFuncCoverage(fast, fdecl, coverage)
+				return
+			}
+		}
+		recvParam = recvParam.Id(typeSpec)
+		params = append(params, recvParam)
+		wrapperParams = append(wrapperParams, wrapperParam{argName(recvParamName), typeSpec, false,
+			g.checksNullArgument(fast, receiver.List[0].Type, typeSpec)})
+		validateCode = append(validateCode,
+			g.getValidateInParameterCode(fast, receiver.List[0].Type, argName(recvParamName), typeSpec)...)
+		funcName = typeName + "_" + funcName
+		convertCodes := g.getCodeToConvertInParameter(fast, _type, fast.Name.Name, recvParamName, isPointerRecv, outFile)
+		if convertCodes != nil {
+			blockParams = append(blockParams, convertCodes...)
+		}
+		if isPointerRecv && g.copiesBack(fast, *_type) {
+			copyBackCode = append(copyBackCode, g.getDeepCopyBackCode(fast, *_type, recvParamName, outFile)...)
+		}
+	}
+
+	allparams := fdecl.Type.Params.List[:]
+	returnFieldsIndex := len(allparams)
+	var retField *ast.Field = nil
+
+	if fdecl.Type.Results != nil && fdecl.Type.Results.List != nil {
+		//Find the return argument of type error.
+		//It should always be the last argument but search just in case
+		errorIndex := -1
+		for index, field := range fdecl.Type.Results.List {
+			identExpr, isIdent := (field.Type).(*ast.Ident)
+			if isIdent && identExpr.Name == "error" {
+				errorIndex = index
+				break
+			}
+		}
+		if errorIndex >= 0 {
+			retField = fdecl.Type.Results.List[errorIndex]
+			returnParams := append(fdecl.Type.Results.List[0:errorIndex], fdecl.Type.Results.List[errorIndex+1:]...)
+			allparams = append(allparams, returnParams...)
+		} else {
+			allparams = append(allparams, fdecl.Type.Results.List[:]...)
+		}
+	}
+
+	var outputVarsConvertCode []jen.Code
+
+	for fieldIdx, field := range allparams {
+		if fieldIdx >= returnFieldsIndex {
+			// Field in return types list
+			typeName, ok := g.typeSpecStr(fast, &field.Type, fast.Name.Name, true)
+			if !ok || isTypeSpecInDependantList(typeName, dependantTypes) {
+				isDependant = true
+				g.setDependant(&coverage, fast, fdecl, field, ok, true)
+				if g.cfg.IgnoreDependants {
+					//TODO: stdevEclipse Check if type can be replaced by another type or handle
+					coverage.Wrapped = false
+					g.recordFuncCoverage(fast, fdecl, coverage)
+					return
+				}
+			}
+			if arrayExpr, isArray := (field.Type).(*ast.ArrayType); isArray && g.needsDeepConversion(fast, arrayExpr) {
+				typeName = "*C." + g.addSliceCType(fast, arrayExpr, outFile)
+			} else if len(typeName) > 0 && rune(typeName[0]) == '[' {
+				typeName = "*C.GoSlice_"
+			} else if g.dealOutStringAsGostring && typeName == "string" {
+				typeName = "*C.GoString_"
+			} else if IsBasicGoType(typeName) {
+				typeName = "*" + typeName
+			} else if typeName == "map[string]string" {
+				typeName = "*C.GoStringMap_"
+			}
+			paramName := argName("arg" + fmt.Sprintf("%d", fieldIdx))
+			params = append(params, jen.Id(paramName).Id(typeName))
+			wrapperParams = append(wrapperParams, wrapperParam{paramName, typeName, true, true})
+			validateCode = append(validateCode, g.getNullArgumentCheckCode(paramName))
+			convertCode := g.getCodeToConvertOutParameter(fast, &field.Type, fast.Name.Name, paramName, false, outFile)
+			if convertCode != nil {
+				outputVarsConvertCode = append(outputVarsConvertCode, convertCode)
+			}
+
+		} else {
+			lastNameIdx := len(field.Names) - 1
+			firstParamIdx := len(wrapperParams)
+			for nameIdx, ident := range field.Names {
+				wrapperParams = append(wrapperParams, wrapperParam{argName(ident.Name), "", false, false})
+				if nameIdx != lastNameIdx {
+					params = append(params, jen.Id(argName(ident.Name)))
+				} else {
+					typeName, ok := g.typeSpecStr(fast, &field.Type, fast.Name.Name, false)
+					if !ok || isTypeSpecInDependantList(typeName, dependantTypes) {
+						isDependant = true
+						g.setDependant(&coverage, fast, fdecl, field, ok, false)
+						if g.cfg.IgnoreDependants {
+							//TODO: stdevEclipse Check if type can be replaced by another type or handle
+							coverage.Wrapped = false
+							g.recordFuncCoverage(fast, fdecl, coverage)
+							return
+						}
+					}
+					if arrayExpr, isArray := (field.Type).(*ast.ArrayType); isArray && g.needsDeepConversion(fast, arrayExpr) {
+						typeName = "C." + g.addSliceCType(fast, arrayExpr, outFile)
+					}
+					params = append(params, jen.Id(
+						argName(ident.Name)).Id(typeName))
+					for i := firstParamIdx; i < len(wrapperParams); i++ {
+						wrapperParams[i].typeName = typeName
+						wrapperParams[i].checksNull = g.checksNullArgument(fast, field.Type, typeName)
+						validateCode = append(validateCode,
+							g.getValidateInParameterCode(fast, field.Type, wrapperParams[i].name, typeName)...)
+					}
+				}
+				convertCodes := g.getCodeToConvertInParameter(fast, &field.Type, fast.Name.Name, ident.Name, false, outFile)
+				if convertCodes != nil {
+					blockParams = append(blockParams, convertCodes...)
+				}
+				if starExpr, isStar := (field.Type).(*ast.StarExpr); isStar && g.copiesBack(fast, starExpr.X) {
+					copyBackCode = append(copyBackCode, g.getDeepCopyBackCode(fast, starExpr.X, ident.Name, outFile)...)
+				}
+			}
+		}
+	}
+
+	cfuncName := g.functionPrefix + "_" + fast.Name.Name + "_" + funcName
+	if len(job.allocatedOutputs) > 0 {
+		outFile.Comment("Outputs are allocated with calloc, strings with malloc, free them with " + cfuncName + "_Free")
+	}
+	if updated := g.updatedInPlace(fast, wrapperParams); len(updated) > 0 {
+		outFile.Comment(strings.Join(updated, ", ") + " updated in place: the C memory held is freed and replaced with outputs,")
+		outFile.Comment("only pass memory allocated with calloc or malloc, such as outputs of the library")
+	}
+	stmt := outFile.Comment("export " + cfuncName) //nolint staticcheck
+	stmt = outFile.Func().Id(cfuncName)
+	stmt = stmt.Params(params...)
+
+	var callparams []jen.Code
+	for _, field := range fdecl.Type.Params.List {
+		for _, name := range field.Names {
+			callparams = append(callparams, *jen.Id(name.Name)...)
+		}
+	}
+	var retvars []jen.Code
+	if returnFieldsIndex < len(allparams) {
+		for i := returnFieldsIndex; i < len(allparams); i++ {
+			retvars = append(retvars, jen.Id(resultName("arg"+fmt.Sprintf("%d", i))))
+		}
+	}
+	if retField != nil {
+		retvars = append(retvars, jen.Id(returnErrName))
+	}
+	var callFuncCode jen.Code
+	if len(retvars) > 0 {
+		if fdecl.Recv != nil {
+			callFuncCode =
+				jen.List(retvars...).Op(":=").Id(fdecl.Recv.List[0].Names[0].Name).Dot(fdecl.Name.Name).Call(callparams...)
+		} else {
+			if g.mainPackagePath != "" {
+				callFuncCode =
+					jen.List(retvars...).Op(":=").Qual(g.wrappedPackageImportPath(fast),
+						fdecl.Name.Name).Call(callparams...)
+			} else {
+				callFuncCode =
+					jen.List(retvars...).Op(":=").Id(fdecl.Name.Name).Call(callparams...)
+			}
+		}
+	} else {
+		if fdecl.Recv != nil {
+			callFuncCode = jen.Id(fdecl.Recv.List[0].Names[0].Name).Dot(fdecl.Name.Name).Call(callparams...)
+		} else {
+			if g.mainPackagePath != "" {
+				callFuncCode = jen.Qual(g.wrappedPackageImportPath(fast),
+					fdecl.Name.Name).Call(callparams...)
+			} else {
+				callFuncCode = jen.Id(fdecl.Name.Name).Call(callparams...)
+			}
+		}
+	}
+	blockParams = append(blockParams, callFuncCode)
+
+	stmt = stmt.Parens(jen.Id(returnVarName).Id("uint32"))
+	outputVarsConvertCode = append(copyBackCode, outputVarsConvertCode...)
+	if retField != nil {
+		blockParams = append(blockParams, jen.Id(returnVarName).Op("=").Id("libErrorCode").Call(jen.Id(returnErrName)))
+		convertOutputCode := jen.If(jen.Id(returnErrName).Op("==").Nil()).Block(outputVarsConvertCode...)
+		blockParams = append(blockParams, convertOutputCode)
+	} else {
+		blockParams = append(blockParams, outputVarsConvertCode...)
+	}
+
+	blockParams = append(blockParams, jen.Return())
+
+	stmt.Block(append(validateCode, blockParams...)...)
+	wrapper := exportedWrapper{name: cfuncName, params: wrapperParams, inputHelpers: job.inputHelpers,
+		smoke: g.isSmokeFunction(fast.Name.Name, funcName)}
+	if len(job.allocatedOutputs) > 0 {
+		g.addFreeOutputsFunc(fast, outFile, cfuncName, wrapperParams)
+		wrapper.free = cfuncName + "_Free"
+		wrapper.freeParams = g.allocatedParams(fast, wrapperParams)
+	}
+	job.wrappers = append(job.wrappers, wrapper)
+	coverage.Symbol = cfuncName
+	g.recordFuncCoverage(fast, fdecl, coverage)
+	if g.isAsyncFunction(fast.Name.Name, funcName) {
+		g.addAsyncWrapper(fast, fdecl, outFile, cfuncName, wrapperParams)
+	}
+	return
+}
+
+//Check if type is in dependant list
+func isTypeSpecInDependantList(typeSpec string, dependantList *[]string) bool {
+	if dependantList == nil {
+		return false
+	}
+	//Do not allow extern types in function parameters
+	if strings.Contains(typeSpec, "C._") {
+		return true
+	}
+	for _, t := range *dependantList {
+		if strings.HasSuffix(typeSpec, "C."+t) {
+			return true
+		}
+	}
+	return false
+}
+
+//Creates code to make a typecast
+//nolint unparam
+func (g *Generator) getTypeCastCode(fast *ast.File, leftPart *jen.Statement, typeExpr *ast.Expr,
+	packName string, name string, outFile *jen.File) jen.Code {
+	if identExpr, isIdent := (*typeExpr).(*ast.Ident); isIdent {
+		typeName := identExpr.Name
+		if IsBasicGoType(typeName) {
+			return leftPart.Id(identExpr.Name)
+		} else {
+			return leftPart.Id(packName).Dot(typeName)
+		}
+	} else if selectorExpr, isSelector := (*typeExpr).(*ast.SelectorExpr); isSelector {
+		if identExpr, isIdent := (selectorExpr.X).(*ast.Ident); isIdent {
+			externPackage, found := g.findImportPath(fast, identExpr.Name)
+			typeName := selectorExpr.Sel.Name
+			if found {
+				outFile.ImportAlias(externPackage, identExpr.Name)
+				return leftPart.Qual(externPackage, typeName)
+			} else {
+				return leftPart.Id(identExpr.Name).Dot(typeName)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Generator) getLookupHandleCode(name string, typeName string, isPointer bool) []jen.Code {
+	varname := name
+	if !isPointer {
+		varname = "__" + name
+	}
+	listVar := jen.List(jen.Id(varname), jen.Id("ok"+name)).Op(":=")
+	lookUpName := "lookup" + g.handleTypes[typeName] + "Handle"
+	listVar = listVar.Id(lookUpName).Call(jen.Op("*").Id(argName(name)))
+	checkError := jen.If(jen.Op("!").Id("ok"+name)).
+		Block(jen.Id(returnVarName).Op("=").Id(g.functionPrefix+"_BAD_HANDLE"), jen.Return())
+	if !isPointer {
+		assign := jen.Id(name).Op(":=").Op("*").Id(varname)
+		return jenCodeToArray(listVar, checkError, assign)
+	} else {
+		return jenCodeToArray(listVar, checkError)
+	}
+}
+
+func jenCodeToArray(statements ...jen.Code) []jen.Code {
+	var codeArray []jen.Code
+	codeArray = append(codeArray, statements...)
+	return codeArray
+}
+
+/*Returns jen code to convert an input parameter from wrapper to original function*/
+func (g *Generator) getCodeToConvertInParameter(fast *ast.File, _typeExpr *ast.Expr, packName string, name string, isPointer bool, outFile *jen.File) []jen.Code {
+	leftPart := jen.Id(name).Op(":=")
+	if isContextType(fast, *_typeExpr) {
+		g.addContextHandleType(fast, outFile)
+		return g.getContextParameterCode(name)
+	}
+	if g.findConverter(fast, *_typeExpr) != nil {
+		return g.getDeepConvertInParameterCode(fast, *_typeExpr, name, isPointer, outFile)
+	}
+	if arrayExpr, isArray := (*_typeExpr).(*ast.ArrayType); isArray && arrayExpr.Len == nil &&
+		!isPointer && g.needsDeepConversion(fast, arrayExpr) {
+		return g.getDeepConvertInParameterCode(fast, arrayExpr, name, isPointer, outFile)
+	} else if isArray {
+		typeExpr := arrayExpr.Elt
+		arrayLen := ""
+		if arrayExpr.Len != nil {
+			var ok bool
+			arrayLen, ok = g.evalArrayLen(fast, arrayExpr.Len)
+			if !ok {
+				g.applog("Couldn't evaluate length of array parameter %s", name)
+				return nil
+			}
+		}
+		arrayPart := jen.Op("*").Op("[" + arrayLen + "]")
+		arrayTypeCode := g.getTypeCastCode(fast, arrayPart, &typeExpr, packName, name, outFile)
+		if arrayTypeCode != nil {
+			if !isPointer {
+				leftPart = leftPart.Op("*")
+			}
+			leftPart = leftPart.Parens(arrayTypeCode)
+			var argCode jen.Code
+			if arrayExpr.Len != nil {
+				// Fixed size arrays are passed as GoSlice_
+				argCode = jen.Id(argName(name)).Dot("data")
+			} else if !isPointer {
+				argCode = jen.Op("&").Id(argName(name))
+			} else {
+				argCode = jen.Id(argName(name))
+			}
+			rightCode := jen.Qual("unsafe", "Pointer").Parens(argCode)
+			leftPart = leftPart.Parens(rightCode)
+			return jenCodeToArray(leftPart)
+		}
+	} else if starExpr, isPointerParam := (*_typeExpr).(*ast.StarExpr); isPointerParam {
+		_type := &starExpr.X
+		return g.getCodeToConvertInParameter(fast, _type, packName, name, true, outFile)
+	} else if identExpr, isIdent := (*_typeExpr).(*ast.Ident); isIdent {
+		typeName := identExpr.Name
+		if IsBasicGoType(typeName) {
+			return jenCodeToArray(leftPart.Id(argName(name)))
+		} else if g.isInHandleTypesList(typeName) {
+			return g.getLookupHandleCode(name, typeName, isPointer)
+		} else if g.isInplaceConvertType(typeName) {
+			if !isPointer {
+				leftPart = leftPart.Op("*")
+			}
+			return jenCodeToArray(leftPart.Id("inplace" + typeName).Call(jen.Id(argName(name))))
+		} else if g.needsDeepConversion(fast, identExpr) {
+			return g.getDeepConvertInParameterCode(fast, identExpr, name, isPointer, outFile)
+		} else {
+			if g.isInHandleTypesList(packName + packageSeparator + typeName) {
+				return g.getLookupHandleCode(name, packName+packageSeparator+typeName, isPointer)
+			} else {
+				if !isPointer {
+					leftPart = leftPart.Op("*")
+				}
+				leftPart = leftPart.Parens(jen.Op("*").Id(packName).Id(".").Id(typeName)).
+					Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Id(argName(name))))
+				return jenCodeToArray(leftPart)
+			}
+		}
+	} else if selectorExpr, isSelector := (*_typeExpr).(*ast.SelectorExpr); isSelector {
+		if isUnsafePointer(selectorExpr) {
+			return jenCodeToArray(leftPart.Qual("unsafe", "Pointer").Call(jen.Id(argName(name))))
+		}
+		if identExpr, isIdent := (selectorExpr.X).(*ast.Ident); isIdent {
+			packName = identExpr.Name
+			typeName := selectorExpr.Sel.Name
+			if g.isInHandleTypesList(packName + packageSeparator + typeName) {
+				return g.getLookupHandleCode(name, packName+packageSeparator+typeName, isPointer)
+			}
+		}
+		if !isPointer {
+			leftPart = leftPart.Op("*")
+		}
+		typeCastCode := g.getTypeCastCode(fast, jen.Op("*"), _typeExpr, packName, name, outFile)
+		return jenCodeToArray(leftPart.Parens(typeCastCode).
+			Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Id(argName(name)))))
+	} else if _, isEllipsis := (*_typeExpr).(*ast.Ellipsis); isEllipsis {
+		//TODO: stdevEclipse Implement
+		return jenCodeToArray(leftPart.Id(argName(name)))
+	} else if _, isIntf := (*_typeExpr).(*ast.InterfaceType); isIntf {
+		return jenCodeToArray(leftPart.Id("convertToInterface").Call(jen.Id(argName(name))))
+	} else if _, isFunc := (*_typeExpr).(*ast.FuncType); isFunc {
+		return jenCodeToArray(leftPart.Id("copyToFunc").Call(jen.Id(argName(name))))
+	}
+	return nil
+}
+
+/*Returns jen Code to convert an output parameter from original to wrapper function*/
+func (g *Generator) getCodeToConvertOutParameter(fast *ast.File, _typeExpr *ast.Expr, packageName string, name string,
+	isPointer bool, outFile *jen.File) jen.Code {
+
+	if g.findConverter(fast, *_typeExpr) != nil {
+		return g.getDeepConvertOutParameterCode(fast, *_typeExpr, name, isPointer, outFile)
+	}
+	if _, isArray := (*_typeExpr).(*ast.ArrayType); isArray {
+		if !isPointer && g.needsDeepConversion(fast, *_typeExpr) {
+			return g.getDeepConvertOutParameterCode(fast, *_typeExpr, name, isPointer, outFile)
+		}
+		return jen.Id("copyToGoSlice").Call(jen.Qual("reflect", "ValueOf").Call(jen.Id(argName(name))),
+			jen.Id(name))
+	} else if starExpr, isPointerRecv := (*_typeExpr).(*ast.StarExpr); isPointerRecv {
+		_type := &starExpr.X
+		return g.getCodeToConvertOutParameter(fast, _type, packageName, name, true, outFile)
+	} else if identExpr, isIdent := (*_typeExpr).(*ast.Ident); isIdent {
+		typeName := identExpr.Name
+		if g.isLibArrayType(typeName, packageName) {
+			return jen.Id("copyTo"+g.getSliceName(typeName)).Call(jen.Qual("reflect", "ValueOf").Call(jen.Id(argName(name))),
+				jen.Id(name))
+		}
+		if g.needsDeepConversion(fast, identExpr) {
+			return g.getDeepConvertOutParameterCode(fast, identExpr, name, isPointer, outFile)
+		}
+		if g.dealOutStringAsGostring && typeName == "string" {
+			return jen.Id("copyString").Call(jen.Id(argName(name)), jen.Id(name))
+		} else if IsBasicGoType(typeName) {
+			return jen.Op("*").Id(name).Op("=").Id(argName(name))
+		} else if g.isInHandleTypesList(packageName + packageSeparator + typeName) {
+			var argCode jen.Code
+			if isPointer {
+				argCode = jen.Id(argName(name))
+			} else {
+				argCode = jen.Op("&").Id(argName(name))
+			}
+			return jen.Op("*").Id(name).Op("=").Id("register" + g.handleTypes[packageName+packageSeparator+typeName] + "Handle").Call(argCode)
+		} else if g.isLibArrayType(typeName, packageName) {
+			var argCode jen.Code
+			if isPointer {
+				argCode = jen.Parens(jen.Op("*").Id(argName(name))).Op("[:]")
+			} else {
+				argCode = jen.Id(argName(name)).Op("[:]")
+			}
+
+			return jen.Id("copyToBuffer").Call(jen.Qual("reflect", "ValueOf").Call(argCode),
+				jen.Qual("unsafe", "Pointer").Call(jen.Id(name)),
+				jen.Id("uint").Parens(jen.Id("Sizeof"+typeName)))
+
+		} else {
+			var argCode jen.Code
+			if isPointer {
+				argCode = jen.Id(argName(name))
+			} else {
+				argCode = jen.Op("&").Id(argName(name))
+			}
+			return jen.Op("*").Id(name).Op("=").Op("*").Parens(jen.Op("*").
+				Qual("C", packageName+packageSeparator+typeName)).
+				Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
+		}
+	} else if selectorExpr, isSelector := (*_typeExpr).(*ast.SelectorExpr); isSelector {
+		if isUnsafePointer(selectorExpr) {
+			return jen.Op("*").Id(name).Op("=").Qual("unsafe", "Pointer").Call(jen.Id(argName(name)))
+		}
+		identExpr, isIdent := (selectorExpr.X).(*ast.Ident)
+		if isIdent {
+			selName := identExpr.Name
+			typeName := selectorExpr.Sel.Name
+			var argCode jen.Code
+			if isPointer {
+				argCode = jen.Id(argName(name))
+			} else {
+				argCode = jen.Op("&").Id(argName(name))
+			}
+			if g.isInHandleTypesList(selName + packageSeparator + typeName) {
+				return jen.Op("*").Id(name).Op("=").
+					Id("register" + g.handleTypes[selName+packageSeparator+typeName] + "Handle").
+					Call(argCode)
+			}
+			if g.isInCustomTypesList(selName + packageSeparator + typeName) {
+				return jen.Op("*").Id(name).Op("=").Op("*").Parens(jen.Op("*").
+					Qual("C", selName+packageSeparator+typeName)).
+					Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
+			} else if basicType, isBasic := g.externalBasicType(fast, selectorExpr); isBasic {
+				cType, _ := GetCTypeFromGoType(basicType)
+				return jen.Op("*").Id(name).Op("=").Op("*").Parens(jen.Op("*").
+					Qual("C", cType)).
+					Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
+			} else {
+				return jen.Op("*").Id(name).Op("=").Op("*").Parens(jen.Op("*").
+					Qual("C", selName+packageSeparator+typeName)).
+					Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
+			}
+		}
+	} else if mapExpr, isMap := (*_typeExpr).(*ast.MapType); isMap {
+		identKeyExpr, isKeyIdent := (mapExpr.Key).(*ast.Ident)
+		identValueExpr, isValueIdent := (mapExpr.Value).(*ast.Ident)
+		if isKeyIdent && isValueIdent {
+			if identKeyExpr.Name == "string" && identValueExpr.Name == "string" {
+				return jen.Id("copyToStringMap").Call(jen.Id(argName(name)), jen.Id(name))
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Generator) isLibArrayType(name, packageName string) bool {
+	return g.arrayTypes[name] == packageName
+}
+
+func (g *Generator) isInplaceConvertType(typeName string) bool {
+	if _, ok := g.inplaceConvertTypesPackages[typeName]; ok {
+		return true
+	}
+	return false
+
+}
+
+/* Process a type expression. Returns the code in C for the type and ok if successful */
+func (g *Generator) processTypeExpression(fast *ast.File, type_expr ast.Expr,
+	packageName string, name string,
+	definedTypes *[]string,
+	forwardsDeclarations *[]string, depth int,
+	dependantTypes *[]string) (string, bool, bool) {
+	cCode := ""
+	result := false
+	dependant := false
+	if converter := g.findConverter(fast, type_expr); converter != nil {
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		cCode = converter.CType + " " + newName
+		result = true
+	} else if typeStruct, isTypeStruct := (type_expr).(*ast.StructType); isTypeStruct {
+		if depth == 1 && forwardsDeclarations != nil && isForwardDeclared(*forwardsDeclarations, packageName+packageSeparator+name) {
+			// Tagged as declared ahead
+			cCode += "struct " + packageName + packageSeparator + name + "{\n"
+		} else {
+			cCode += "struct{\n"
+		}
+		err := false
+		for _, member := range g.structMembers(fast, typeStruct) {
+			for i := 0; i < depth*4; i++ {
+				cCode += " "
+			}
+			if member.handle != "" {
+				cCode += member.handle + packageSeparator + "Handle " + member.cName + ";\n"
+				continue
+			}
+			typeCode, result, isFieldDependant := g.processTypeExpression(fast, member.typeExpr, packageName, member.cName,
+				definedTypes, forwardsDeclarations, depth+1, dependantTypes)
+			if result {
+				if isFieldDependant {
+					dependant = true
+				}
+				cCode += typeCode
+			} else {
+				err = true
+			}
+			cCode += ";\n"
+		}
+		for i := 0; i < (depth-1)*4; i++ {
+			cCode += " "
+		}
+		cCode += "} "
+		typeName := name
+		if depth == 1 {
+			typeName = packageName + packageSeparator + typeName
+		}
+		cCode += typeName
+		if dependant && depth == 1 {
+			addDependant(dependantTypes, typeName)
+		}
+		result = !err
+	} else if arrayExpr, isArray := (type_expr).(*ast.ArrayType); isArray {
+		var arrayCode string
+		var arrayElCode string
+		result = false
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		if arrayExpr.Len == nil {
+			arrayCode = newName
+			arrayElCode = "GoSlice_ "
+			result = true
+		} else if arrayLen, ok := g.evalArrayLen(fast, arrayExpr.Len); ok {
+			arrayElCode, result, dependant = g.processTypeExpression(fast, arrayExpr.Elt, packageName, "",
+				definedTypes, forwardsDeclarations, depth+1, dependantTypes)
+			if result {
+				arrayCode = newName + "[" + arrayLen + "]"
+			}
+		} else {
+			g.applog("Couldn't evaluate length of array type %s", newName)
+		}
+		if result {
+			if dependant && depth == 1 {
+				addDependant(dependantTypes, newName)
+			}
+			cCode += arrayElCode + " " + arrayCode
+		}
+	} else if _, isFunc := (type_expr).(*ast.FuncType); isFunc {
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		cCode += "Handle " + newName
+		result = true
+		dependant = true
+	} else if _, isIntf := (type_expr).(*ast.InterfaceType); isIntf {
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		cCode += "GoInterface_ " + newName
+		result = true
+		dependant = true
+	} else if _, isChan := (type_expr).(*ast.ChanType); isChan {
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		cCode += "GoChan_ " + newName
+		result = true
+		dependant = true
+	} else if _, isMap := (type_expr).(*ast.MapType); isMap {
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		cCode += "GoMap_ " + newName
+		result = true
+		dependant = true
+	} else if starExpr, isStart := (type_expr).(*ast.StarExpr); isStart {
+		targetTypeExpr := starExpr.X
+		typeCode, ok, isFieldDependant := "", false, false
+		if forwardName, isForward := g.forwardDeclaredTarget(fast, starExpr, packageName, definedTypes,
+			forwardsDeclarations); isForward {
+			// Pointers to structs declared ahead break the cycles of types
+			typeCode, ok = "struct "+forwardName+" ", true
+		} else {
+			typeCode, ok, isFieldDependant = g.processTypeExpression(fast, targetTypeExpr, packageName, "",
+				definedTypes, forwardsDeclarations, depth+1, dependantTypes)
+		}
+		if ok {
+			if isFieldDependant {
+				dependant = true
+			}
+			cCode += typeCode
+			newName := name
+			if depth == 1 {
+				newName = packageName + packageSeparator + name
+			}
+			cCode += "* " + newName
+			if dependant && depth == 1 {
+				addDependant(dependantTypes, newName)
+			}
+			result = true
+		}
+	} else if identExpr, isIdent := (type_expr).(*ast.Ident); isIdent {
+		typeCode, isBasic := GetCTypeFromGoType(identExpr.Name)
+		if !isBasic {
+			addDependency := false
+			if packageName != fast.Name.Name && !g.isLibName(fast, packageName) {
+				if g.cfg.DependOnlyExternal {
+					if g.isExternalName(fast, packageName) {
+						addDependency = true
+					}
+				} else {
+					addDependency = true
+				}
+			}
+			typeCode = packageName + packageSeparator + typeCode
+			if addDependency {
+				addDependant(dependantTypes, typeCode)
+				dependant = true
+			}
+		}
+		cCode = typeCode
+		cCode += " "
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		cCode += newName
+		if !dependant {
+			if isDependantType(dependantTypes, typeCode) {
+				dependant = true
+			}
+		}
+		typeFound := false
+		for _, definedTypeIndex := range *definedTypes {
+			if definedTypeIndex == typeCode {
+				typeFound = true
+			}
+		}
+		if dependant && depth == 1 {
+			addDependant(dependantTypes, newName)
+		}
+		if !typeFound {
+			// Types of the file are used by value once defined, types declared elsewhere
+			// are expected to be defined by their headers
+			result = forwardsDeclarations != nil && !(packageName == fast.Name.Name && isFileType(fast, identExpr.Name))
+		} else {
+			result = true
+		}
+	} else if selectorExpr, isSelector := (type_expr).(*ast.SelectorExpr); isSelector && isUnsafePointer(selectorExpr) {
+		typeCode, _ := GetCTypeFromGoType("unsafe.Pointer")
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		cCode = typeCode + " " + newName
+		result = true
+	} else if isSelector {
+		externPackage := packageName
+		identExpr, isIdent := (selectorExpr.X).(*ast.Ident)
+		if isIdent {
+			externPackage = identExpr.Name
+		}
+		newName := name
+		if depth == 1 {
+			newName = packageName + packageSeparator + name
+		}
+		typeCode, ok, isFieldDependant := g.processTypeExpression(fast, selectorExpr.Sel, externPackage, newName,
+			definedTypes, forwardsDeclarations, depth+1, dependantTypes)
+		if isFieldDependant {
+			dependant = true
+		}
+		if dependant && depth == 1 {
+			addDependant(dependantTypes, newName)
+		}
+		if ok {
+			cCode = typeCode
+			result = true
+		}
+	}
+	return cCode, result, dependant
+}
+
+// Returns the C names of the structs declared in typeDecls pointed to from any of them, in declaration order
+func pointedStructs(fast *ast.File, typeDecls []*ast.GenDecl) []string {
+	structs := make(map[string]bool)
+	pointed := make(map[string]bool)
+	for _, typeDecl := range typeDecls {
+		if typeDecl == nil {
+			continue
+		}
+		for _, typeSpec := range typeSpecsOf(typeDecl) {
+			if _, isStruct := (typeSpec.Type).(*ast.StructType); isStruct {
+				structs[typeSpec.Name.Name] = true
+			}
+		}
+		ast.Inspect(typeDecl, func(node ast.Node) bool {
+			if starExpr, isStar := node.(*ast.StarExpr); isStar {
+				if identExpr, isIdent := (starExpr.X).(*ast.Ident); isIdent {
+					pointed[identExpr.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	var names []string
+	for _, typeDecl := range typeDecls {
+		if typeDecl == nil {
+			continue
+		}
+		for _, s := range typeDecl.Specs {
+			if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec && structs[typeSpec.Name.Name] && pointed[typeSpec.Name.Name] {
+				names = append(names, fast.Name.Name+packageSeparator+typeSpec.Name.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Returns whether the C type name is among the structs declared ahead
+func isForwardDeclared(forwardsDeclarations []string, typeName string) bool {
+	for _, name := range forwardsDeclarations {
+		if name == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the C name of the struct pointed to if it was declared ahead and is not defined yet
+func (g *Generator) forwardDeclaredTarget(fast *ast.File, starExpr *ast.StarExpr, packageName string,
+	definedTypes *[]string, forwardsDeclarations *[]string) (string, bool) {
+	identExpr, isIdent := (starExpr.X).(*ast.Ident)
+	if !isIdent || forwardsDeclarations == nil || packageName != fast.Name.Name {
+		return "", false
+	}
+	name := packageName + packageSeparator + identExpr.Name
+	for _, definedType := range *definedTypes {
+		if definedType == name {
+			return "", false
+		}
+	}
+	return name, isForwardDeclared(*forwardsDeclarations, name)
+}
+
+// Returns whether the name is a type declared in the file
+func isFileType(fast *ast.File, name string) bool {
+	object := fast.Scope.Lookup(name)
+	return object != nil && object.Kind == ast.Typ
+}
+
+func isDependantType(dependantTypes *[]string, typeName string) bool {
+	for _, t := range *dependantTypes {
+		if t == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+func addDependant(dependantTypes *[]string, typeName string) {
+	for _, t := range *dependantTypes {
+		if t == typeName {
+			return
+		}
+	}
+	*dependantTypes = append(*dependantTypes, typeName)
+}
+
+/* Process a type definition in GO and returns the c code for the definition */
+func (g *Generator) processTypeDef(fast *ast.File, tdecl *ast.GenDecl,
+	definedTypes *[]string, forwardsDeclarations *[]string,
+	dependantTypes *[]string) (string, bool, bool) {
+	resultCode := ""
+	result := true
+	isDependant := false
+	for _, s := range tdecl.Specs {
+		if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec {
+			if isAliasSpec(typeSpec) {
+				// Aliases were replaced with the types they stand for
+				continue
+			}
+			typeCCode, ok, isDependantExpr := g.processTypeExpression(fast, typeSpec.Type,
+				fast.Name.Name, typeSpec.Name.Name, definedTypes, forwardsDeclarations, 1,
+				dependantTypes)
+			if ok {
+				if isDependantExpr {
+					isDependant = true
+				}
+				resultCode += "typedef "
+				resultCode += typeCCode
+				resultCode += ";\n"
+				*definedTypes = append(*definedTypes, fast.Name.Name+packageSeparator+typeSpec.Name.Name)
+				g.reportStructFields(fast, typeSpec)
+			} else {
+				result = false
+			}
+		}
+	}
+	return resultCode, result, isDependant
+}
+
+/* Process all type definitions. Returns c code for all the defintions, followed by the
+assertions of their layouts, and the type specs generated */
+func (g *Generator) processTypeDefs(fast *ast.File, typeDecls []*ast.GenDecl, dependantTypes *[]string) (string, []*ast.TypeSpec) {
+	resultCode := ""
+	var generated []*ast.TypeSpec
+	allTypeDecls := append([]*ast.GenDecl(nil), typeDecls...)
+	emitted := make(map[*ast.GenDecl]bool)
+	dependant := make(map[*ast.GenDecl]bool)
+	var definedTypes []string
+	for key := range GetBasicTypes() {
+		ctype, ok := GetCTypeFromGoType(key)
+		if ok {
+			definedTypes = append(definedTypes, ctype)
+		}
+	}
+	// Types of other sources are defined by the headers included
+	definedTypes = append(definedTypes, g.otherSourcesTypes(g.jobOf(fast))...)
+
+	// Structs with members named alike can't be declared, nor the types declared with them
+	rejected := make(map[*ast.GenDecl]string)
+	var rejectedNames []string
+	unprocessed := len(typeDecls)
+	for index, typeDecl := range typeDecls {
+		for _, typeSpec := range typeSpecsOf(typeDecl) {
+			if member := g.duplicateMember(fast, typeSpec); member != "" {
+				g.reportStructFields(fast, typeSpec)
+				g.reportErrorAt(fast, typeSpec.Name, "type %s not generated, member %s is declared twice, rename one of its fields with a cgogen tag",
+					typeSpec.Name.Name, member)
+				if _, found := rejected[typeDecl]; !found {
+					rejected[typeDecl] = member
+					typeDecls[index] = nil
+					unprocessed -= 1
+				}
+			}
+		}
+		if _, found := rejected[typeDecl]; found {
+			for _, typeSpec := range typeSpecsOf(typeDecl) {
+				rejectedNames = append(rejectedNames, typeSpec.Name.Name)
+			}
+		}
+	}
+
+	wentBlank := false
+	for unprocessed > 0 && !wentBlank {
+		wentBlank = true
+		for index, typeDecl := range typeDecls {
+			if typeDecl != nil {
+				typeCode, ok, isDependant := g.processTypeDef(fast, typeDecl, &definedTypes, nil, dependantTypes)
+				if ok {
+					emitted[typeDecl], dependant[typeDecl] = true, isDependant
+					wentBlank = false
+					typeDecls[index] = nil
+					if !(g.cfg.IgnoreDependants && isDependant) {
+						resultCode += typeCode
+						generated = append(generated, typeSpecsOf(typeDecl)...)
+					}
+					unprocessed -= 1
+				}
+			}
+		}
+	}
+
+	// Types left refer to each other, or to types declared elsewhere. Structs left
+	// pointed to are declared ahead, so the pointers can be used before their definition.
+	var forwardsDeclarations []string
+	if unprocessed > 0 {
+		for _, name := range pointedStructs(fast, typeDecls) {
+			forwardsDeclarations = append(forwardsDeclarations, name)
+			resultCode += "struct " + name + ";\n"
+		}
+		wentBlank = false
+		for unprocessed > 0 && !wentBlank {
+			wentBlank = true
+			for index, typeDecl := range typeDecls {
+				if typeDecl != nil {
+					typeCode, ok, isDependant := g.processTypeDef(fast, typeDecl, &definedTypes, &forwardsDeclarations, dependantTypes)
+					if ok {
+						emitted[typeDecl], dependant[typeDecl] = true, isDependant
+						wentBlank = false
+						typeDecls[index] = nil
+						if !(g.cfg.IgnoreDependants && isDependant) {
+							resultCode += typeCode
+							generated = append(generated, typeSpecsOf(typeDecl)...)
+						}
+						unprocessed -= 1
+					}
+				}
+			}
+		}
+	}
+	for _, typeDecl := range typeDecls {
+		if typeDecl == nil {
+			continue
+		}
+		for _, typeSpec := range typeSpecsOf(typeDecl) {
+			if name := usedTypeName(typeSpec.Type, rejectedNames); name != "" {
+				g.reportErrorAt(fast, typeSpec.Name, "type %s not generated, it depends on %s, which isn't generated",
+					typeSpec.Name.Name, name)
+				continue
+			}
+			g.reportErrorAt(fast, typeSpec.Name,
+				"type %s not generated, it is part of or depends on a cycle of types that C can't declare, only pointers to structs can break cycles",
+				typeSpec.Name.Name)
+		}
+	}
+	g.recordTypeCoverage(fast, allTypeDecls, emitted, dependant, rejected, definedTypes, forwardsDeclarations, *dependantTypes)
+	for _, typeSpec := range generated {
+		resultCode += g.layoutAssertions(fast, typeSpec)
+	}
+	return resultCode, generated
+}
+
+// Returns the first of the type names used by the type expression, if any
+func usedTypeName(typeExpr ast.Expr, names []string) string {
+	used := ""
+	ast.Inspect(typeExpr, func(node ast.Node) bool {
+		if identExpr, isIdent := (node).(*ast.Ident); isIdent && used == "" {
+			for _, name := range names {
+				if identExpr.Name == name {
+					used = name
+				}
+			}
+		}
+		return used == ""
+	})
+	return used
+}
+
+// Returns the type specs of a type declaration, but for its aliases
+func typeSpecsOf(typeDecl *ast.GenDecl) []*ast.TypeSpec {
+	var typeSpecs []*ast.TypeSpec
+	for _, s := range typeDecl.Specs {
+		if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec && !isAliasSpec(typeSpec) {
+			typeSpecs = append(typeSpecs, typeSpec)
+		}
+	}
+	return typeSpecs
+}
+
+//Remove extra space in export indication
+func (g *Generator) fixExportComment(contents string) string {
+	return strings.Replace(contents, "// export "+g.functionPrefix+"_", "//export "+g.functionPrefix+"_", -1)
+}
+
+//Renders go code with export indications fixed
+func (g *Generator) renderGoFile(outFile *jen.File) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := outFile.Render(buf); err != nil {
+		return "", err
+	}
+	return g.fixExportComment(buf.String()), nil
+}
+
+//Renders go code with export indications fixed and saves it
+func (g *Generator) saveGoFile(fileName string, outFile *jen.File) {
+	text, err := g.renderGoFile(outFile)
+	if err != nil {
+		g.reportError("%s: %v", fileName, err)
+		return
+	}
+	g.saveTextToFile(fileName, text)
+}
+
+func (g *Generator) processTypeSetting(comment string) {
+	handlePrefix := "CGOGEN HANDLES "
+	typeConversionPrefix := "CGOGEN TYPES_CONVERSION "
+	typeSliceCustomPrefix := "CGOGEN SLICE "
+	inplacePrefix := "CGOGEN INPLACE "
+	asyncPrefix := "CGOGEN ASYNC "
+	smokePrefix := "CGOGEN SMOKE "
+	if strings.HasPrefix(comment, handlePrefix) {
+		handlesPart := comment[len(handlePrefix):]
+		handles := strings.Split(handlesPart, ",")
+		for _, handle := range handles {
+			handleParts := strings.Split(handle, "|")
+			if len(handleParts) > 1 {
+				g.handleTypes[handleParts[0]] = handleParts[1]
+			} else if len(handleParts) > 0 {
+				g.handleTypes[handleParts[0]] = handleParts[0]
+			}
+		}
+	} else if strings.HasPrefix(comment, typeConversionPrefix) {
+		typesPart := comment[len(typeConversionPrefix):]
+		types := strings.Split(typesPart, ",")
+		for _, t := range types {
+			typesPart := strings.Split(t, "|")
+			if len(typesPart) > 1 {
+				g.customTypesMap[typesPart[0]] = typesPart[1]
+			} else if len(typesPart) > 0 {
+				g.customTypesMap[typesPart[0]] = typesPart[0]
+			}
+		}
+	} else if strings.HasPrefix(comment, inplacePrefix) {
+		typesPart := comment[len(inplacePrefix):]
+		types := strings.Split(typesPart, ",")
+		for _, t := range types {
+			typesPart := strings.Split(t, "|")
+			if len(typesPart) > 1 {
+				g.inplaceConvertTypesPackages[typesPart[0]] = typesPart[1]
+			} else if len(typesPart) > 0 {
+				g.inplaceConvertTypesPackages[typesPart[0]] = typesPart[0]
+			}
+		}
+	} else if strings.HasPrefix(comment, typeSliceCustomPrefix) {
+		typesPart := comment[len(typeSliceCustomPrefix):]
+		types := strings.Split(typesPart, ",")
+		for _, t := range types {
+			typesPart := strings.Split(t, "|")
+			if len(typesPart) > 1 {
+				g.arrayTypes[typesPart[0]] = typesPart[1]
+			} else if len(typesPart) > 0 {
+				g.arrayTypes[typesPart[0]] = typesPart[0]
+			}
+		}
+	} else if strings.HasPrefix(comment, asyncPrefix) {
+		funcsPart := comment[len(asyncPrefix):]
+		for _, f := range strings.Split(funcsPart, ",") {
+			g.asyncFunctions[strings.TrimSpace(f)] = true
+		}
+	} else if strings.HasPrefix(comment, smokePrefix) {
+		funcsPart := comment[len(smokePrefix):]
+		for _, f := range strings.Split(funcsPart, ",") {
+			g.smokeFunctions[strings.TrimSpace(f)] = true
+		}
+	}
+}
+
+func IsBasicGoType(goType string) bool {
+	if _, ok := basicTypesMap[goType]; ok {
+		return true
+	} else {
+		return false
+	}
+}
+
+/* Returns the corresponding C type for a GO type*/
+func GetCTypeFromGoType(goType string) (string, bool) {
+	if val, ok := basicTypesMap[goType]; ok {
+		return val, true
+	} else {
+		return goType, false
+	}
+}
+
+func GetBasicTypes() map[string]string {
+	return basicTypesMap
+}
+
+var basicTypesMap = map[string]string{
+	"int":        "GoInt_",
+	"uint":       "GoUint_",
+	"int8":       "GoInt8_",
+	"int16":      "GoInt16_",
+	"int32":      "GoInt32_",
+	"int64":      "GoInt64_",
+	"byte":       "GoUint8_",
+	"uint8":      "GoUint8_",
+	"uint16":     "GoUint16_",
+	"uint32":     "GoUint32_",
+	"uint64":     "GoUint64_",
+	"float32":    "GoFloat32_",
+	"float64":    "GoFloat64_",
+	"complex64":  "GoComplex64_",
+	"complex128": "GoComplex128_",
+	"uintptr":    "GoUintptr_",
+	"rune":       "GoInt32_",
+	"string":     "GoString_",
+	"bool":       "bool",
+	//Errors cross the boundary as the code returned by libErrorCode
+	"error":          "GoUint32_",
+	"unsafe.Pointer": "void*",
+}
+
+var packageSeparator = "__"
+
+func getPathPackage(path string) (packagePath_ string, mainPackagePath_ string) {
+
+	index := strings.LastIndex(path, "/")
+	if index == -1 {
+		mainPackagePath_ = path
+	} else {
+		mainPackagePath_ = string(path[:index])
+	}
+	index = strings.LastIndex(mainPackagePath_, "/")
+	packagePath_ = string(mainPackagePath_[:index+1])
+	mainPackagePath_ = mainPackagePath_ + "/src/"
+
+	return
+}
@@ -1,4 +1,4 @@
-package main
+package cgogen
 
 import (
 	"fmt"
@@ -44,7 +44,7 @@ func (c *CCompiler) generateStatement(stmt ast.Stmt) (code string) {
 	} else {
 		s := reflect.ValueOf(stmt).Elem()
 		typeOfT := s.Type()
-		reportError("Don't know what to do with: %s", typeOfT)
+		c.reportErrorAt(stmt, "Don't know what to do with: %s", typeOfT)
 	}
 	return
 }
@@ -112,7 +112,7 @@ func (c *CCompiler) generateConst(decl ast.GenDecl) (code string) {
 		} else {
 			x := reflect.ValueOf(s).Elem()
 			typeOfT := x.Type()
-			reportError("Don't know what to do with: %s", typeOfT)
+			c.reportErrorAt(s, "Don't know what to do with: %s", typeOfT)
 		}
 	}
 	return code
@@ -171,7 +171,7 @@ func (c *CCompiler) generateVar(decl ast.GenDecl) (code string) {
 		} else {
 			x := reflect.ValueOf(s).Elem()
 			typeOfT := x.Type()
-			reportError("Don't know what to do with: %s", typeOfT)
+			c.reportErrorAt(s, "Don't know what to do with: %s", typeOfT)
 		}
 	}
 	return code
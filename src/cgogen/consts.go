@@ -0,0 +1,289 @@
+package cgogen
+
+import (
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Constant declaration found in a package, evaluated lazily
+type constDecl struct {
+	expr ast.Expr
+	iota int
+	file *ast.File
+}
+
+// Type declaration found in a package, with the file declaring it
+type typeDecl struct {
+	spec *ast.TypeSpec
+	file *ast.File
+}
+
+// Constants and types declared by a package, keyed by name
+type constPackage struct {
+	consts    map[string]*constDecl
+	types     map[string]typeDecl
+	values    map[string]constant.Value
+	resolving map[string]bool
+	// Directories of the other packages constants, types or aliases were resolved from
+	resolvedDirs map[string]bool
+	srcDir       string
+	importPath   string
+	g            *Generator
+}
+
+func (g *Generator) newConstPackage(srcDir string, importPath string, files []*ast.File) *constPackage {
+	p := &constPackage{
+		g:            g,
+		consts:       make(map[string]*constDecl),
+		types:        make(map[string]typeDecl),
+		values:       make(map[string]constant.Value),
+		resolving:    make(map[string]bool),
+		resolvedDirs: make(map[string]bool),
+		srcDir:       srcDir,
+		importPath:   importPath,
+	}
+	for _, file := range files {
+		p.addFile(file)
+	}
+	return p
+}
+
+func (p *constPackage) addFile(file *ast.File) {
+	p.g.filePackages[file] = p
+	for _, _decl := range file.Decls {
+		decl, ok := (_decl).(*ast.GenDecl)
+		if ok && decl.Tok == token.TYPE {
+			for _, s := range decl.Specs {
+				if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec {
+					p.types[typeSpec.Name.Name] = typeDecl{typeSpec, file}
+				}
+			}
+		}
+		if !ok || decl.Tok != token.CONST {
+			continue
+		}
+		var lastValues []ast.Expr
+		for index, s := range decl.Specs {
+			valueSpec, isValueSpec := (s).(*ast.ValueSpec)
+			if !isValueSpec {
+				continue
+			}
+			// Omitted values repeat the previous expression list
+			values := valueSpec.Values
+			if len(values) == 0 {
+				values = lastValues
+			} else {
+				lastValues = values
+			}
+			for nameIdx, name := range valueSpec.Names {
+				if nameIdx < len(values) && name.Name != "_" {
+					p.consts[name.Name] = &constDecl{expr: values[nameIdx], iota: index, file: file}
+				}
+			}
+		}
+	}
+}
+
+// Returns the constants of the package being wrapped.
+// Sibling files in the source directory with the same package name are included.
+func (g *Generator) localConstPackage(fast *ast.File) *constPackage {
+	job := g.jobOf(fast)
+	if job == nil {
+		// Files of the sources indexed and of the packages imported are added as they are parsed
+		return g.filePackages[fast]
+	}
+	return g.sourceConstPackage(job.path, fast, g.wrappedPackageImportPath(fast))
+}
+
+// Returns the package of a source, parsing its sibling files on first use
+func (g *Generator) sourceConstPackage(srcPath string, fast *ast.File, importPath string) *constPackage {
+	srcDir := filepath.Dir(srcPath)
+	key := "dir:" + srcDir + ":" + fast.Name.Name
+	if p, found := g.constPackages[key]; found {
+		p.addFile(fast)
+		return p
+	}
+	files := []*ast.File{}
+	fset := token.NewFileSet()
+	matches, _ := filepath.Glob(filepath.Join(srcDir, "*.go"))
+	for _, match := range matches {
+		if strings.HasSuffix(match, "_test.go") || filepath.Clean(match) == filepath.Clean(srcPath) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, match, nil, 0)
+		if err == nil && f.Name.Name == fast.Name.Name {
+			files = append(files, f)
+		}
+	}
+	files = append(files, fast)
+	p := g.newConstPackage(srcDir, importPath, files)
+	g.constPackages[key] = p
+	return p
+}
+
+// Returns the constants of an imported package, parsing it on first use
+func (g *Generator) importedConstPackage(importPath string, srcDir string) *constPackage {
+	if p, found := g.constPackages[importPath]; found {
+		return p
+	}
+	var files []*ast.File
+	pkgDir := ""
+	pkg, err := build.Import(importPath, srcDir, 0)
+	if err == nil {
+		pkgDir = pkg.Dir
+		fset := token.NewFileSet()
+		for _, fileName := range pkg.GoFiles {
+			f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, fileName), nil, 0)
+			if err == nil {
+				files = append(files, f)
+			}
+		}
+	} else {
+		g.reportWarning("Couldn't find package %s to resolve its constants and types: %v", importPath, err)
+	}
+	p := g.newConstPackage(pkgDir, importPath, files)
+	g.constPackages[importPath] = p
+	return p
+}
+
+// Returns the path of the package imported with name in file
+func fileImportPath(file *ast.File, importName string) (string, bool) {
+	for _, importSpec := range file.Imports {
+		path := strings.Trim(importSpec.Path.Value, "\"")
+		name := path[strings.LastIndex(path, "/")+1:]
+		if importSpec.Name != nil {
+			name = importSpec.Name.Name
+		}
+		if name == importName {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func (p *constPackage) lookup(name string) (constant.Value, bool) {
+	if value, found := p.values[name]; found {
+		return value, true
+	}
+	decl, found := p.consts[name]
+	if !found || p.resolving[name] {
+		return nil, false
+	}
+	p.resolving[name] = true
+	value, ok := p.eval(decl.expr, decl.file, decl.iota)
+	delete(p.resolving, name)
+	if ok {
+		p.values[name] = value
+	}
+	return value, ok
+}
+
+// Evaluates a constant expression declared in file
+func (p *constPackage) eval(expr ast.Expr, file *ast.File, iota int) (constant.Value, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		value := constant.MakeFromLiteral(e.Value, e.Kind, 0)
+		return value, value.Kind() != constant.Unknown
+	case *ast.ParenExpr:
+		return p.eval(e.X, file, iota)
+	case *ast.Ident:
+		switch e.Name {
+		case "iota":
+			return constant.MakeInt64(int64(iota)), true
+		case "true", "false":
+			return constant.MakeBool(e.Name == "true"), true
+		}
+		return p.lookup(e.Name)
+	case *ast.SelectorExpr:
+		identExpr, isIdent := (e.X).(*ast.Ident)
+		if !isIdent {
+			return nil, false
+		}
+		importPath, found := fileImportPath(file, identExpr.Name)
+		if !found {
+			return nil, false
+		}
+		imported := p.g.importedConstPackage(importPath, p.srcDir)
+		if imported.srcDir != "" && imported.srcDir != p.srcDir {
+			p.resolvedDirs[imported.srcDir] = true
+		}
+		return imported.lookup(e.Sel.Name)
+	case *ast.UnaryExpr:
+		x, ok := p.eval(e.X, file, iota)
+		if !ok {
+			return nil, false
+		}
+		return constant.UnaryOp(e.Op, x, 0), true
+	case *ast.BinaryExpr:
+		x, okX := p.eval(e.X, file, iota)
+		y, okY := p.eval(e.Y, file, iota)
+		if !okX || !okY {
+			return nil, false
+		}
+		switch e.Op {
+		case token.SHL, token.SHR:
+			shift, exact := constant.Uint64Val(constant.ToInt(y))
+			if !exact {
+				return nil, false
+			}
+			return constant.Shift(x, e.Op, uint(shift)), true
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return constant.MakeBool(constant.Compare(x, e.Op, y)), true
+		case token.QUO:
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				if constant.Sign(y) == 0 {
+					return nil, false
+				}
+				return constant.BinaryOp(x, token.QUO_ASSIGN, y), true
+			}
+		}
+		value := constant.BinaryOp(x, e.Op, y)
+		return value, value.Kind() != constant.Unknown
+	case *ast.CallExpr:
+		if len(e.Args) != 1 {
+			return nil, false
+		}
+		if identExpr, isIdent := (e.Fun).(*ast.Ident); isIdent {
+			if identExpr.Name == "len" {
+				value, ok := p.eval(e.Args[0], file, iota)
+				if ok && value.Kind() == constant.String {
+					return constant.MakeInt64(int64(len(constant.StringVal(value)))), true
+				}
+				return nil, false
+			}
+			// Conversion to a basic type keeps the value
+			if IsBasicGoType(identExpr.Name) {
+				return p.eval(e.Args[0], file, iota)
+			}
+		}
+	}
+	return nil, false
+}
+
+// Returns the decimal value of an array length expression
+func (g *Generator) evalArrayLen(fast *ast.File, lenExpr ast.Expr) (string, bool) {
+	if litExpr, isLit := (lenExpr).(*ast.BasicLit); isLit && litExpr.Kind == token.INT {
+		return litExpr.Value, true
+	}
+	g.constPackagesLock.Lock()
+	value, ok := g.localConstPackage(fast).eval(lenExpr, fast, 0)
+	g.constPackagesLock.Unlock()
+	if !ok {
+		return "", false
+	}
+	value = constant.ToInt(value)
+	if value.Kind() != constant.Int {
+		return "", false
+	}
+	length, exact := constant.Int64Val(value)
+	if !exact || length < 0 {
+		return "", false
+	}
+	return strconv.FormatInt(length, 10), true
+}
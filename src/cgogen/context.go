@@ -0,0 +1,170 @@
+package cgogen
+
+import (
+	"go/ast"
+
+	"github.com/dave/jennifer/jen"
+)
+
+/*
+Parameters of type context.Context are passed from C as cancellation tokens.
+
+A token is a handle of C type Context__Handle created by the generated API
+
+	<PREFIX>_Context_Create(Context__Handle* handle)
+	<PREFIX>_Context_CreateWithTimeout(GoInt64_ nanoseconds, Context__Handle* handle)
+	<PREFIX>_Context_Cancel(Context__Handle handle)
+	<PREFIX>_Context_Free(Context__Handle handle)
+
+Wrappers receive the token and look up its context. The zero handle stands
+for no token and is replaced by context.Background(). Functions returning
+contexts are not wrapped.
+*/
+
+const contextHandleType = "Context__Handle"
+
+// Declaration of the token type for cgo preambles, guarded so several files may include it
+const contextHandlePreamble = `#ifndef CGOGEN_CONTEXT_HANDLE
+#define CGOGEN_CONTEXT_HANDLE
+typedef GoUint64_ ` + contextHandleType + `;
+#endif`
+
+// Returns whether the type expression is context.Context
+func isContextType(fast *ast.File, typeExpr ast.Expr) bool {
+	selectorExpr, isSelector := (typeExpr).(*ast.SelectorExpr)
+	if !isSelector || selectorExpr.Sel.Name != "Context" {
+		return false
+	}
+	identExpr, isIdent := (selectorExpr.X).(*ast.Ident)
+	if !isIdent {
+		return false
+	}
+	importPath, found := fileImportPath(fast, identExpr.Name)
+	return found && importPath == "context"
+}
+
+// Returns the result of the function of type context.Context, if any
+func findContextResult(fast *ast.File, fdecl *ast.FuncDecl) (*ast.Field, bool) {
+	if fdecl.Type.Results == nil {
+		return nil, false
+	}
+	for _, field := range fdecl.Type.Results.List {
+		if isContextType(fast, field.Type) {
+			return field, true
+		}
+	}
+	return nil, false
+}
+
+// Declares the token type in the cgo preamble of the wrapper file
+func (g *Generator) addContextHandleType(fast *ast.File, outFile *jen.File) {
+	generatedHelpers := g.jobOf(fast).generatedHelpers
+	if !generatedHelpers["typedef "+contextHandleType] {
+		generatedHelpers["typedef "+contextHandleType] = true
+		outFile.CgoPreamble(contextHandlePreamble)
+	}
+}
+
+// Returns jen code looking up the context of an input token
+func (g *Generator) getContextParameterCode(name string) []jen.Code {
+	lookup := jen.List(jen.Id(name), jen.Id("ok"+name)).Op(":=").
+		Id("lookupContextHandle").Call(jen.Id(argName(name)))
+	checkError := jen.If(jen.Op("!").Id("ok"+name)).
+		Block(jen.Id(returnVarName).Op("=").Id(g.functionPrefix+"_BAD_HANDLE"), jen.Return())
+	return jenCodeToArray(lookup, checkError)
+}
+
+// Returns the Go source of the token store and its exported API
+func (g *Generator) generateContextAPI() *jen.File {
+	outFile := jen.NewFile("main")
+	outFile.CgoPreamble(`
+	  #include <string.h>
+	  #include <stdlib.h>
+
+	  #include "` + g.includePrefix + `types.h"`)
+	outFile.CgoPreamble(contextHandlePreamble)
+
+	handleType := jen.Qual("C", contextHandleType)
+
+	outFile.Comment("Context of a cancellation token created from C")
+	outFile.Type().Id("contextToken").Struct(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("cancel").Qual("context", "CancelFunc"),
+	)
+	outFile.Var().Defs(
+		jen.Id("contextTokensLock").Qual("sync", "Mutex"),
+		jen.Id("contextTokens").Op("=").Make(jen.Map(handleType.Clone()).Op("*").Id("contextToken")),
+		jen.Id("lastContextHandle").Add(handleType.Clone()),
+	)
+
+	outFile.Func().Id("registerContextToken").
+		Params(jen.Id("ctx").Qual("context", "Context"), jen.Id("cancel").Qual("context", "CancelFunc")).
+		Add(handleType.Clone()).Block(
+		jen.Id("contextTokensLock").Dot("Lock").Call(),
+		jen.Defer().Id("contextTokensLock").Dot("Unlock").Call(),
+		jen.Id("lastContextHandle").Op("++"),
+		jen.Id("contextTokens").Index(jen.Id("lastContextHandle")).Op("=").
+			Op("&").Id("contextToken").Values(jen.Id("ctx"), jen.Id("cancel")),
+		jen.Return(jen.Id("lastContextHandle")),
+	)
+
+	outFile.Func().Id("lookupContextHandle").
+		Params(jen.Id("handle").Add(handleType.Clone())).
+		Params(jen.Qual("context", "Context"), jen.Bool()).Block(
+		jen.If(jen.Id("handle").Op("==").Lit(0)).Block(
+			jen.Return(jen.Qual("context", "Background").Call(), jen.True()),
+		),
+		jen.Id("contextTokensLock").Dot("Lock").Call(),
+		jen.Defer().Id("contextTokensLock").Dot("Unlock").Call(),
+		jen.List(jen.Id("token"), jen.Id("ok")).Op(":=").Id("contextTokens").Index(jen.Id("handle")),
+		jen.If(jen.Op("!").Id("ok")).Block(jen.Return(jen.Nil(), jen.False())),
+		jen.Return(jen.Id("token").Dot("ctx"), jen.True()),
+	)
+
+	// Removes the token from the store and returns its cancel function
+	outFile.Func().Id("removeContextHandle").
+		Params(jen.Id("handle").Add(handleType.Clone())).
+		Params(jen.Qual("context", "CancelFunc"), jen.Bool()).Block(
+		jen.Id("contextTokensLock").Dot("Lock").Call(),
+		jen.Defer().Id("contextTokensLock").Dot("Unlock").Call(),
+		jen.List(jen.Id("token"), jen.Id("ok")).Op(":=").Id("contextTokens").Index(jen.Id("handle")),
+		jen.If(jen.Op("!").Id("ok")).Block(jen.Return(jen.Nil(), jen.False())),
+		jen.Delete(jen.Id("contextTokens"), jen.Id("handle")),
+		jen.Return(jen.Id("token").Dot("cancel"), jen.True()),
+	)
+
+	badHandle := jen.If(jen.Op("!").Id("ok")).
+		Block(jen.Id(returnVarName).Op("=").Id(g.functionPrefix+"_BAD_HANDLE"), jen.Return())
+	exportFunc := func(name string, params []jen.Code, body ...jen.Code) {
+		cfuncName := g.functionPrefix + "_Context_" + name
+		outFile.Comment("export " + cfuncName) //nolint staticcheck
+		outFile.Func().Id(cfuncName).Params(params...).
+			Parens(jen.Id(returnVarName).Id("uint32")).Block(append(body, jen.Return())...)
+	}
+
+	exportFunc("Create", []jen.Code{jen.Id("_handle").Op("*").Add(handleType.Clone())},
+		jen.List(jen.Id("ctx"), jen.Id("cancel")).Op(":=").
+			Qual("context", "WithCancel").Call(jen.Qual("context", "Background").Call()),
+		jen.Op("*").Id("_handle").Op("=").Id("registerContextToken").Call(jen.Id("ctx"), jen.Id("cancel")),
+	)
+	exportFunc("CreateWithTimeout",
+		[]jen.Code{jen.Id("_timeout").Qual("C", "GoInt64_"), jen.Id("_handle").Op("*").Add(handleType.Clone())},
+		jen.List(jen.Id("ctx"), jen.Id("cancel")).Op(":=").
+			Qual("context", "WithTimeout").Call(jen.Qual("context", "Background").Call(),
+			jen.Qual("time", "Duration").Call(jen.Id("_timeout"))),
+		jen.Op("*").Id("_handle").Op("=").Id("registerContextToken").Call(jen.Id("ctx"), jen.Id("cancel")),
+	)
+	exportFunc("Cancel", []jen.Code{jen.Id("_handle").Add(handleType.Clone())},
+		jen.Id("contextTokensLock").Dot("Lock").Call(),
+		jen.List(jen.Id("token"), jen.Id("ok")).Op(":=").Id("contextTokens").Index(jen.Id("_handle")),
+		jen.Id("contextTokensLock").Dot("Unlock").Call(),
+		badHandle,
+		jen.Id("token").Dot("cancel").Call(),
+	)
+	exportFunc("Free", []jen.Code{jen.Id("_handle").Add(handleType.Clone())},
+		jen.List(jen.Id("cancel"), jen.Id("ok")).Op(":=").Id("removeContextHandle").Call(jen.Id("_handle")),
+		badHandle,
+		jen.Id("cancel").Call(),
+	)
+	return outFile
+}
@@ -0,0 +1,1041 @@
+package cgogen
+
+import (
+	"go/ast"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/dave/jennifer/jen"
+)
+
+/*
+Deep conversion of values between C and Go.
+
+Types whose C representation has the same memory layout as in Go and hold no
+pointers (flat types) are converted with a cast. Any other type gets a pair of
+generated helper functions
+
+	func copyFromC_<type>(src *<C type>, dst *<Go type>) uint32
+	func copyToC_<type>(src *<Go type>, dst *<C type>)
+
+copyFromC_ helpers copy C memory into newly allocated Go values and return a
+non-zero error code on failure. copyToC_ helpers copy Go values into memory
+allocated with C.calloc, so the caller owns the result, and freeC_ helpers
+free it
+
+	func freeC_<type>(dst *<C type>)
+
+Slices of flat elements are read in place from C memory and copied into the
+buffer of the caller, as any other slice before. Wrappers with outputs filled
+by copyToC_ helpers also export a function freeing them
+
+	void <PREFIX>_<package>_<Func>_Free(<outputs>);
+
+Helpers of types holding pointers take the map of the pointers already
+converted, so values pointed to several times are converted once and cycles,
+such as trees pointing back to their parents, end. Inputs holding pointers
+aren't copied back after the call, that would replace the pointers of the
+caller. Other inputs passed by pointer are, the C memory they hold being freed
+first, so callers only pass memory allocated with calloc or malloc, such as
+outputs of the library, and free the copy with the Free function of the
+wrapper. Members passed as handles keep the handle of the C value copied back
+when it refers to the same Go value, outputs holding them are zeroed before,
+so their handles are always registered.
+*/
+
+// Returns a tag identifying the wrapper file.
+// Wrappers of a package are compiled together, so helper names must not clash between files.
+func helperFileTag(path string) string {
+	tag := strings.TrimSuffix(filepath.Base(path), ".go")
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, tag)
+}
+
+func (g *Generator) fromCHelperName(fast *ast.File, mangled string) string {
+	return "copyFromC_" + helperFileTag(g.jobOf(fast).path) + packageSeparator + mangled
+}
+
+func (g *Generator) toCHelperName(fast *ast.File, mangled string) string {
+	return "copyToC_" + helperFileTag(g.jobOf(fast).path) + packageSeparator + mangled
+}
+
+// Returns the type declared with name in the file being wrapped
+func findTypeSpec(fast *ast.File, name string) *ast.TypeSpec {
+	for _, _decl := range fast.Decls {
+		if decl, ok := (_decl).(*ast.GenDecl); ok {
+			for _, s := range decl.Specs {
+				if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec && typeSpec.Name.Name == name {
+					return typeSpec
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the key of a type in the handles list
+func (g *Generator) handleTypeKey(fast *ast.File, typeExpr ast.Expr) (string, bool) {
+	if starExpr, isStar := (typeExpr).(*ast.StarExpr); isStar {
+		typeExpr = starExpr.X
+	}
+	if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent {
+		if g.isInHandleTypesList(identExpr.Name) {
+			return identExpr.Name, true
+		}
+		key := fast.Name.Name + packageSeparator + identExpr.Name
+		return key, g.isInHandleTypesList(key)
+	} else if selectorExpr, isSelector := (typeExpr).(*ast.SelectorExpr); isSelector {
+		if identExpr, isIdent := (selectorExpr.X).(*ast.Ident); isIdent {
+			key := identExpr.Name + packageSeparator + selectorExpr.Sel.Name
+			if g.isInHandleTypesList(key) {
+				return key, true
+			}
+			key = identExpr.Name + "." + selectorExpr.Sel.Name
+			return key, g.isInHandleTypesList(key)
+		}
+	}
+	return "", false
+}
+
+// Returns the declaration of a named type and the file declaring it. Types are searched
+// in the file, the other files of its package, the sources of the run and the packages
+// imported by the file.
+func (g *Generator) findNamedType(fast *ast.File, typeExpr ast.Expr) (*ast.TypeSpec, *ast.File) {
+	switch t := typeExpr.(type) {
+	case *ast.Ident:
+		if IsBasicGoType(t.Name) {
+			return nil, nil
+		}
+		if typeSpec := findTypeSpec(fast, t.Name); typeSpec != nil {
+			return typeSpec, fast
+		}
+		g.constPackagesLock.Lock()
+		defer g.constPackagesLock.Unlock()
+		if p := g.localConstPackage(fast); p != nil {
+			if decl, found := p.types[t.Name]; found {
+				return decl.spec, decl.file
+			}
+		}
+	case *ast.SelectorExpr:
+		identExpr, isIdent := (t.X).(*ast.Ident)
+		if !isIdent {
+			return nil, nil
+		}
+		name := identExpr.Name + packageSeparator + t.Sel.Name
+		if decl, found := g.typeDecls[name]; found {
+			g.constPackagesLock.Lock()
+			g.addResolvedDir(fast, filepath.Dir(g.typeSources[name]))
+			g.constPackagesLock.Unlock()
+			return decl.spec, decl.file
+		}
+		importPath, found := fileImportPath(fast, identExpr.Name)
+		if !found || importPath == "C" || importPath == "unsafe" {
+			return nil, nil
+		}
+		g.constPackagesLock.Lock()
+		defer g.constPackagesLock.Unlock()
+		srcDir := ""
+		if p := g.localConstPackage(fast); p != nil {
+			srcDir = p.srcDir
+		}
+		imported := g.importedConstPackage(importPath, srcDir)
+		g.addResolvedDir(fast, imported.srcDir)
+		if decl, found := imported.types[t.Sel.Name]; found {
+			return decl.spec, decl.file
+		}
+	}
+	return nil, nil
+}
+
+// Resolves a named type of the wrapped package to the type it is defined as
+func (g *Generator) underlyingTypeExpr(fast *ast.File, typeExpr ast.Expr) ast.Expr {
+	visited := make(map[string]bool)
+	for {
+		identExpr, isIdent := (typeExpr).(*ast.Ident)
+		if !isIdent || IsBasicGoType(identExpr.Name) || visited[identExpr.Name] {
+			return typeExpr
+		}
+		visited[identExpr.Name] = true
+		// Types declared by other files of the package are also resolved, their
+		// identifiers name the same types in the file
+		typeSpec, _ := g.findNamedType(fast, identExpr)
+		if typeSpec == nil {
+			return typeExpr
+		}
+		typeExpr = typeSpec.Type
+	}
+}
+
+// Returns the basic type a named type of an external package is defined as, such as uint for big.Word.
+// Strings aren't returned, their memory can't be shared with C.
+func (g *Generator) externalBasicType(fast *ast.File, selExpr *ast.SelectorExpr) (string, bool) {
+	identExpr, isIdent := (selExpr.X).(*ast.Ident)
+	if !isIdent || g.isLibName(fast, identExpr.Name) || isUnsafePointer(selExpr) {
+		return "", false
+	}
+	typeSpec, _ := g.findNamedType(fast, selExpr)
+	if typeSpec == nil {
+		return "", false
+	}
+	basicExpr, isIdent := (typeSpec.Type).(*ast.Ident)
+	if !isIdent || !IsBasicGoType(basicExpr.Name) || basicExpr.Name == "string" {
+		return "", false
+	}
+	return basicExpr.Name, true
+}
+
+// Returns true when the type can be copied between C and Go as raw memory.
+// Types that can't be resolved aren't flat, they may hold Go pointers.
+func (g *Generator) isFlatType(fast *ast.File, typeExpr ast.Expr) bool {
+	return g.isFlatTypeExpr(fast, typeExpr, make(map[*ast.TypeSpec]bool))
+}
+
+func (g *Generator) isFlatTypeExpr(fast *ast.File, typeExpr ast.Expr, visiting map[*ast.TypeSpec]bool) bool {
+	if g.findConverter(fast, typeExpr) != nil {
+		return false
+	}
+	switch t := typeExpr.(type) {
+	case *ast.Ident, *ast.SelectorExpr:
+		if identExpr, isIdent := (t).(*ast.Ident); isIdent && IsBasicGoType(identExpr.Name) {
+			return identExpr.Name != "string"
+		}
+		if selectorExpr, isSelector := (t).(*ast.SelectorExpr); isSelector && (isUnsafePointer(selectorExpr) || isCTypeExpr(selectorExpr)) {
+			return true
+		}
+		// Fields of types declared by other files are resolved with the imports of those files
+		typeSpec, declFile := g.findNamedType(fast, typeExpr)
+		if typeSpec == nil {
+			return false
+		}
+		if visiting[typeSpec] {
+			return true
+		}
+		visiting[typeSpec] = true
+		defer delete(visiting, typeSpec)
+		return g.isFlatTypeExpr(declFile, typeSpec.Type, visiting)
+	case *ast.ArrayType:
+		return t.Len != nil && g.isFlatTypeExpr(fast, t.Elt, visiting)
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if parseFieldTag(field).changesLayout() || !g.isFlatTypeExpr(fast, field.Type, visiting) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Returns true when cgogen can generate conversion helpers for the type
+func (g *Generator) canConvertType(fast *ast.File, typeExpr ast.Expr, useHandles bool) bool {
+	return g.canConvertTypeExpr(fast, typeExpr, useHandles, make(map[string]bool))
+}
+
+func (g *Generator) canConvertTypeExpr(fast *ast.File, typeExpr ast.Expr, useHandles bool, visiting map[string]bool) bool {
+	if g.findConverter(fast, typeExpr) != nil {
+		return true
+	}
+	if _, isHandle := g.handleTypeKey(fast, typeExpr); isHandle && useHandles {
+		return true
+	}
+	if g.isFlatType(fast, typeExpr) {
+		return true
+	}
+	if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent {
+		if visiting[identExpr.Name] {
+			return true
+		}
+		visiting[identExpr.Name] = true
+		defer delete(visiting, identExpr.Name)
+	}
+	switch t := g.underlyingTypeExpr(fast, typeExpr).(type) {
+	case *ast.Ident:
+		return t.Name == "string"
+	case *ast.SelectorExpr:
+		// Defined as a type with a converter
+		return g.findConverter(fast, t) != nil
+	case *ast.ArrayType:
+		return g.canConvertTypeExpr(fast, t.Elt, useHandles, visiting)
+	case *ast.StarExpr:
+		return g.canConvertTypeExpr(fast, t.X, false, visiting)
+	case *ast.StructType:
+		if _, isNamed := (typeExpr).(*ast.Ident); !isNamed {
+			return false
+		}
+		for _, field := range t.Fields.List {
+			if len(structFieldNames(field)) == 0 {
+				return false
+			}
+		}
+		for _, member := range g.structMembers(fast, t) {
+			if !ast.IsExported(member.goName()) {
+				return false
+			}
+			if member.handle == "" && !g.canConvertTypeExpr(fast, member.typeExpr, false, visiting) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Returns true for slices of flat elements other than handles, passed to C as GoSlice_
+func (g *Generator) isFlatSlice(fast *ast.File, typeExpr ast.Expr) bool {
+	arrayExpr, isArray := (typeExpr).(*ast.ArrayType)
+	if !isArray || arrayExpr.Len != nil {
+		return false
+	}
+	_, isHandle := g.handleTypeKey(fast, arrayExpr.Elt)
+	return !isHandle && g.isFlatType(fast, arrayExpr.Elt)
+}
+
+// Returns true when the type must be converted with generated helpers instead of a cast.
+// That is the case of slices of elements that aren't flat and of named types of the
+// wrapped package holding Go pointers. Basic types, strings included, are converted
+// by the wrappers themselves.
+func (g *Generator) needsDeepConversion(fast *ast.File, typeExpr ast.Expr) bool {
+	if g.findConverter(fast, typeExpr) != nil {
+		return true
+	}
+	if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent && IsBasicGoType(identExpr.Name) {
+		return false
+	}
+	if g.isFlatSlice(fast, typeExpr) {
+		return false
+	}
+	if arrayExpr, isArray := (typeExpr).(*ast.ArrayType); isArray && arrayExpr.Len != nil {
+		return false
+	} else if _, isIdent := (typeExpr).(*ast.Ident); !isIdent && !isArray {
+		return false
+	}
+	if g.isFlatType(fast, typeExpr) {
+		return false
+	}
+	if g.canConvertType(fast, typeExpr, true) {
+		return true
+	}
+	if _, isStruct := (g.underlyingTypeExpr(fast, typeExpr)).(*ast.StructType); isStruct {
+		g.applog("Type %s holds Go pointers but can't be converted field by field",
+			g.mangleTypeName(fast, typeExpr, false))
+	}
+	return false
+}
+
+// Returns an identifier describing the type, used to name helpers and C types
+func (g *Generator) mangleTypeName(fast *ast.File, typeExpr ast.Expr, useHandles bool) string {
+	if key, isHandle := g.handleTypeKey(fast, typeExpr); isHandle && useHandles {
+		name := g.handleTypes[key] + packageSeparator + "Handle"
+		if _, isStar := (typeExpr).(*ast.StarExpr); !isStar {
+			name += "Value"
+		}
+		return name
+	}
+	switch t := typeExpr.(type) {
+	case *ast.Ident:
+		if ctype, isBasic := GetCTypeFromGoType(t.Name); isBasic {
+			return strings.TrimSuffix(ctype, "_")
+		}
+		return fast.Name.Name + packageSeparator + t.Name
+	case *ast.SelectorExpr:
+		if identExpr, isIdent := (t.X).(*ast.Ident); isIdent {
+			return identExpr.Name + packageSeparator + t.Sel.Name
+		}
+	case *ast.StarExpr:
+		return g.mangleTypeName(fast, t.X, false) + "Ptr"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return g.mangleTypeName(fast, t.Elt, useHandles) + "Slice"
+		}
+		arrayLen, _ := g.evalArrayLen(fast, t.Len)
+		return g.mangleTypeName(fast, t.Elt, useHandles) + "Array" + arrayLen
+	}
+	return "Unknown"
+}
+
+// Returns the name of the C type used in wrappers for a slice type
+func (g *Generator) sliceCTypeName(fast *ast.File, arrayExpr *ast.ArrayType) string {
+	return g.mangleTypeName(fast, arrayExpr, true) + "_"
+}
+
+// Declares the C type of a slice in the cgo preamble of the wrapper file
+func (g *Generator) addSliceCType(fast *ast.File, arrayExpr *ast.ArrayType, outFile *jen.File) string {
+	typeName := g.sliceCTypeName(fast, arrayExpr)
+	generatedHelpers := g.jobOf(fast).generatedHelpers
+	if !generatedHelpers["typedef "+typeName] {
+		generatedHelpers["typedef "+typeName] = true
+		outFile.CgoPreamble("typedef GoSlice_ " + typeName + ";")
+	}
+	return typeName
+}
+
+// Returns jen code for the Go type
+func (g *Generator) goTypeCode(fast *ast.File, typeExpr ast.Expr) *jen.Statement {
+	switch t := typeExpr.(type) {
+	case *ast.Ident:
+		if IsBasicGoType(t.Name) || t.Name == "error" {
+			return jen.Id(t.Name)
+		}
+		if g.mainPackagePath != "" {
+			return jen.Qual(g.wrappedPackageImportPath(fast), t.Name)
+		}
+		return jen.Id(fast.Name.Name).Dot(t.Name)
+	case *ast.SelectorExpr:
+		if identExpr, isIdent := (t.X).(*ast.Ident); isIdent {
+			if importPath, found := fileImportPath(fast, identExpr.Name); found {
+				return jen.Qual(importPath, t.Sel.Name)
+			}
+			return jen.Id(identExpr.Name).Dot(t.Sel.Name)
+		}
+	case *ast.StarExpr:
+		return jen.Op("*").Add(g.goTypeCode(fast, t.X))
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return jen.Index().Add(g.goTypeCode(fast, t.Elt))
+		}
+		arrayLen, _ := g.evalArrayLen(fast, t.Len)
+		return jen.Index(jen.Id(arrayLen)).Add(g.goTypeCode(fast, t.Elt))
+	case *ast.MapType:
+		return jen.Map(g.goTypeCode(fast, t.Key)).Add(g.goTypeCode(fast, t.Value))
+	case *ast.InterfaceType:
+		return jen.Interface()
+	}
+	return jen.Id(getTypeOfVar(typeExpr))
+}
+
+// Returns jen code for the C type representing a Go type
+func (g *Generator) cTypeCode(fast *ast.File, typeExpr ast.Expr, useHandles bool) *jen.Statement {
+	if converter := g.findConverter(fast, typeExpr); converter != nil {
+		return jen.Qual("C", converter.CType)
+	}
+	if key, isHandle := g.handleTypeKey(fast, typeExpr); isHandle && useHandles {
+		return jen.Qual("C", g.handleTypes[key]+packageSeparator+"Handle")
+	}
+	switch t := typeExpr.(type) {
+	case *ast.Ident:
+		if ctype, isBasic := GetCTypeFromGoType(t.Name); isBasic {
+			return jen.Qual("C", ctype)
+		}
+		return jen.Qual("C", fast.Name.Name+packageSeparator+t.Name)
+	case *ast.SelectorExpr:
+		if isUnsafePointer(t) {
+			return jen.Qual("unsafe", "Pointer")
+		}
+		if identExpr, isIdent := (t.X).(*ast.Ident); isIdent {
+			return jen.Qual("C", identExpr.Name+packageSeparator+t.Sel.Name)
+		}
+	case *ast.StarExpr:
+		return jen.Op("*").Add(g.cTypeCode(fast, t.X, false))
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return jen.Qual("C", "GoSlice_")
+		}
+		arrayLen, _ := g.evalArrayLen(fast, t.Len)
+		return jen.Index(jen.Id(arrayLen)).Add(g.cTypeCode(fast, t.Elt, useHandles))
+	case *ast.MapType:
+		return jen.Qual("C", "GoMap_")
+	case *ast.InterfaceType:
+		return jen.Qual("C", "GoInterface_")
+	case *ast.FuncType:
+		return jen.Qual("C", "Handle")
+	case *ast.ChanType:
+		return jen.Qual("C", "GoChan_")
+	}
+	return jen.Qual("C", "void")
+}
+
+// Returns code to access the element at index of a C array starting at data
+func cArrayElemCode(data jen.Code, index string, elemType *jen.Statement) *jen.Statement {
+	return jen.Parens(jen.Op("*").Add(elemType)).Parens(jen.Qual("unsafe", "Pointer").Parens(
+		jen.Id("uintptr").Parens(data).Op("+").Id("uintptr").Parens(jen.Id(index)).
+			Op("*").Qual("unsafe", "Sizeof").Parens(jen.Id("elem"))))
+}
+
+// Returns a statement copying the C value pointed by src into the Go value dst, addressed by dstPtr.
+// The statement returns the error code from the enclosing helper on failure.
+func (g *Generator) convertFromCCode(fast *ast.File, typeExpr ast.Expr, src jen.Code, dst jen.Code, dstPtr jen.Code,
+	useHandles bool, outFile *jen.File) jen.Code {
+	_, isHandle := g.handleTypeKey(fast, typeExpr)
+	if g.isFlatType(fast, typeExpr) && !(isHandle && useHandles) {
+		return jen.Add(dst).Op("=").Op("*").Parens(jen.Op("*").Add(g.goTypeCode(fast, typeExpr))).
+			Parens(jen.Qual("unsafe", "Pointer").Parens(src))
+	}
+	helper := g.addFromCHelper(fast, typeExpr, useHandles, outFile)
+	args := append([]jen.Code{src, dstPtr}, g.seenArgs(fast, typeExpr, useHandles, false)...)
+	return jen.If(jen.Id("code").Op(":=").Id(helper).Call(args...), jen.Id("code").Op("!=").Lit(0)).
+		Block(jen.Return(jen.Id("code")))
+}
+
+// Returns a statement copying the Go value pointed by src into the C value dst, addressed by dstPtr
+func (g *Generator) convertToCCode(fast *ast.File, typeExpr ast.Expr, src jen.Code, dst jen.Code, dstPtr jen.Code,
+	useHandles bool, outFile *jen.File) jen.Code {
+	_, isHandle := g.handleTypeKey(fast, typeExpr)
+	if g.isFlatType(fast, typeExpr) && !(isHandle && useHandles) {
+		return jen.Add(dst).Op("=").Op("*").Parens(jen.Op("*").Add(g.cTypeCode(fast, typeExpr, useHandles))).
+			Parens(jen.Qual("unsafe", "Pointer").Parens(src))
+	}
+	helper := g.addToCHelper(fast, typeExpr, useHandles, outFile)
+	return jen.Id(helper).Call(append([]jen.Code{src, dstPtr}, g.seenArgs(fast, typeExpr, useHandles, false)...)...)
+}
+
+// Returns true when converting the type converts pointers, whose helpers take the map of
+// the pointers already converted
+func (g *Generator) convertsPointers(fast *ast.File, typeExpr ast.Expr, useHandles bool) bool {
+	return g.convertsPointersExpr(fast, typeExpr, useHandles, make(map[string]bool))
+}
+
+func (g *Generator) convertsPointersExpr(fast *ast.File, typeExpr ast.Expr, useHandles bool, visiting map[string]bool) bool {
+	if g.findConverter(fast, typeExpr) != nil {
+		return false
+	}
+	if _, isHandle := g.handleTypeKey(fast, typeExpr); isHandle && useHandles {
+		return false
+	}
+	if g.isFlatType(fast, typeExpr) {
+		return false
+	}
+	if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent {
+		if visiting[identExpr.Name] {
+			return false
+		}
+		visiting[identExpr.Name] = true
+		defer delete(visiting, identExpr.Name)
+	}
+	switch t := g.underlyingTypeExpr(fast, typeExpr).(type) {
+	case *ast.SelectorExpr:
+		return g.convertsPointersExpr(fast, t, false, visiting)
+	case *ast.ArrayType:
+		return g.convertsPointersExpr(fast, t.Elt, useHandles, visiting)
+	case *ast.StarExpr:
+		return true
+	case *ast.StructType:
+		for _, member := range g.structMembers(fast, t) {
+			if member.handle == "" && g.convertsPointersExpr(fast, member.typeExpr, false, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the map of the pointers already converted passed to the helper of the type, if it
+// converts pointers. Helpers pass theirs, wrappers a new one.
+func (g *Generator) seenArgs(fast *ast.File, typeExpr ast.Expr, useHandles bool, wrapper bool) []jen.Code {
+	if !g.convertsPointers(fast, typeExpr, useHandles) {
+		return nil
+	}
+	if wrapper {
+		return jenCodeToArray(jen.Make(jen.Map(jen.Qual("unsafe", "Pointer")).Qual("unsafe", "Pointer")))
+	}
+	return jenCodeToArray(jen.Id("seen"))
+}
+
+// Returns the parameters of the helper of the type, with the map of the pointers already converted
+// if it converts pointers
+func (g *Generator) helperParams(fast *ast.File, typeExpr ast.Expr, useHandles bool, params ...jen.Code) []jen.Code {
+	if g.convertsPointers(fast, typeExpr, useHandles) {
+		params = append(params, jen.Id("seen").Map(jen.Qual("unsafe", "Pointer")).Qual("unsafe", "Pointer"))
+	}
+	return params
+}
+
+// Adds to the output file the helper converting a C value into a Go value of the type
+func (g *Generator) addFromCHelper(fast *ast.File, typeExpr ast.Expr, useHandles bool, outFile *jen.File) string {
+	helper := g.fromCHelperName(fast, g.mangleTypeName(fast, typeExpr, useHandles))
+	generatedHelpers := g.jobOf(fast).generatedHelpers
+	if generatedHelpers[helper] {
+		return helper
+	}
+	generatedHelpers[helper] = true
+	var body []jen.Code
+	goType := g.goTypeCode(fast, typeExpr)
+	if converter := g.findConverter(fast, typeExpr); converter != nil {
+		body = append(body, g.converterTemplateCode(converter.GoType, converter.FromC))
+	} else if key, isHandle := g.handleTypeKey(fast, typeExpr); isHandle && useHandles {
+		lookup := jen.List(jen.Id("obj"), jen.Id("ok")).Op(":=").
+			Id("lookup" + g.handleTypes[key] + "Handle").Call(jen.Op("*").Id("src"))
+		checkError := jen.If(jen.Op("!").Id("ok")).Block(jen.Return(jen.Id(g.functionPrefix + "_BAD_HANDLE")))
+		body = append(body, lookup, checkError)
+		if _, isStar := (typeExpr).(*ast.StarExpr); isStar {
+			body = append(body, jen.Op("*").Id("dst").Op("=").Id("obj"))
+		} else {
+			body = append(body, jen.Op("*").Id("dst").Op("=").Op("*").Id("obj"))
+		}
+	} else {
+		switch t := g.underlyingTypeExpr(fast, typeExpr).(type) {
+		case *ast.Ident:
+			body = append(body, g.getNullDataCheckCode(jen.Id("src").Dot("p"), jen.Id("src").Dot("n")))
+			body = append(body, jen.Op("*").Id("dst").Op("=").Add(goType).Parens(
+				jen.Qual("C", "GoStringN").Call(jen.Id("src").Dot("p"), jen.Qual("C", "int").Parens(jen.Id("src").Dot("n")))))
+		case *ast.SelectorExpr:
+			body = append(body,
+				jen.Var().Id("value").Add(g.goTypeCode(fast, t)),
+				g.convertFromCCode(fast, t, jen.Parens(jen.Op("*").Add(g.cTypeCode(fast, t, false))).
+					Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Id("src"))),
+					jen.Id("value"), jen.Op("&").Id("value"), false, outFile),
+				jen.Op("*").Id("dst").Op("=").Add(goType).Parens(jen.Id("value")))
+		case *ast.ArrayType:
+			elemType := g.cTypeCode(fast, t.Elt, useHandles)
+			if t.Len == nil {
+				body = append(body,
+					g.getNullDataCheckCode(jen.Id("src").Dot("data"), jen.Id("src").Dot("len")),
+					jen.Id("n").Op(":=").Id("int").Parens(jen.Id("src").Dot("len")),
+					jen.Op("*").Id("dst").Op("=").Make(goType, jen.Id("n")),
+					jen.Var().Id("elem").Add(elemType),
+					jen.For(jen.Id("i").Op(":=").Lit(0), jen.Id("i").Op("<").Id("n"), jen.Id("i").Op("++")).Block(
+						g.convertFromCCode(fast, t.Elt, cArrayElemCode(jen.Id("src").Dot("data"), "i", elemType),
+							jen.Parens(jen.Op("*").Id("dst")).Index(jen.Id("i")),
+							jen.Op("&").Parens(jen.Op("*").Id("dst")).Index(jen.Id("i")), useHandles, outFile)))
+			} else {
+				body = append(body,
+					jen.For(jen.Id("i").Op(":=").Range().Id("src")).Block(
+						g.convertFromCCode(fast, t.Elt, jen.Op("&").Id("src").Index(jen.Id("i")),
+							jen.Id("dst").Index(jen.Id("i")), jen.Op("&").Id("dst").Index(jen.Id("i")), useHandles, outFile)))
+			}
+		case *ast.StarExpr:
+			key := jen.Qual("unsafe", "Pointer").Parens(jen.Op("*").Id("src"))
+			body = append(body,
+				jen.If(jen.Op("*").Id("src").Op("==").Nil()).Block(
+					jen.Op("*").Id("dst").Op("=").Nil(),
+					jen.Return(jen.Lit(0))),
+				jen.If(jen.List(jen.Id("obj"), jen.Id("found")).Op(":=").Id("seen").Index(key), jen.Id("found")).Block(
+					jen.Op("*").Id("dst").Op("=").Parens(goType).Parens(jen.Id("obj")),
+					jen.Return(jen.Lit(0))),
+				jen.Id("obj").Op(":=").New(g.goTypeCode(fast, t.X)),
+				jen.Id("seen").Index(key).Op("=").Qual("unsafe", "Pointer").Parens(jen.Id("obj")),
+				g.convertFromCCode(fast, t.X, jen.Op("*").Id("src"), jen.Op("*").Id("obj"), jen.Id("obj"), false, outFile),
+				jen.Op("*").Id("dst").Op("=").Id("obj"))
+		case *ast.StructType:
+			for _, member := range g.structMembers(fast, t) {
+				if member.handle != "" {
+					body = append(body, g.handleFromCCode(member))
+					continue
+				}
+				body = append(body, g.convertFromCCode(fast, member.typeExpr, jen.Op("&").Id("src").Dot(member.cName),
+					jen.Id("dst").Dot(member.goName()), jen.Op("&").Id("dst").Dot(member.goName()), false, outFile))
+			}
+		}
+	}
+	body = append(body, jen.Return(jen.Lit(0)))
+	outFile.Func().Id(helper).Params(g.helperParams(fast, typeExpr, useHandles,
+		jen.Id("src").Op("*").Add(g.cTypeCode(fast, typeExpr, useHandles)),
+		jen.Id("dst").Op("*").Add(goType))...).Id("uint32").Block(body...)
+	return helper
+}
+
+// Adds to the output file the helper converting a Go value of the type into a C value
+func (g *Generator) addToCHelper(fast *ast.File, typeExpr ast.Expr, useHandles bool, outFile *jen.File) string {
+	helper := g.toCHelperName(fast, g.mangleTypeName(fast, typeExpr, useHandles))
+	generatedHelpers := g.jobOf(fast).generatedHelpers
+	if generatedHelpers[helper] {
+		return helper
+	}
+	generatedHelpers[helper] = true
+	var body []jen.Code
+	if converter := g.findConverter(fast, typeExpr); converter != nil {
+		body = append(body, g.converterTemplateCode(converter.GoType, converter.ToC))
+	} else if key, isHandle := g.handleTypeKey(fast, typeExpr); isHandle && useHandles {
+		register := "register" + g.handleTypes[key] + "Handle"
+		if _, isStar := (typeExpr).(*ast.StarExpr); isStar {
+			body = append(body, jen.Op("*").Id("dst").Op("=").Id(register).Call(jen.Op("*").Id("src")))
+		} else {
+			body = append(body,
+				jen.Id("obj").Op(":=").Op("*").Id("src"),
+				jen.Op("*").Id("dst").Op("=").Id(register).Call(jen.Op("&").Id("obj")))
+		}
+	} else {
+		switch t := g.underlyingTypeExpr(fast, typeExpr).(type) {
+		case *ast.Ident:
+			body = append(body,
+				jen.Id("dst").Dot("p").Op("=").Qual("C", "CString").Call(jen.Id("string").Parens(jen.Op("*").Id("src"))),
+				jen.Id("dst").Dot("n").Op("=").Qual("C", "GoInt_").Parens(jen.Len(jen.Op("*").Id("src"))))
+		case *ast.SelectorExpr:
+			body = append(body,
+				jen.Id("value").Op(":=").Add(g.goTypeCode(fast, t)).Parens(jen.Op("*").Id("src")),
+				g.convertToCCode(fast, t, jen.Op("&").Id("value"), nil,
+					jen.Parens(jen.Op("*").Add(g.cTypeCode(fast, t, false))).
+						Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Id("dst"))), false, outFile))
+		case *ast.ArrayType:
+			elemType := g.cTypeCode(fast, t.Elt, useHandles)
+			if t.Len == nil {
+				body = append(body,
+					jen.Id("n").Op(":=").Len(jen.Op("*").Id("src")),
+					jen.Id("dst").Dot("len").Op("=").Qual("C", "GoInt_").Parens(jen.Id("n")),
+					jen.Id("dst").Dot("cap").Op("=").Qual("C", "GoInt_").Parens(jen.Id("n")),
+					jen.Id("dst").Dot("data").Op("=").Nil(),
+					jen.If(jen.Id("n").Op("==").Lit(0)).Block(jen.Return()),
+					jen.Var().Id("elem").Add(elemType),
+					jen.Id("dst").Dot("data").Op("=").Qual("C", "calloc").Call(jen.Qual("C", "size_t").Parens(jen.Id("n")),
+						jen.Qual("C", "size_t").Parens(jen.Qual("unsafe", "Sizeof").Parens(jen.Id("elem")))),
+					jen.For(jen.Id("i").Op(":=").Range().Op("*").Id("src")).Block(
+						g.convertToCCode(fast, t.Elt, jen.Op("&").Parens(jen.Op("*").Id("src")).Index(jen.Id("i")),
+							jen.Op("*").Add(cArrayElemCode(jen.Id("dst").Dot("data"), "i", elemType)),
+							cArrayElemCode(jen.Id("dst").Dot("data"), "i", elemType), useHandles, outFile)))
+			} else {
+				body = append(body,
+					jen.For(jen.Id("i").Op(":=").Range().Id("src")).Block(
+						g.convertToCCode(fast, t.Elt, jen.Op("&").Id("src").Index(jen.Id("i")),
+							jen.Id("dst").Index(jen.Id("i")), jen.Op("&").Id("dst").Index(jen.Id("i")), useHandles, outFile)))
+			}
+		case *ast.StarExpr:
+			elemType := g.cTypeCode(fast, t.X, false)
+			key := jen.Qual("unsafe", "Pointer").Parens(jen.Op("*").Id("src"))
+			body = append(body,
+				jen.If(jen.Op("*").Id("src").Op("==").Nil()).Block(
+					jen.Op("*").Id("dst").Op("=").Nil(),
+					jen.Return()),
+				jen.If(jen.List(jen.Id("obj"), jen.Id("found")).Op(":=").Id("seen").Index(key), jen.Id("found")).Block(
+					jen.Op("*").Id("dst").Op("=").Parens(jen.Op("*").Add(elemType)).Parens(jen.Id("obj")),
+					jen.Return()),
+				jen.Var().Id("elem").Add(elemType),
+				jen.Id("obj").Op(":=").Parens(jen.Op("*").Add(elemType)).Parens(jen.Qual("C", "calloc").Call(jen.Lit(1),
+					jen.Qual("C", "size_t").Parens(jen.Qual("unsafe", "Sizeof").Parens(jen.Id("elem"))))),
+				jen.Id("seen").Index(key).Op("=").Qual("unsafe", "Pointer").Parens(jen.Id("obj")),
+				g.convertToCCode(fast, t.X, jen.Op("*").Id("src"), jen.Op("*").Id("obj"), jen.Id("obj"), false, outFile),
+				jen.Op("*").Id("dst").Op("=").Id("obj"))
+		case *ast.StructType:
+			for _, member := range g.structMembers(fast, t) {
+				if member.handle != "" {
+					body = append(body, handleToCCode(member))
+					continue
+				}
+				body = append(body, g.convertToCCode(fast, member.typeExpr, jen.Op("&").Id("src").Dot(member.goName()),
+					jen.Id("dst").Dot(member.cName), jen.Op("&").Id("dst").Dot(member.cName), false, outFile))
+			}
+		}
+	}
+	outFile.Func().Id(helper).Params(g.helperParams(fast, typeExpr, useHandles,
+		jen.Id("src").Op("*").Add(g.goTypeCode(fast, typeExpr)),
+		jen.Id("dst").Op("*").Add(g.cTypeCode(fast, typeExpr, useHandles)))...).Block(body...)
+	return helper
+}
+
+func (g *Generator) freeCHelperName(fast *ast.File, mangled string) string {
+	return "freeC_" + helperFileTag(g.jobOf(fast).path) + packageSeparator + mangled
+}
+
+// Returns true when the copyToC_ helper of the type allocates C memory
+func (g *Generator) allocatesCMemory(fast *ast.File, typeExpr ast.Expr, useHandles bool) bool {
+	return g.allocatesCMemoryExpr(fast, typeExpr, useHandles, make(map[string]bool))
+}
+
+func (g *Generator) allocatesCMemoryExpr(fast *ast.File, typeExpr ast.Expr, useHandles bool, visiting map[string]bool) bool {
+	if converter := g.findConverter(fast, typeExpr); converter != nil {
+		return converter.Free != ""
+	}
+	if _, isHandle := g.handleTypeKey(fast, typeExpr); isHandle && useHandles {
+		return false
+	}
+	if g.isFlatType(fast, typeExpr) {
+		return false
+	}
+	if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent {
+		if visiting[identExpr.Name] {
+			return false
+		}
+		visiting[identExpr.Name] = true
+		defer delete(visiting, identExpr.Name)
+	}
+	switch t := g.underlyingTypeExpr(fast, typeExpr).(type) {
+	case *ast.Ident:
+		return t.Name == "string"
+	case *ast.SelectorExpr:
+		return g.allocatesCMemoryExpr(fast, t, false, visiting)
+	case *ast.ArrayType:
+		return t.Len == nil || g.allocatesCMemoryExpr(fast, t.Elt, useHandles, visiting)
+	case *ast.StarExpr:
+		return true
+	case *ast.StructType:
+		for _, member := range g.structMembers(fast, t) {
+			if member.handle == "" && g.allocatesCMemoryExpr(fast, member.typeExpr, false, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns a statement freeing the C memory allocated for the C value addressed by dstPtr, nil if there is none
+func (g *Generator) freeCCode(fast *ast.File, typeExpr ast.Expr, dstPtr jen.Code, useHandles bool, outFile *jen.File) jen.Code {
+	if !g.allocatesCMemory(fast, typeExpr, useHandles) {
+		return nil
+	}
+	return jen.Id(g.addFreeCHelper(fast, typeExpr, useHandles, outFile)).
+		Call(append([]jen.Code{dstPtr}, g.seenArgs(fast, typeExpr, useHandles, false)...)...)
+}
+
+// Adds to the output file the helper freeing the C memory allocated by the copyToC_ helper of the type
+func (g *Generator) addFreeCHelper(fast *ast.File, typeExpr ast.Expr, useHandles bool, outFile *jen.File) string {
+	helper := g.freeCHelperName(fast, g.mangleTypeName(fast, typeExpr, useHandles))
+	generatedHelpers := g.jobOf(fast).generatedHelpers
+	if generatedHelpers[helper] {
+		return helper
+	}
+	generatedHelpers[helper] = true
+	var body []jen.Code
+	addFree := func(code jen.Code) {
+		if code != nil {
+			body = append(body, code)
+		}
+	}
+	if converter := g.findConverter(fast, typeExpr); converter != nil {
+		body = append(body, g.converterTemplateCode(converter.GoType, converter.Free))
+	} else {
+		switch t := g.underlyingTypeExpr(fast, typeExpr).(type) {
+		case *ast.Ident:
+			body = append(body,
+				jen.Qual("C", "free").Call(jen.Qual("unsafe", "Pointer").Parens(jen.Id("dst").Dot("p"))),
+				jen.Id("dst").Dot("p").Op("=").Nil(),
+				jen.Id("dst").Dot("n").Op("=").Lit(0))
+		case *ast.SelectorExpr:
+			addFree(g.freeCCode(fast, t, jen.Parens(jen.Op("*").Add(g.cTypeCode(fast, t, false))).
+				Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Id("dst"))), false, outFile))
+		case *ast.ArrayType:
+			elemType := g.cTypeCode(fast, t.Elt, useHandles)
+			if t.Len == nil {
+				if g.allocatesCMemory(fast, t.Elt, useHandles) {
+					body = append(body,
+						jen.Var().Id("elem").Add(elemType),
+						jen.For(jen.Id("i").Op(":=").Lit(0), jen.Id("i").Op("<").Id("int").Parens(jen.Id("dst").Dot("len")),
+							jen.Id("i").Op("++")).Block(
+							g.freeCCode(fast, t.Elt, cArrayElemCode(jen.Id("dst").Dot("data"), "i", elemType), useHandles, outFile)))
+				}
+				body = append(body,
+					jen.Qual("C", "free").Call(jen.Id("dst").Dot("data")),
+					jen.Id("dst").Dot("data").Op("=").Nil(),
+					jen.Id("dst").Dot("len").Op("=").Lit(0),
+					jen.Id("dst").Dot("cap").Op("=").Lit(0))
+			} else {
+				body = append(body,
+					jen.For(jen.Id("i").Op(":=").Range().Id("dst")).Block(
+						g.freeCCode(fast, t.Elt, jen.Op("&").Id("dst").Index(jen.Id("i")), useHandles, outFile)))
+			}
+		case *ast.StarExpr:
+			// Values pointed to several times are freed once, the pointers to them are cleared
+			key := jen.Qual("unsafe", "Pointer").Parens(jen.Op("*").Id("dst"))
+			body = append(body,
+				jen.If(jen.Op("*").Id("dst").Op("==").Nil()).Block(jen.Return()),
+				jen.If(jen.List(jen.Id("_"), jen.Id("found")).Op(":=").Id("seen").Index(key), jen.Id("found")).Block(
+					jen.Op("*").Id("dst").Op("=").Nil(),
+					jen.Return()),
+				jen.Id("seen").Index(key).Op("=").Nil())
+			addFree(g.freeCCode(fast, t.X, jen.Op("*").Id("dst"), false, outFile))
+			body = append(body,
+				jen.Qual("C", "free").Call(jen.Qual("unsafe", "Pointer").Parens(jen.Op("*").Id("dst"))),
+				jen.Op("*").Id("dst").Op("=").Nil())
+		case *ast.StructType:
+			for _, member := range g.structMembers(fast, t) {
+				if member.handle == "" {
+					addFree(g.freeCCode(fast, member.typeExpr, jen.Op("&").Id("dst").Dot(member.cName), false, outFile))
+				}
+			}
+		}
+	}
+	outFile.Func().Id(helper).Params(g.helperParams(fast, typeExpr, useHandles,
+		jen.Id("dst").Op("*").Add(g.cTypeCode(fast, typeExpr, useHandles)))...).Block(body...)
+	return helper
+}
+
+// Returns a statement looking up the handle of the C member into its Go field
+func (g *Generator) handleFromCCode(member structMember) jen.Code {
+	obj := jen.Id("obj")
+	if _, isStar := (member.typeExpr).(*ast.StarExpr); !isStar {
+		obj = jen.Op("*").Id("obj")
+	}
+	return jen.If(jen.List(jen.Id("obj"), jen.Id("ok")).Op(":=").Id("lookup"+member.handle+"Handle").
+		Call(jen.Id("src").Dot(member.cName)), jen.Id("ok")).
+		Block(jen.Id("dst").Dot(member.goName()).Op("=").Add(obj)).
+		Else().Block(jen.Return(jen.Id(g.functionPrefix + "_BAD_HANDLE")))
+}
+
+// Returns a statement registering the Go field as the handle of the C member, unless the
+// handle of the member already refers to it. Fields passed by value update the value of the handle.
+func handleToCCode(member structMember) jen.Code {
+	register := jen.Id("register" + member.handle + "Handle")
+	lookup := jen.List(jen.Id("obj"), jen.Id("ok")).Op(":=").Id("lookup" + member.handle + "Handle").
+		Call(jen.Id("dst").Dot(member.cName))
+	if _, isStar := (member.typeExpr).(*ast.StarExpr); isStar {
+		return jen.If(lookup, jen.Op("!").Id("ok").Op("||").Id("obj").Op("!=").Id("src").Dot(member.goName())).Block(
+			jen.Id("dst").Dot(member.cName).Op("=").Add(register).Call(jen.Id("src").Dot(member.goName())))
+	}
+	return jen.If(lookup, jen.Id("ok")).Block(
+		jen.Op("*").Id("obj").Op("=").Id("src").Dot(member.goName()),
+	).Else().Block(
+		jen.Id("obj").Op(":=").Id("src").Dot(member.goName()),
+		jen.Id("dst").Dot(member.cName).Op("=").Add(register).Call(jen.Op("&").Id("obj")))
+}
+
+// Returns true when the C value of the type holds members passed as handles
+func (g *Generator) holdsHandleMembers(fast *ast.File, typeExpr ast.Expr) bool {
+	return g.holdsHandleMembersExpr(fast, typeExpr, make(map[string]bool))
+}
+
+func (g *Generator) holdsHandleMembersExpr(fast *ast.File, typeExpr ast.Expr, visiting map[string]bool) bool {
+	if g.findConverter(fast, typeExpr) != nil || g.isFlatType(fast, typeExpr) {
+		return false
+	}
+	if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent {
+		if visiting[identExpr.Name] {
+			return false
+		}
+		visiting[identExpr.Name] = true
+		defer delete(visiting, identExpr.Name)
+	}
+	switch t := g.underlyingTypeExpr(fast, typeExpr).(type) {
+	case *ast.ArrayType:
+		return g.holdsHandleMembersExpr(fast, t.Elt, visiting)
+	case *ast.StarExpr:
+		return g.holdsHandleMembersExpr(fast, t.X, visiting)
+	case *ast.StructType:
+		for _, member := range g.structMembers(fast, t) {
+			if member.handle != "" || g.holdsHandleMembersExpr(fast, member.typeExpr, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the expression pointing to the C value of a wrapper parameter
+func deepParamCCode(fast *ast.File, typeExpr ast.Expr, name string, isPointer bool) jen.Code {
+	if arrayExpr, isArray := (typeExpr).(*ast.ArrayType); isArray && arrayExpr.Len == nil {
+		argCode := jen.Id(name)
+		if !isPointer {
+			argCode = jen.Op("&").Id(name)
+		}
+		return jen.Parens(jen.Op("*").Qual("C", "GoSlice_")).Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
+	}
+	return jen.Id(name)
+}
+
+/*Returns jen code to deep convert an input parameter from wrapper to original function*/
+func (g *Generator) getDeepConvertInParameterCode(fast *ast.File, typeExpr ast.Expr, name string, isPointer bool,
+	outFile *jen.File) []jen.Code {
+	helper := g.addFromCHelper(fast, typeExpr, true, outFile)
+	g.jobOf(fast).inputHelpers[argName(name)] = strings.TrimPrefix(helper, "copyFromC_")
+	varName := name
+	if isPointer {
+		varName = "__" + name
+	}
+	args := append([]jen.Code{deepParamCCode(fast, typeExpr, argName(name), false), jen.Op("&").Id(varName)},
+		g.seenArgs(fast, typeExpr, true, true)...)
+	code := jenCodeToArray(
+		jen.Var().Id(varName).Add(g.goTypeCode(fast, typeExpr)),
+		jen.If(jen.Id(returnVarName).Op("=").Id(helper).Call(args...),
+			jen.Id(returnVarName).Op("!=").Lit(0)).Block(jen.Return()))
+	if isPointer {
+		code = append(code, jen.Id(name).Op(":=").Op("&").Id(varName))
+	}
+	return code
+}
+
+/*Returns jen code to deep convert an output parameter from original to wrapper function*/
+func (g *Generator) getDeepConvertOutParameterCode(fast *ast.File, typeExpr ast.Expr, name string, isPointer bool,
+	outFile *jen.File) jen.Code {
+	helper := g.addToCHelper(fast, typeExpr, true, outFile)
+	dst := deepParamCCode(fast, typeExpr, name, true)
+	g.addAllocatedOutput(fast, typeExpr, name, dst, outFile)
+	seen := g.seenArgs(fast, typeExpr, true, true)
+	var code []jen.Code
+	if arrayExpr, isArray := (typeExpr).(*ast.ArrayType); !(isArray && arrayExpr.Len == nil) &&
+		g.holdsHandleMembers(fast, typeExpr) {
+		// Handles left in the output by the caller aren't reused
+		code = append(code, jen.Op("*").Add(dst).Op("=").Add(g.cTypeCode(fast, typeExpr, true)).Values())
+	}
+	if isPointer {
+		code = append(code, jen.Id(helper).Call(append([]jen.Code{jen.Id(argName(name)), dst}, seen...)...))
+		return jen.If(jen.Id(argName(name)).Op("!=").Nil()).Block(code...)
+	}
+	code = append(code, jen.Id(helper).Call(append([]jen.Code{jen.Op("&").Id(argName(name)), dst}, seen...)...))
+	if len(code) > 1 {
+		return jen.Block(code...)
+	}
+	return code[0]
+}
+
+// Returns true when an input of the type passed by pointer is copied back into C memory after the call
+func (g *Generator) copiesBack(fast *ast.File, typeExpr ast.Expr) bool {
+	return g.needsDeepConversion(fast, typeExpr) && !g.convertsPointers(fast, typeExpr, true)
+}
+
+// Returns jen code to copy back into C memory an input parameter passed by pointer. The C memory
+// it holds, copied to Go, is freed first.
+func (g *Generator) getDeepCopyBackCode(fast *ast.File, typeExpr ast.Expr, name string, outFile *jen.File) []jen.Code {
+	helper := g.addToCHelper(fast, typeExpr, true, outFile)
+	dst := deepParamCCode(fast, typeExpr, argName(name), true)
+	var code []jen.Code
+	if g.allocatesCMemory(fast, typeExpr, true) {
+		code = append(code, jen.Id(g.addFreeCHelper(fast, typeExpr, true, outFile)).
+			Call(append([]jen.Code{dst}, g.seenArgs(fast, typeExpr, true, true)...)...))
+	}
+	g.addAllocatedOutput(fast, typeExpr, argName(name), dst, outFile)
+	return append(code, jen.Id(helper).Call(append([]jen.Code{jen.Id(name), dst}, g.seenArgs(fast, typeExpr, true, true)...)...))
+}
+
+// Returns the input parameters of the wrapper being generated copied back into C memory it allocates
+func (g *Generator) updatedInPlace(fast *ast.File, params []wrapperParam) []string {
+	var names []string
+	for _, param := range g.allocatedParams(fast, params) {
+		if !param.isOutput {
+			names = append(names, param.name)
+		}
+	}
+	return names
+}
+
+// Parameter of the wrapper being generated filled by a copyToC_ helper
+type allocatedOutput struct {
+	name     string
+	freeCode jen.Code
+}
+
+// Records the parameter name of the wrapper being generated, filled by the copyToC_ helper of the
+// type, to be freed by the Free function of the wrapper
+func (g *Generator) addAllocatedOutput(fast *ast.File, typeExpr ast.Expr, name string, dst jen.Code, outFile *jen.File) {
+	if !g.allocatesCMemory(fast, typeExpr, true) {
+		return
+	}
+	freeCode := jen.Id(g.addFreeCHelper(fast, typeExpr, true, outFile)).
+		Call(append([]jen.Code{dst}, g.seenArgs(fast, typeExpr, true, true)...)...)
+	job := g.jobOf(fast)
+	job.allocatedOutputs = append(job.allocatedOutputs, allocatedOutput{name,
+		jen.If(jen.Id(name).Op("!=").Nil()).Block(freeCode)})
+}
+
+// Returns the parameters of the wrapper being generated filled by copyToC_ helpers,
+// the parameters of its Free function
+func (g *Generator) allocatedParams(fast *ast.File, params []wrapperParam) []wrapperParam {
+	var allocated []wrapperParam
+	for _, output := range g.jobOf(fast).allocatedOutputs {
+		for _, param := range params {
+			if param.name == output.name {
+				allocated = append(allocated, param)
+				break
+			}
+		}
+	}
+	return allocated
+}
+
+// Adds the function freeing the outputs of the wrapper cfuncName allocated by copyToC_ helpers
+func (g *Generator) addFreeOutputsFunc(fast *ast.File, outFile *jen.File, cfuncName string, params []wrapperParam) {
+	var freeParams []jen.Code
+	var body []jen.Code
+	for _, param := range g.allocatedParams(fast, params) {
+		freeParams = append(freeParams, jen.Id(param.name).Id(param.typeName))
+		for _, output := range g.jobOf(fast).allocatedOutputs {
+			if output.name == param.name {
+				body = append(body, output.freeCode)
+			}
+		}
+	}
+	freeName := cfuncName + "_Free"
+	outFile.Comment("Frees the C memory allocated for the outputs of " + cfuncName)
+	outFile.Comment("export " + freeName) //nolint staticcheck
+	outFile.Func().Id(freeName).Params(freeParams...).Block(body...)
+}
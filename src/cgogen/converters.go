@@ -0,0 +1,215 @@
+package cgogen
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/dave/jennifer/jen"
+)
+
+/*
+TypeConverter declares how values of a Go type cross the C boundary.
+
+GoType is the type qualified by its import path, e.g. "time.Time" or
+"*math/big.Int". CType is the C type used in headers and wrapper signatures.
+ToC, FromC and Free are text/template bodies of the generated helpers
+
+	func copyToC_...(src *<Go type>, dst *C.<CType>)
+	func copyFromC_...(src *C.<CType>, dst *<Go type>) uint32
+	func freeC_...(dst *C.<CType>)
+
+Free releases the C memory allocated by ToC, and is empty when there is none.
+
+Templates reference Go identifiers of other packages with {{qual "path" "Name"}}
+so the wrapper file imports them, and {{.Prefix}} expands to the functions prefix.
+FromC templates return a non-zero error code when the C value is invalid.
+*/
+type TypeConverter struct {
+	GoType string `json:"go_type"`
+	CType  string `json:"c_type"`
+	ToC    string `json:"to_c"`
+	FromC  string `json:"from_c"`
+	Free   string `json:"free"`
+}
+
+// Free template of converters allocating a GoString_
+const freeStringTemplate = `C.free({{qual "unsafe" "Pointer"}}(dst.p))
+dst.p = nil
+dst.n = 0`
+
+// Converters shipped with cgogen for common types of the standard library
+var builtinConverters = []TypeConverter{
+	// Times keep their instant and the offset of their zone, which comes back as a fixed zone
+	{
+		GoType: "time.Time",
+		CType:  "GoTime_",
+		ToC: `_, offset := src.Zone()
+dst.sec = C.GoInt64_(src.Unix())
+dst.nsec = C.GoInt32_(src.Nanosecond())
+dst.offset = C.GoInt32_(offset)`,
+		FromC: `if src.nsec < 0 || src.nsec >= 1000000000 {
+	return {{.Prefix}}_ERROR
+}
+t := {{qual "time" "Unix"}}(int64(src.sec), int64(src.nsec)).UTC()
+if src.offset != 0 {
+	t = t.In({{qual "time" "FixedZone"}}("", int(src.offset)))
+}
+*dst = t`,
+	},
+	{
+		GoType: "time.Duration",
+		CType:  "GoInt64_",
+		ToC:    `*dst = C.GoInt64_(*src)`,
+		FromC:  `*dst = {{qual "time" "Duration"}}(*src)`,
+	},
+	{
+		GoType: "*math/big.Int",
+		CType:  "GoString_",
+		ToC: `s := ""
+if *src != nil {
+	s = (*src).String()
+}
+dst.p = C.CString(s)
+dst.n = C.GoInt_(len(s))`,
+		FromC: `if src.n == 0 {
+	*dst = nil
+	return 0
+}
+n, ok := new({{qual "math/big" "Int"}}).SetString(C.GoStringN(src.p, C.int(src.n)), 10)
+if !ok {
+	return {{.Prefix}}_ERROR
+}
+*dst = n`,
+		Free: freeStringTemplate,
+	},
+	{
+		GoType: "net.IP",
+		CType:  "GoString_",
+		ToC: `s := ""
+if len(*src) != 0 {
+	s = src.String()
+}
+dst.p = C.CString(s)
+dst.n = C.GoInt_(len(s))`,
+		FromC: `if src.n == 0 {
+	*dst = nil
+	return 0
+}
+ip := {{qual "net" "ParseIP"}}(C.GoStringN(src.p, C.int(src.n)))
+if ip == nil {
+	return {{.Prefix}}_ERROR
+}
+*dst = ip`,
+		Free: freeStringTemplate,
+	},
+}
+
+func (g *Generator) registerConverter(converter TypeConverter) {
+	g.typeConverters[converter.GoType] = &converter
+}
+
+func (g *Generator) registerBuiltinConverters() {
+	for _, converter := range builtinConverters {
+		g.registerConverter(converter)
+	}
+}
+
+// Loads project converters from a JSON file holding a list of converters
+func (g *Generator) loadConvertersFile(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var converters []TypeConverter
+	if err := json.Unmarshal(contents, &converters); err != nil {
+		return err
+	}
+	for _, converter := range converters {
+		g.applog("Loaded converter for %s", converter.GoType)
+		g.registerConverter(converter)
+	}
+	return nil
+}
+
+// Returns the Go type qualified by import path, as written in converters
+func (g *Generator) qualifiedTypeName(fast *ast.File, typeExpr ast.Expr) string {
+	switch t := typeExpr.(type) {
+	case *ast.StarExpr:
+		name := g.qualifiedTypeName(fast, t.X)
+		if name == "" {
+			return ""
+		}
+		return "*" + name
+	case *ast.Ident:
+		if IsBasicGoType(t.Name) {
+			return ""
+		}
+		return g.packageImportPath(fast) + "." + t.Name
+	case *ast.SelectorExpr:
+		if identExpr, isIdent := (t.X).(*ast.Ident); isIdent {
+			if importPath, found := fileImportPath(fast, identExpr.Name); found {
+				return importPath + "." + t.Sel.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Returns the converter registered for the type, if any
+func (g *Generator) findConverter(fast *ast.File, typeExpr ast.Expr) *TypeConverter {
+	if len(g.typeConverters) == 0 {
+		return nil
+	}
+	name := g.qualifiedTypeName(fast, typeExpr)
+	if name == "" {
+		return nil
+	}
+	if converter, found := g.typeConverters[name]; found {
+		return converter
+	}
+	// Types of the wrapped package may also be given by package name
+	prefix := ""
+	if starExpr, isStar := (typeExpr).(*ast.StarExpr); isStar {
+		typeExpr = starExpr.X
+		prefix = "*"
+	}
+	if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent {
+		return g.typeConverters[prefix+fast.Name.Name+"."+identExpr.Name]
+	}
+	return nil
+}
+
+// Marker delimiting qualified identifiers in expanded templates
+const qualMarker = "\x00"
+
+// Expands a converter template into jen code
+func (g *Generator) converterTemplateCode(goType string, text string) jen.Code {
+	funcs := template.FuncMap{
+		"qual": func(path string, name string) string {
+			return qualMarker + path + qualMarker + name + qualMarker
+		},
+	}
+	tmpl, err := template.New(goType).Funcs(funcs).Parse(text)
+	if err != nil {
+		g.reportError("Invalid converter template for %s: %v", goType, err)
+		return jen.Null()
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct{ Prefix string }{g.functionPrefix})
+	if err != nil {
+		g.reportError("Invalid converter template for %s: %v", goType, err)
+		return jen.Null()
+	}
+	code := jen.Null()
+	// Parts alternate between raw code and the path and name of a qualified identifier
+	parts := strings.Split(buf.String(), qualMarker)
+	code.Op(parts[0])
+	for i := 1; i+2 < len(parts); i += 3 {
+		code.Qual(parts[i], parts[i+1]).Op(parts[i+2])
+	}
+	return code
+}
@@ -0,0 +1,309 @@
+package cgogen
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+/*
+The coverage report lists every exported function, method and type of the
+sources, whether it was wrapped, and otherwise why not along with the
+parameter, field or type at fault. With -cov it is saved as JSON, with
+-covtxt as text.
+*/
+
+const (
+	coverageFunction = "function"
+	coverageMethod   = "method"
+	coverageType     = "type"
+)
+
+// Wrapping of an exported function, method or type
+type coverageEntry struct {
+	Source string `json:"source"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	// Exported C function or C type, when wrapped
+	Symbol  string `json:"symbol,omitempty"`
+	Wrapped bool   `json:"wrapped"`
+	// Why it was not wrapped, or wrapped with types that can't be converted
+	Reason    string `json:"reason,omitempty"`
+	Offending string `json:"offending,omitempty"`
+	Dependant bool   `json:"dependant,omitempty"`
+}
+
+type coverageSummary struct {
+	Total   int `json:"total"`
+	Wrapped int `json:"wrapped"`
+	Skipped int `json:"skipped"`
+}
+
+type coverageReport struct {
+	Summary coverageSummary `json:"summary"`
+	Entries []coverageEntry `json:"entries"`
+}
+
+// Records the wrapping of a function or method of the source file
+func (g *Generator) recordFuncCoverage(fast *ast.File, fdecl *ast.FuncDecl, entry coverageEntry) {
+	entry.Kind = coverageFunction
+	entry.Name = fdecl.Name.Name
+	if fdecl.Recv != nil {
+		entry.Kind = coverageMethod
+		entry.Name = types.ExprString(receiverTypeName(fdecl.Recv.List[0].Type)) + "." + entry.Name
+	}
+	g.recordCoverage(fast, entry)
+}
+
+func (g *Generator) recordCoverage(fast *ast.File, entry coverageEntry) {
+	job := g.jobOf(fast)
+	entry.Source = job.path
+	job.coverage = append(job.coverage, entry)
+}
+
+func receiverTypeName(typeExpr ast.Expr) ast.Expr {
+	if starExpr, isStar := (typeExpr).(*ast.StarExpr); isStar {
+		return starExpr.X
+	}
+	return typeExpr
+}
+
+// Returns the parameter, result or receiver of the function declared by the field, with its type
+func describeField(fdecl *ast.FuncDecl, field *ast.Field) string {
+	var names []string
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	kind := "parameter"
+	if fdecl.Recv != nil && field == fdecl.Recv.List[0] {
+		kind = "receiver"
+	} else if fdecl.Type.Results != nil {
+		for index, result := range fdecl.Type.Results.List {
+			if result == field {
+				kind = "result"
+				if len(names) == 0 {
+					names = append(names, fmt.Sprintf("%d", index))
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return kind + " " + types.ExprString(field.Type)
+	}
+	return kind + " " + strings.Join(names, ", ") + " " + types.ExprString(field.Type)
+}
+
+// Marks the function as depending on the type of field, unless it already is.
+// ok tells whether the wrapper parameter could be generated.
+func (g *Generator) setDependant(entry *coverageEntry, fast *ast.File, fdecl *ast.FuncDecl, field *ast.Field, ok bool,
+	isOutput bool) {
+	if entry.Dependant {
+		return
+	}
+	entry.Dependant = true
+	entry.Reason = "depends on types that can't be converted"
+	if !ok {
+		entry.Reason = g.typeFailureReason(fast, field.Type, isOutput)
+	}
+	entry.Offending = describeField(fdecl, field)
+}
+
+// Returns why a wrapper parameter can't be generated for the type
+func (g *Generator) typeFailureReason(fast *ast.File, typeExpr ast.Expr, isOutput bool) string {
+	if isContextType(fast, typeExpr) {
+		return "context.Context can't be returned"
+	}
+	switch t := typeExpr.(type) {
+	case *ast.StarExpr:
+		return g.typeFailureReason(fast, t.X, isOutput)
+	case *ast.ArrayType:
+		return g.typeFailureReason(fast, t.Elt, isOutput)
+	case *ast.Ellipsis:
+		return g.typeFailureReason(fast, t.Elt, isOutput)
+	case *ast.MapType:
+		return g.typeFailureReason(fast, t.Key, false)
+	case *ast.FuncType:
+		return "function types are not supported"
+	case *ast.InterfaceType:
+		return "interface types are not supported"
+	case *ast.SelectorExpr:
+		if identExpr, isIdent := (t.X).(*ast.Ident); isIdent && !g.isLibName(fast, identExpr.Name) {
+			return "type " + types.ExprString(t) + " of an external package has no handle or converter"
+		}
+	case *ast.Ident:
+		if !IsBasicGoType(t.Name) && !isAsciiUpper(rune(t.Name[0])) {
+			return "unexported type " + t.Name
+		}
+	}
+	return "type " + types.ExprString(typeExpr) + " can't be converted"
+}
+
+// Records the wrapping of the types declared in the source file.
+// emitted holds the declarations whose C types were generated, dependant those depending on types that can't be converted
+// and rejected those with a member declared twice.
+func (g *Generator) recordTypeCoverage(fast *ast.File, typeDecls []*ast.GenDecl, emitted map[*ast.GenDecl]bool,
+	dependant map[*ast.GenDecl]bool, rejected map[*ast.GenDecl]string, definedTypes []string, forwardsDeclarations []string,
+	dependantTypes []string) {
+	type probeResult struct {
+		offending   string
+		ok          bool
+		isDependant bool
+	}
+	for _, typeDecl := range typeDecls {
+		// Types declared together are generated, or not, together
+		results := make(map[*ast.TypeSpec]probeResult)
+		failed, dependantSpec := "", ""
+		for _, typeSpec := range typeSpecsOf(typeDecl) {
+			offending, ok, isDependant := g.probeTypeSpec(fast, typeSpec, definedTypes, forwardsDeclarations,
+				dependantTypes)
+			results[typeSpec] = probeResult{offending, ok, isDependant}
+			if !ok && failed == "" {
+				failed = typeSpec.Name.Name
+			}
+			if isDependant && dependantSpec == "" {
+				dependantSpec = typeSpec.Name.Name
+			}
+		}
+		for _, s := range typeDecl.Specs {
+			typeSpec, isTypeSpec := (s).(*ast.TypeSpec)
+			if !isTypeSpec || !typeSpec.Name.IsExported() {
+				continue
+			}
+			result := results[typeSpec]
+			entry := coverageEntry{Kind: coverageType, Name: typeSpec.Name.Name}
+			if isAliasSpec(typeSpec) {
+				// Wrapped as the type it stands for
+				entry.Wrapped = true
+				entry.Symbol = g.aliasSymbol(fast, typeSpec)
+			} else if member, isRejected := rejected[typeDecl]; isRejected {
+				entry.Reason = "member " + member + " is declared twice"
+				entry.Offending = member
+			} else if emitted[typeDecl] {
+				entry.Wrapped = !(dependant[typeDecl] && g.cfg.IgnoreDependants)
+				if entry.Wrapped {
+					entry.Symbol = fast.Name.Name + packageSeparator + typeSpec.Name.Name
+				}
+				if dependant[typeDecl] {
+					entry.Dependant = true
+					entry.Reason = "depends on types that can't be converted"
+					entry.Offending = result.offending
+					if !result.isDependant && dependantSpec != "" {
+						entry.Reason = "declared in a group with " + dependantSpec +
+							", which depends on types that can't be converted"
+						entry.Offending = dependantSpec
+					}
+				}
+			} else if !result.ok {
+				entry.Reason = "no C type for " + result.offending
+				entry.Offending = result.offending
+			} else {
+				entry.Reason = "declared in a group with " + failed + ", which has no C type"
+				entry.Offending = failed
+			}
+			g.recordCoverage(fast, entry)
+		}
+	}
+}
+
+// Generates the C type of the type spec without keeping it.
+// Returns the field, or the type, that can't be converted or is dependant,
+// whether the C type was generated and whether it is dependant.
+func (g *Generator) probeTypeSpec(fast *ast.File, typeSpec *ast.TypeSpec, definedTypes []string, forwardsDeclarations []string,
+	dependantTypes []string) (string, bool, bool) {
+	probe := func(typeExpr ast.Expr, name string, depth int) (bool, bool) {
+		defined := append([]string(nil), definedTypes...)
+		forwards := append([]string(nil), forwardsDeclarations...)
+		dependants := append([]string(nil), dependantTypes...)
+		_, ok, isDependant := g.processTypeExpression(fast, typeExpr, fast.Name.Name, name, &defined, &forwards, depth,
+			&dependants)
+		return ok, isDependant
+	}
+	if typeStruct, isStruct := (typeSpec.Type).(*ast.StructType); isStruct {
+		for _, member := range g.structMembers(fast, typeStruct) {
+			if member.handle != "" {
+				continue
+			}
+			ok, isDependant := probe(member.typeExpr, member.cName, 2)
+			if !ok || isDependant {
+				return "field " + member.goName() + " " + types.ExprString(member.typeExpr), ok, isDependant
+			}
+		}
+	}
+	ok, isDependant := probe(typeSpec.Type, typeSpec.Name.Name, 1)
+	return types.ExprString(typeSpec.Type), ok, isDependant
+}
+
+// Returns the report of the jobs, in the order of the sources
+func newCoverageReport(jobs []*fileJob) coverageReport {
+	report := coverageReport{Entries: []coverageEntry{}}
+	for _, job := range jobs {
+		for _, entry := range job.coverage {
+			report.Entries = append(report.Entries, entry)
+			report.Summary.Total++
+			if entry.Wrapped {
+				report.Summary.Wrapped++
+			} else {
+				report.Summary.Skipped++
+			}
+		}
+	}
+	return report
+}
+
+func (report coverageReport) JSON() (string, error) {
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(encoded) + "\n", nil
+}
+
+func (report coverageReport) Text() string {
+	var out strings.Builder
+	source := ""
+	for _, entry := range report.Entries {
+		if entry.Source != source {
+			source = entry.Source
+			fmt.Fprintf(&out, "%s\n", source)
+		}
+		status := "wrapped"
+		if !entry.Wrapped {
+			status = "skipped"
+		}
+		fmt.Fprintf(&out, "  %-8s %-8s %s", status, entry.Kind, entry.Name)
+		if entry.Symbol != "" {
+			fmt.Fprintf(&out, " as %s", entry.Symbol)
+		}
+		if entry.Reason != "" {
+			fmt.Fprintf(&out, ": %s", entry.Reason)
+			if entry.Offending != "" && !strings.Contains(entry.Reason, entry.Offending) {
+				fmt.Fprintf(&out, " (%s)", entry.Offending)
+			}
+		}
+		out.WriteString("\n")
+	}
+	percent := 0.0
+	if report.Summary.Total > 0 {
+		percent = 100 * float64(report.Summary.Wrapped) / float64(report.Summary.Total)
+	}
+	fmt.Fprintf(&out, "%d of %d wrapped (%.1f%%), %d skipped\n", report.Summary.Wrapped, report.Summary.Total,
+		percent, report.Summary.Skipped)
+	return out.String()
+}
+
+// Saves the coverage report of the jobs to the files given by -cov and -covtxt
+func (g *Generator) saveCoverageReport(jobs []*fileJob) {
+	report := newCoverageReport(jobs)
+	if g.cfg.CoverageFile != "" {
+		if text, err := report.JSON(); err == nil {
+			g.saveTextToFile(g.cfg.CoverageFile, text)
+		} else {
+			g.reportError("%s: %v", g.cfg.CoverageFile, err)
+		}
+	}
+	if g.cfg.CoverageTextFile != "" {
+		g.saveTextToFile(g.cfg.CoverageTextFile, report.Text())
+	}
+}
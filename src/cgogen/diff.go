@@ -0,0 +1,188 @@
+package cgogen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines of context around the changes of a unified diff
+const diffContext = 3
+
+// Line of a diff, kind is ' ' for a line kept, '-' for a line removed and '+' for a line added
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// Returns the lines of text, keeping their line ends
+func splitLines(text string) []string {
+	var lines []string
+	for len(text) > 0 {
+		end := strings.IndexByte(text, '\n') + 1
+		if end == 0 {
+			end = len(text)
+		}
+		lines = append(lines, text[:end])
+		text = text[end:]
+	}
+	return lines
+}
+
+// Returns the shortest edit script turning lines a into lines b, using the Myers algorithm
+func diffLines(a []string, b []string) []diffLine {
+	// Common prefix and suffix are kept as they are
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var result []diffLine
+	for _, line := range a[:prefix] {
+		result = append(result, diffLine{' ', line})
+	}
+	result = append(result, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		result = append(result, diffLine{' ', line})
+	}
+	return result
+}
+
+func diffMiddle(a []string, b []string) []diffLine {
+	var result []diffLine
+	if len(a) == 0 || len(b) == 0 {
+		for _, line := range a {
+			result = append(result, diffLine{'-', line})
+		}
+		for _, line := range b {
+			result = append(result, diffLine{'+', line})
+		}
+		return result
+	}
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	d := 0
+search:
+	for ; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+	// Edits are found backwards from the end of both lists
+	x, y := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			result = append(result, diffLine{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			result = append(result, diffLine{'+', b[y]})
+		} else {
+			x--
+			result = append(result, diffLine{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		result = append(result, diffLine{' ', a[x]})
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// Returns the unified diff turning text from into text to, empty if they are equal
+func unifiedDiff(fromName string, toName string, from string, to string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+	// Numbers of the lines of both texts before each line of the diff
+	fromLines := make([]int, len(lines)+1)
+	toLines := make([]int, len(lines)+1)
+	for i, line := range lines {
+		fromLines[i+1], toLines[i+1] = fromLines[i], toLines[i]
+		if line.kind != '+' {
+			fromLines[i+1]++
+		}
+		if line.kind != '-' {
+			toLines[i+1]++
+		}
+	}
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Changes closer than twice the context share a hunk
+		last := i
+		for j := i; j < len(lines) && j-last <= 2*diffContext; j++ {
+			if lines[j].kind != ' ' {
+				last = j
+			}
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		stop := last + diffContext + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(fromLines[start], fromLines[stop]),
+			hunkRange(toLines[start], toLines[stop]))
+		for _, line := range lines[start:stop] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return out.String()
+}
+
+// Returns the range of lines of a hunk, the line before it when empty
+func hunkRange(start int, stop int) string {
+	count := stop - start
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,122 @@
+package cgogen
+
+import (
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Packages wrapped with go generate hold their settings in //cgogen: directives,
+written in any of their Go files
+
+	//go:generate cgogen
+	//cgogen:flags -prefix SKY -ph cgo/skytypes.gen.h
+	//cgogen:handles Node|Node
+	//cgogen:async Wait
+
+flags takes the command line flags of cgogen, those given in the go:generate
+line override them. handles, types_conversion, slice, inplace, async and smoke
+take the same values as the CGOGEN settings of the type conversion file.
+*/
+
+const directivePrefix = "//cgogen:"
+
+// Settings of the type conversion file allowed as directives, keyed by directive name
+var typeSettingDirectives = map[string]string{
+	"handles":          "CGOGEN HANDLES ",
+	"types_conversion": "CGOGEN TYPES_CONVERSION ",
+	"slice":            "CGOGEN SLICE ",
+	"inplace":          "CGOGEN INPLACE ",
+	"async":            "CGOGEN ASYNC ",
+	"smoke":            "CGOGEN SMOKE ",
+}
+
+// Package wrapped with go generate and the settings of its directives
+type Package struct {
+	Dir        string
+	Name       string
+	ImportPath string
+	// Go files of the package, in the current build context
+	GoFiles []string
+	// Command line arguments of the flags directives
+	Args []string
+	// Type conversion settings of the directives
+	TypeSettings []string
+}
+
+// Loads the package named name in dir and reads its directives
+func LoadPackage(dir string, name string) (*Package, error) {
+	// Import paths are only found from absolute directories
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := build.ImportDir(absDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Name != name {
+		return nil, fmt.Errorf("%s: found package %s instead of %s", dir, pkg.Name, name)
+	}
+	p := &Package{Dir: pkg.Dir, Name: pkg.Name}
+	if !strings.HasPrefix(pkg.ImportPath, ".") {
+		p.ImportPath = pkg.ImportPath
+	}
+	fset := token.NewFileSet()
+	for _, fileName := range pkg.GoFiles {
+		path := filepath.Join(dir, fileName)
+		p.GoFiles = append(p.GoFiles, path)
+		fast, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range fast.Comments {
+			for _, comment := range group.List {
+				if err := p.addDirective(comment.Text); err != nil {
+					return nil, fmt.Errorf("%s: %v", fset.Position(comment.Pos()), err)
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *Package) addDirective(comment string) error {
+	if !strings.HasPrefix(comment, directivePrefix) {
+		return nil
+	}
+	directive := strings.TrimPrefix(comment, directivePrefix)
+	name, value := directive, ""
+	if index := strings.IndexAny(directive, " \t"); index >= 0 {
+		name, value = directive[:index], strings.TrimSpace(directive[index:])
+	}
+	if name == "flags" {
+		p.Args = append(p.Args, strings.Fields(value)...)
+		return nil
+	}
+	setting, found := typeSettingDirectives[name]
+	if !found {
+		return fmt.Errorf("unknown directive %s%s", directivePrefix, name)
+	}
+	p.TypeSettings = append(p.TypeSettings, setting+value)
+	return nil
+}
+
+// Returns the sources of the package with their outputs in outputDir, named
+// after the package and the file as PACKAGE.FILE.go and PACKAGE.FILE.go.h
+func (p *Package) Sources(outputDir string) []Source {
+	sources := make([]Source, 0, len(p.GoFiles))
+	for _, path := range p.GoFiles {
+		name := p.Name + "." + filepath.Base(path)
+		sources = append(sources, Source{
+			Path:         path,
+			OutputFileGO: filepath.Join(outputDir, name),
+			OutputFileCH: filepath.Join(outputDir, name+".h"),
+		})
+	}
+	return sources
+}
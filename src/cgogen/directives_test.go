@@ -0,0 +1,104 @@
+package cgogen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddDirective(t *testing.T) {
+	for _, test := range []struct {
+		comment  string
+		args     []string
+		settings []string
+		err      string
+	}{
+		{comment: "// Not a directive"},
+		{comment: "//go:generate cgogen"},
+		{comment: "//cgogen:flags -prefix SKY  -ph cgo/skytypes.gen.h", args: []string{"-prefix", "SKY", "-ph", "cgo/skytypes.gen.h"}},
+		{comment: "//cgogen:flags"},
+		{comment: "//cgogen:handles Node|Node", settings: []string{"CGOGEN HANDLES Node|Node"}},
+		{comment: "//cgogen:types_conversion Amount|uint64", settings: []string{"CGOGEN TYPES_CONVERSION Amount|uint64"}},
+		{comment: "//cgogen:slice\tEntries", settings: []string{"CGOGEN SLICE Entries"}},
+		{comment: "//cgogen:inplace Buffer ", settings: []string{"CGOGEN INPLACE Buffer"}},
+		{comment: "//cgogen:async Wait", settings: []string{"CGOGEN ASYNC Wait"}},
+		{comment: "//cgogen:smoke Wait,Send", settings: []string{"CGOGEN SMOKE Wait,Send"}},
+		{comment: "//cgogen:unknown Wait", err: "unknown directive //cgogen:unknown"},
+	} {
+		var p Package
+		err := p.addDirective(test.comment)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, want %s", test.comment, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.comment, err)
+		}
+		if !reflect.DeepEqual(p.Args, test.args) {
+			t.Errorf("%q: got arguments %q, want %q", test.comment, p.Args, test.args)
+		}
+		if !reflect.DeepEqual(p.TypeSettings, test.settings) {
+			t.Errorf("%q: got settings %q, want %q", test.comment, p.TypeSettings, test.settings)
+		}
+	}
+}
+
+func TestLoadPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgogen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeBuildFile(t, filepath.Join(dir, "graph.go"), `package graph
+
+//go:generate cgogen
+//cgogen:flags -prefix LIB
+//cgogen:handles Node|Node
+
+type Node struct{}
+`)
+	writeBuildFile(t, filepath.Join(dir, "wait.go"), `package graph
+
+//cgogen:async Wait
+func Wait() {}
+`)
+	writeBuildFile(t, filepath.Join(dir, "wait_test.go"), `package graph
+
+//cgogen:async Ignored
+`)
+
+	if _, err := LoadPackage(dir, "other"); err == nil {
+		t.Error("loaded the package with another name")
+	}
+	p, err := LoadPackage(dir, "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-prefix", "LIB"}; !reflect.DeepEqual(p.Args, want) {
+		t.Errorf("got arguments %q, want %q", p.Args, want)
+	}
+	if want := []string{"CGOGEN HANDLES Node|Node", "CGOGEN ASYNC Wait"}; !reflect.DeepEqual(p.TypeSettings, want) {
+		t.Errorf("got settings %q, want %q", p.TypeSettings, want)
+	}
+	var outputs []string
+	for _, source := range p.Sources("cgo") {
+		outputs = append(outputs, filepath.Base(source.Path)+" "+source.OutputFileGO+" "+source.OutputFileCH)
+	}
+	want := []string{
+		"graph.go " + filepath.Join("cgo", "graph.graph.go") + " " + filepath.Join("cgo", "graph.graph.go.h"),
+		"wait.go " + filepath.Join("cgo", "graph.wait.go") + " " + filepath.Join("cgo", "graph.wait.go.h"),
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("got sources\n%s\nwant\n%s", strings.Join(outputs, "\n"), strings.Join(want, "\n"))
+	}
+
+	writeBuildFile(t, filepath.Join(dir, "bad.go"), "package graph\n\n//cgogen:handle Node\n")
+	if _, err := LoadPackage(dir, "graph"); err == nil || !strings.Contains(err.Error(), "bad.go:3:1") {
+		t.Errorf("got error %v, want the position of the unknown directive", err)
+	}
+}
@@ -0,0 +1,152 @@
+package cgogen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+/*
+Errors and warnings found while generating are collected as diagnostics,
+sorted by position and printed in the format of the Go compiler
+
+	file:line:col: error: message
+
+Generation goes on after an error, so every problem is reported in one run.
+The generation fails if there were errors, or warnings with WarningsAsErrors.
+*/
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+type Diagnostic struct {
+	// Invalid for problems without a position in the sources
+	Pos      token.Position
+	Severity Severity
+	Msg      string
+}
+
+func (d Diagnostic) String() string {
+	if d.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Msg)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, d.Msg)
+}
+
+// Diagnostics of a failed generation, returned as its error
+type Diagnostics []Diagnostic
+
+func (list Diagnostics) Error() string {
+	lines := make([]string, 0, len(list))
+	for _, d := range list {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (g *Generator) addDiagnostic(pos token.Position, sev Severity, msg string, a ...interface{}) {
+	if len(a) > 0 {
+		msg = fmt.Sprintf(msg, a...)
+	}
+	g.diagnosticsLock.Lock()
+	defer g.diagnosticsLock.Unlock()
+	g.diagnostics = append(g.diagnostics, Diagnostic{Pos: pos, Severity: sev, Msg: msg})
+}
+
+// Reports an error without position
+func (g *Generator) reportError(msg string, a ...interface{}) {
+	g.addDiagnostic(token.Position{}, SeverityError, msg, a...)
+}
+
+// Reports a warning without position
+func (g *Generator) reportWarning(msg string, a ...interface{}) {
+	g.addDiagnostic(token.Position{}, SeverityWarning, msg, a...)
+}
+
+// Reports an error at the node of the source file
+func (g *Generator) reportErrorAt(fast *ast.File, node ast.Node, msg string, a ...interface{}) {
+	g.addDiagnostic(g.nodePosition(fast, node), SeverityError, msg, a...)
+}
+
+// Reports a warning at the node of the source file
+func (g *Generator) reportWarningAt(fast *ast.File, node ast.Node, msg string, a ...interface{}) {
+	g.addDiagnostic(g.nodePosition(fast, node), SeverityWarning, msg, a...)
+}
+
+func (g *Generator) nodePosition(fast *ast.File, node ast.Node) token.Position {
+	if job := g.jobOf(fast); job != nil && job.fset != nil {
+		return job.fset.Position(node.Pos())
+	}
+	return token.Position{}
+}
+
+// Reports the errors of parsing a source file, positioned when they come from the parser
+func (g *Generator) reportParseError(err error) {
+	if list, isList := err.(scanner.ErrorList); isList {
+		for _, e := range list {
+			g.addDiagnostic(e.Pos, SeverityError, "%s", e.Msg)
+		}
+		return
+	}
+	g.reportError("%v", err)
+}
+
+// Returns the diagnostics reported, sorted by position.
+// Warnings are errors when treated as errors.
+func (g *Generator) Diagnostics() Diagnostics {
+	return g.diagnosticsSince(0)
+}
+
+func (g *Generator) diagnosticsCount() int {
+	g.diagnosticsLock.Lock()
+	defer g.diagnosticsLock.Unlock()
+	return len(g.diagnostics)
+}
+
+// Returns the diagnostics reported after the first count ones, sorted by position
+func (g *Generator) diagnosticsSince(count int) Diagnostics {
+	g.diagnosticsLock.Lock()
+	defer g.diagnosticsLock.Unlock()
+	list := append(Diagnostics(nil), g.diagnostics[count:]...)
+	if g.cfg.WarningsAsErrors {
+		for i := range list {
+			list[i].Severity = SeverityError
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].Pos, list[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return list
+}
+
+// Returns the diagnostics reported after the first count ones if there are errors among them
+func (g *Generator) errorsSince(count int) error {
+	list := g.diagnosticsSince(count)
+	for _, d := range list {
+		if d.Severity == SeverityError {
+			return list
+		}
+	}
+	return nil
+}
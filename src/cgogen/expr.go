@@ -1,4 +1,4 @@
-package main
+package cgogen
 
 import (
 	"fmt"
@@ -31,7 +31,7 @@ func (c *CCompiler) generateExpression(expr ast.Expr) (code string, resultType s
 		ok = false
 		x := reflect.ValueOf(expr).Elem()
 		typeOfT := x.Type()
-		reportError("Don't know what to do with expression: %s", typeOfT)
+		c.reportErrorAt(expr, "Don't know what to do with expression: %s", typeOfT)
 	}
 	return
 }
@@ -44,16 +44,16 @@ func (c *CCompiler) generateKeyValueExpression(keyValue ast.KeyValueExpr) (code
 			ok = true
 			resultType = typeValue //resultType should be KeyValue
 		} else {
-			reportError("Error generating value in key value expression")
+			c.reportErrorAt(keyValue.Value, "Error generating value in key value expression")
 		}
 	} else {
 		key, typeKey, okKey := c.generateExpression(keyValue.Key)
 		value, typeValue, okValue := c.generateExpression(keyValue.Value)
 		if !okKey {
-			reportError("Couldn't generate map key expression")
+			c.reportErrorAt(keyValue.Key, "Couldn't generate map key expression")
 		}
 		if !okValue {
-			reportError("Couldn't generate map value expression")
+			c.reportErrorAt(keyValue.Value, "Couldn't generate map value expression")
 		}
 		if okKey && okValue {
 			mapKeyCode := getMapTypeKeyword(typeKey)
@@ -81,7 +81,7 @@ func (c *CCompiler) generateIdentExpr(identExpr ast.Ident) (code string, resultT
 		resultType = funcDef.returnType //Return type should be function
 		ok = true
 	} else {
-		reportError("Identifier not found %s", identExpr.Name)
+		c.reportErrorAt(&identExpr, "Identifier not found %s", identExpr.Name)
 	}
 	return
 }
@@ -98,7 +98,7 @@ func (c *CCompiler) generateBinary(binExpr ast.BinaryExpr) (code string, resultT
 				code = fmt.Sprintf("%s %s %s", leftExpr, binExpr.Op, rightExpr)
 			}
 		} else {
-			reportError("Applying operand %s to different types %s and %s",
+			c.reportErrorAt(binExpr.X, "Applying operand %s to different types %s and %s",
 				binExpr.Op, leftType, rightType)
 		}
 	}
@@ -123,7 +123,7 @@ func (c *CCompiler) generateStringBinary(binExpr ast.BinaryExpr, left string, ri
 		code = fmt.Sprintf("%s(%s,%s)", f, left, right)
 	} else {
 		ok = false
-		reportError("Invalid string operator")
+		c.reportErrorAt(binExpr.X, "Invalid string operator")
 	}
 	return
 }
@@ -133,7 +133,7 @@ func (c *CCompiler) generateLiteral(litExpr ast.BasicLit) (code string, resultTy
 	code = litExpr.Value
 	switch litExpr.Kind {
 	default:
-		reportError("Unknown literal %s", litExpr.Kind)
+		c.reportErrorAt(&litExpr, "Unknown literal %s", litExpr.Kind)
 		ok = false
 	case token.INT:
 		resultType = "GoInt32_"
@@ -158,13 +158,13 @@ func (c *CCompiler) generateCallExpr(callExpr ast.CallExpr) (code string, result
 				argsCode = append(argsCode, argCode)
 			} else {
 				ok = false
-				reportError("Couldn't generate argument %d expression", index+1)
+				c.reportErrorAt(arg, "Couldn't generate argument %d expression", index+1)
 			}
 		}
 		code = fmt.Sprintf("%s( %s )", funcCode, strings.Join(argsCode, ", "))
 		resultType = funcType
 	} else {
-		reportError("Couldn't generate call expression")
+		c.reportErrorAt(callExpr.Fun, "Couldn't generate call expression")
 	}
 	return
 }
@@ -196,7 +196,7 @@ func (c *CCompiler) generateCompositeLiteral(compLit ast.CompositeLit) (code str
 				}
 				initializers = append(initializers, codeExpr)
 			} else {
-				reportError("Couldn't generate initializer")
+				c.reportErrorAt(expr, "Couldn't generate initializer")
 			}
 		}
 		initializer := strings.Join(initializers, ",")
@@ -219,10 +219,10 @@ func (c *CCompiler) generateMapInitializer(compLit ast.CompositeLit, maptype str
 				mapfuncset := fmt.Sprintf("Map%s%sSet", tkey, tval)
 				code += fmt.Sprintf("%s(&%s, %s, %s);\n", mapfuncset, varname, key, value)
 			} else {
-				reportError("Couldn't generate with map literal")
+				c.reportErrorAt(keyValue, "Couldn't generate with map literal")
 			}
 		} else {
-			reportError("Non key-value item is map literal")
+			c.reportErrorAt(expr, "Non key-value item is map literal")
 		}
 	}
 	ok = true
@@ -0,0 +1,111 @@
+package cgogen
+
+import (
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Transpiles the Go files of the directory, returns the C code keyed by file name
+func (g *Generator) transpile(sourcedir string) map[string]string {
+	g.applog("Processing dir %s", sourcedir)
+	compilers := make(map[string]*CCompiler)
+	fset := token.NewFileSet()
+	err := traverseDir(sourcedir, func(file string) error {
+		fo, err := os.Open(file)
+		g.applog("opening %s", file)
+		if err != nil {
+			g.reportError("%v", err)
+			return nil
+		}
+		defer fo.Close()
+		fast, err := parser.ParseFile(fset, file, fo, parser.AllErrors|parser.ParseComments)
+		if err == nil {
+			packName := fast.Name.Name
+			var compiler *CCompiler
+			var found bool
+			if compiler, found = compilers[packName]; !found {
+				compiler = NewCompiler(g, fset)
+				compilers[packName] = compiler
+			}
+			compiler.Compile(fast)
+		} else {
+			g.reportParseError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		g.reportError("%v", err)
+		return nil
+	}
+	return generateCode(compilers)
+}
+
+// Returns the C code of the packages compiled, keyed by file name.
+// Packages are generated sorted by name.
+func generateCode(compilers map[string]*CCompiler) map[string]string {
+	packs := make([]string, 0, len(compilers))
+	for pack := range compilers {
+		packs = append(packs, pack)
+	}
+	sort.Strings(packs)
+	files := make(map[string]string)
+	for _, pack := range packs {
+		compiler := compilers[pack]
+		compiler.includes = append(compiler.includes, "utils/utils.h")
+		files[pack+".h"] = compiler.GetHeaderCode()
+		files[pack+".c"] = compiler.GetCCode()
+	}
+	return files
+}
+
+func (g *Generator) cleanDir(dir string) {
+	err := traverseDir(dir, func(file string) error {
+		return os.RemoveAll(file)
+	})
+	if err != nil {
+		g.reportError("%v", err)
+	}
+}
+
+func traverseDir(sourcedir string, callback func(file string) error) error {
+	files, err := ioutil.ReadDir(sourcedir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Mode().IsRegular() {
+			name := f.Name()
+			if strings.HasSuffix(name, ".go") {
+				path := filepath.Join(sourcedir, name)
+				if err := callback(path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// nolint unused
+func (g *Generator) copyFile(source string, dest string) {
+	sf, err := os.Open(source)
+	if err != nil {
+		g.reportError("%v", err)
+		return
+	}
+	defer sf.Close()
+	df, err := os.Create(dest)
+	if err != nil {
+		g.reportError("%v", err)
+		return
+	}
+	defer df.Close()
+	io.Copy(df, sf)
+	df.Sync()
+}
@@ -0,0 +1,253 @@
+/*
+Package cgogen generates cgo wrappers exporting the functions of Go packages,
+along with the C definitions of their types, and transpiles Go code to C.
+
+A Generator is created from a Config and keeps the settings and the state of
+its runs, so several generators can be used in the same program. Its methods
+must not be called concurrently, a run processes its sources in parallel.
+*/
+package cgogen
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Options of the generation
+type Config struct {
+	Verbose                 bool
+	ProcessFunctions        bool
+	ProcessTypes            bool
+	ProcessDependencies     bool
+	DependOnlyExternal      bool
+	TypeDependencyFile      string
+	FuncDependencyFile      string
+	TypeConversionFile      string
+	TypeSettings            []string //Settings added to those of TypeConversionFile
+	IgnoreDependants        bool
+	FullTranspile           bool //Full conversion to c code
+	FullTranspileDir        string
+	FullTranspileOut        string
+	MainPackagePath         string
+	ImportPath              string //Import path of the package wrapped, instead of MainPackagePath
+	PrefixLib               string
+	DealOutStringAsGostring bool
+	ConvertersFile          string
+	OutputFilePrimitivesH   string
+	TargetOS                string
+	TargetArch              string
+	OutputFileContextGO     string
+	VerifyCgocheck          bool
+	Verify                  bool
+	LayoutTest              bool
+	FlattenEmbedded         bool
+	ManifestFile            string
+	Workers                 int
+	Check                   bool
+	DiffOutput              io.Writer `json:"-"` //Writer of the diffs of the stale outputs with Check
+	CoverageFile            string
+	CoverageTextFile        string
+	WarningsAsErrors        bool
+}
+
+// Source file to wrap and the files where its outputs are saved.
+// Outputs without file are printed to stdout.
+type Source struct {
+	Path         string
+	OutputFileGO string
+	OutputFileCH string
+}
+
+// Generator of cgo wrappers and C code, created with New
+type Generator struct {
+	cfg    Config
+	applog func(format string, v ...interface{})
+
+	//Map of types that will replaced by custom types
+	customTypesMap map[string]string
+	//Types that will use functions of type inplace to convert
+	inplaceConvertTypesPackages map[string]string
+	arrayTypes                  map[string]string
+	//types that will be replaced by handles
+	handleTypes map[string]string
+	// Functions with asynchronous wrappers, by name or by package and name
+	asyncFunctions map[string]bool
+	// Functions whose wrappers are called by the smoke test of -cgocheck, by name or by package and name
+	smokeFunctions map[string]bool
+	// Registered converters by Go type
+	typeConverters map[string]*TypeConverter
+
+	functionPrefix             string
+	includePrefix              string
+	mainPackagePath            string
+	packagePath                string
+	dealOutStringAsGostring    bool
+	getPackagePathFromFilename bool
+	target                     targetPlatform
+
+	// Packages already scanned for constants and types, keyed by import path or directory,
+	// and the packages of the files parsed. Guarded by constPackagesLock, values are cached
+	// as they are evaluated.
+	constPackagesLock sync.Mutex
+	constPackages     map[string]*constPackage
+	filePackages      map[*ast.File]*constPackage
+
+	// Jobs being processed, keyed by the parsed source file
+	fileJobsLock sync.Mutex
+	fileJobs     map[*ast.File]*fileJob
+
+	dependencies dependencyRegistry
+
+	// Headers declaring the types of the sources of the run, keyed by C type name.
+	// Indexed before processing the sources, read only while they are processed.
+	typeHeaders map[string]typeHeader
+	// Types aliased by the sources of the run, keyed by the C name of the alias
+	typeAliases map[string]aliasTarget
+	// Types declared by the sources of the run, keyed by C type name
+	typeDecls map[string]typeDecl
+	// Sources of the run declaring the types and aliases, keyed by C type name
+	typeSources map[string]string
+
+	diagnosticsLock sync.Mutex
+	diagnostics     []Diagnostic
+
+	// Diffs of the outputs differing from the files on disk, keyed by path
+	staleOutputsLock sync.Mutex
+	staleOutputs     map[string]string
+}
+
+// Returns a generator loading the converters and the type conversion settings of the config
+func New(cfg Config) (*Generator, error) {
+	if cfg.MainPackagePath == "" && cfg.ImportPath == "" {
+		return nil, errors.New("the main package path is required")
+	}
+	g := &Generator{
+		cfg: cfg,
+		applog: func(format string, v ...interface{}) {
+			// Logging disabled
+		},
+		customTypesMap:              make(map[string]string),
+		inplaceConvertTypesPackages: make(map[string]string),
+		arrayTypes:                  make(map[string]string),
+		handleTypes:                 make(map[string]string),
+		asyncFunctions:              make(map[string]bool),
+		smokeFunctions:              make(map[string]bool),
+		typeConverters:              make(map[string]*TypeConverter),
+		constPackages:               make(map[string]*constPackage),
+		filePackages:                make(map[*ast.File]*constPackage),
+		fileJobs:                    make(map[*ast.File]*fileJob),
+		staleOutputs:                make(map[string]string),
+	}
+	if cfg.Verbose {
+		g.applog = log.Printf
+	}
+	if cfg.MainPackagePath != "" {
+		g.packagePath, g.mainPackagePath = getPathPackage(cfg.MainPackagePath)
+	} else {
+		// Sibling packages are part of the library
+		g.packagePath = path.Dir(cfg.ImportPath) + "/"
+		g.mainPackagePath = g.packagePath
+	}
+	g.functionPrefix = strings.ToUpper(cfg.PrefixLib)
+	g.includePrefix = strings.ToLower(cfg.PrefixLib)
+	g.dealOutStringAsGostring = cfg.DealOutStringAsGostring
+	g.applog("Load prefix " + g.functionPrefix)
+
+	var err error
+	g.target, err = newTargetPlatform(cfg.TargetOS, cfg.TargetArch)
+	if err != nil {
+		return nil, err
+	}
+	g.registerBuiltinConverters()
+	if cfg.ConvertersFile != "" {
+		if err := g.loadConvertersFile(cfg.ConvertersFile); err != nil {
+			return nil, fmt.Errorf("%s: %v", cfg.ConvertersFile, err)
+		}
+	}
+	if cfg.TypeConversionFile != "" {
+		for _, str := range g.loadDependencyFile(cfg.TypeConversionFile, "\n") {
+			g.processTypeSetting(str)
+		}
+	}
+	for _, str := range cfg.TypeSettings {
+		g.processTypeSetting(str)
+	}
+	if err := g.errorsSince(0); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Generates the outputs of the config: the primitive types header, the cancellation
+// tokens API and the outputs of the sources, or the full transpile.
+// Returns the diagnostics reported if there are errors among them.
+func (g *Generator) Run(sources []Source) error {
+	count := g.diagnosticsCount()
+	g.staleOutputs = make(map[string]string)
+	if g.cfg.OutputFilePrimitivesH != "" {
+		g.saveTextToFile(g.cfg.OutputFilePrimitivesH, g.PrimitivesHeader())
+	}
+	if g.cfg.OutputFileContextGO != "" {
+		g.saveGoFile(g.cfg.OutputFileContextGO, g.generateContextAPI())
+	}
+	if g.cfg.FullTranspile {
+		g.doFullTranspile()
+	} else {
+		g.doGoFiles(sources)
+	}
+	g.applog("Number of array types : %d", len(g.arrayTypes))
+	g.applog("Number of handle types :  %d", len(g.handleTypes))
+	g.applog("Number of custom types : %d", len(g.customTypesMap))
+	if g.cfg.Check {
+		g.reportStaleOutputs()
+	}
+	return g.errorsSince(count)
+}
+
+// Returns the Go code of the cgo wrappers of the functions in the source file of a package
+func (g *Generator) WrapPackage(path string) (string, error) {
+	count := g.diagnosticsCount()
+	job := newFileJob(path, "", "")
+	g.generateFile(job, true, false)
+	if err := g.errorsSince(count); err != nil {
+		return "", err
+	}
+	return job.goCode, nil
+}
+
+// Returns the C definitions of the types declared in the source file of a package
+func (g *Generator) GenerateTypes(path string) (string, error) {
+	count := g.diagnosticsCount()
+	job := newFileJob(path, "", "")
+	g.generateFile(job, false, true)
+	if err := g.errorsSince(count); err != nil {
+		return "", err
+	}
+	return job.typesCode, nil
+}
+
+// Transpiles the Go files of the directory to C, returns the code keyed by file name
+func (g *Generator) Transpile(dir string) (map[string]string, error) {
+	count := g.diagnosticsCount()
+	files := g.transpile(dir)
+	if err := g.errorsSince(count); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Returns the header with the C primitive types of the target platform
+func (g *Generator) PrimitivesHeader() string {
+	return primitiveTypesHeader(g.target)
+}
+
+// Returns the Go code of the cancellation tokens API
+func (g *Generator) ContextAPI() (string, error) {
+	return g.renderGoFile(g.generateContextAPI())
+}
@@ -0,0 +1,274 @@
+package cgogen
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+/*
+Every directory of testdata/wrap holds the Go files of a package, and those of
+the packages it uses in its subdirectories. The wrappers, the types header and
+the C smoke test of -verify generated for FILE.go are compared with
+FILE.go.golden, FILE.h.golden and FILE.smoke.c.golden. Optional files of the
+case:
+
+	settings.txt     type conversion settings, as in the file of parameter tc
+	converters.json  project type converters, as in the file of parameter conv
+	config.json      fields of the Config set instead of those of the tests
+
+With LayoutTest set the test comparing the layouts of the wrappers of FILE.go
+is compared with FILE_layout_test.go.golden.
+
+The JSON and text coverage reports of the case are compared with
+coverage.json.golden and coverage.txt.golden.
+
+The C code transpiled from every directory of testdata/transpile is compared
+with PACKAGE.c.golden and PACKAGE.h.golden. Diagnostics of a case are compared
+with diagnostics.golden, missing when there are none.
+
+The Go code generated must parse, and is compiled by TestWrapBuild.
+Run go test -update to regenerate the golden files.
+*/
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// Import path of the packages of the test cases
+const testImportPath = "example.com/lib/"
+
+func newTestGenerator(t *testing.T, dir string) *Generator {
+	cfg := Config{
+		ProcessFunctions:        true,
+		ProcessTypes:            true,
+		ImportPath:              testImportPath + filepath.Base(dir),
+		PrefixLib:               "SKY",
+		DealOutStringAsGostring: true,
+		TargetOS:                "linux",
+		TargetArch:              "amd64",
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "config.json")); err == nil {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "converters.json")); err == nil {
+		cfg.ConvertersFile = filepath.Join(dir, "converters.json")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "settings.txt")); err == nil {
+		cfg.TypeSettings = readLines(t, filepath.Join(dir, "settings.txt"))
+	}
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func readLines(t *testing.T, path string) (lines []string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// Returns the directories of the test cases
+func caseDirs(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs []string
+	for _, info := range infos {
+		if info.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, info.Name()))
+		}
+	}
+	return dirs
+}
+
+// Returns the Go files of the case and of the packages in its subdirectories,
+// with the types header of FILE.go named FILE.h
+func caseSources(t *testing.T, dir string) []Source {
+	var files []string
+	for _, pattern := range []string{"*.go", filepath.Join("*", "*.go")} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	sources := make([]Source, 0, len(files))
+	for _, file := range files {
+		sources = append(sources, Source{Path: file, OutputFileCH: strings.TrimSuffix(file, ".go") + ".h"})
+	}
+	return sources
+}
+
+// Compares the text generated with the golden file, or saves it with -update.
+// A missing golden file is expected to be empty.
+func checkGolden(t *testing.T, path string, text string) {
+	if *update {
+		if text == "" {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			return
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if diff := unifiedDiff(path, "generated", string(golden), text); diff != "" {
+		t.Errorf("generated code differs from %s, run go test -update if it's expected\n%s", path, diff)
+	}
+}
+
+// Reports the syntax errors of Go code generated for path
+func checkGoSyntax(t *testing.T, path string, code string) {
+	if code == "" {
+		return
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), path, code, parser.AllErrors); err != nil {
+		t.Errorf("generated code for %s isn't valid Go: %v", path, err)
+	}
+}
+
+func diagnosticsText(g *Generator) string {
+	var text strings.Builder
+	for _, d := range g.Diagnostics() {
+		text.WriteString(d.String() + "\n")
+	}
+	return text.String()
+}
+
+func TestWrapGolden(t *testing.T) {
+	for _, dir := range caseDirs(t, filepath.Join("testdata", "wrap")) {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			g := newTestGenerator(t, dir)
+			sources := caseSources(t, dir)
+			g.indexTypes(sources)
+			var jobs []*fileJob
+			for _, source := range sources {
+				job := newFileJob(source.Path, "", source.OutputFileCH)
+				jobs = append(jobs, job)
+				g.generateFile(job, true, true)
+				checkGoSyntax(t, source.Path, job.goCode)
+				checkGoSyntax(t, layoutTestFileName(source.Path), job.layoutTestCode)
+				checkGolden(t, source.Path+".golden", job.goCode)
+				checkGolden(t, source.OutputFileCH+".golden", job.typesCode)
+				checkGolden(t, strings.TrimSuffix(source.Path, ".go")+".smoke.c.golden",
+					generateCSmokeTest(verifyHeader, job.wrappers))
+				checkGolden(t, layoutTestFileName(source.Path)+".golden", job.layoutTestCode)
+			}
+			g.checkIncludeCycles(jobs)
+			checkGolden(t, filepath.Join(dir, "diagnostics.golden"), diagnosticsText(g))
+			report := newCoverageReport(jobs)
+			coverageJSON, err := report.JSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, filepath.Join(dir, "coverage.json.golden"), coverageJSON)
+			checkGolden(t, filepath.Join(dir, "coverage.txt.golden"), report.Text())
+		})
+	}
+}
+
+func TestTranspileGolden(t *testing.T) {
+	for _, dir := range caseDirs(t, filepath.Join("testdata", "transpile")) {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			g := newTestGenerator(t, dir)
+			files := g.transpile(dir)
+			fileNames := make([]string, 0, len(files))
+			for fileName := range files {
+				fileNames = append(fileNames, fileName)
+			}
+			sort.Strings(fileNames)
+			for _, fileName := range fileNames {
+				checkGolden(t, filepath.Join(dir, fileName+".golden"), files[fileName])
+			}
+			checkGolden(t, filepath.Join(dir, "diagnostics.golden"), diagnosticsText(g))
+		})
+	}
+}
+
+func TestPrimitivesGolden(t *testing.T) {
+	for _, target := range []struct{ goos, goarch string }{
+		{"linux", "amd64"},
+		{"linux", "386"},
+		{"darwin", "arm64"},
+	} {
+		g, err := New(Config{ImportPath: testImportPath, TargetOS: target.goos, TargetArch: target.goarch})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, filepath.Join("testdata", "primitives", target.goos+"_"+target.goarch+".h.golden"),
+			g.PrimitivesHeader())
+	}
+}
+
+func TestContextAPIGolden(t *testing.T) {
+	g := newTestGenerator(t, "testdata")
+	code, err := g.ContextAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, filepath.Join("testdata", "context.go.golden"), code)
+}
+
+// Returns all the code generated from the case directory, keyed by file name
+func generateAll(t *testing.T, dir string, transpile bool) map[string]string {
+	g := newTestGenerator(t, dir)
+	if transpile {
+		return g.transpile(dir)
+	}
+	sources := caseSources(t, dir)
+	g.indexTypes(sources)
+	code := make(map[string]string)
+	for _, source := range sources {
+		job := newFileJob(source.Path, "", source.OutputFileCH)
+		g.generateFile(job, true, true)
+		code[source.Path] = job.goCode
+		code[source.OutputFileCH] = job.typesCode
+	}
+	return code
+}
+
+func TestReproducibleOutput(t *testing.T) {
+	for _, kind := range []string{"wrap", "transpile"} {
+		for _, dir := range caseDirs(t, filepath.Join("testdata", kind)) {
+			first := generateAll(t, dir, kind == "transpile")
+			second := generateAll(t, dir, kind == "transpile")
+			for fileName, code := range first {
+				if diff := unifiedDiff("first", "second", code, second[fileName]); diff != "" {
+					t.Errorf("%s: output of two runs differs\n%s", fileName, diff)
+				}
+			}
+		}
+	}
+}
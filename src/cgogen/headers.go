@@ -0,0 +1,190 @@
+package cgogen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+Types headers of a run include the headers declaring the types they use from
+other sources of the run, whether of the same package or of other packages.
+Those types count as defined when ordering the typedefs of a header, so its
+typedefs follow their dependencies. Headers can't include each other, types
+used across two sources by each other are reported and must be moved to one
+of them.
+
+Headers start with #pragma once, since they can be included by several others.
+*/
+
+// Source declaring a type of the run and the header where it is saved
+type typeHeader struct {
+	source string
+	header string
+}
+
+// Indexes the types and aliases declared by the sources, and the headers of those whose
+// types header is saved to a file
+func (g *Generator) indexTypes(sources []Source) {
+	g.typeHeaders = make(map[string]typeHeader)
+	g.typeAliases = make(map[string]aliasTarget)
+	g.typeDecls = make(map[string]typeDecl)
+	g.typeSources = make(map[string]string)
+	fset := token.NewFileSet()
+	for _, source := range sources {
+		// Errors are reported when the source is processed
+		fast, err := parser.ParseFile(fset, source.Path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		// Types used by the source are resolved in the package of the file declaring them
+		g.constPackagesLock.Lock()
+		g.sourceConstPackage(source.Path, fast, g.sourceImportPath(source.Path, fast.Name.Name))
+		g.constPackagesLock.Unlock()
+		for _, _decl := range fast.Decls {
+			decl, ok := (_decl).(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range decl.Specs {
+				if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec {
+					name := fast.Name.Name + packageSeparator + typeSpec.Name.Name
+					g.typeDecls[name] = typeDecl{typeSpec, fast}
+					g.typeSources[name] = source.Path
+					if isAliasSpec(typeSpec) {
+						g.typeAliases[name] = aliasTarget{packageName: fast.Name.Name, typeExpr: typeSpec.Type}
+					} else if source.OutputFileCH != "" {
+						g.typeHeaders[name] = typeHeader{source.Path, source.OutputFileCH}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Returns the C names of the types declared by other sources of the run
+func (g *Generator) otherSourcesTypes(job *fileJob) []string {
+	var names []string
+	for name, header := range g.typeHeaders {
+		if header.source != job.path {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns the headers of other sources declaring the types used by the type declarations, sorted
+func (g *Generator) typeDeclsHeaders(fast *ast.File, job *fileJob, typeDecls []*ast.GenDecl) []string {
+	headers := make(map[string]bool)
+	addType := func(packageName string, typeName string) {
+		header, found := g.typeHeaders[packageName+packageSeparator+typeName]
+		if found && header.source != job.path {
+			headers[header.header] = true
+			g.constPackagesLock.Lock()
+			g.addResolvedDir(fast, filepath.Dir(header.source))
+			g.constPackagesLock.Unlock()
+		}
+	}
+	var inspect func(node ast.Node) bool
+	inspect = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Field:
+			// Names of fields aren't types, nor are those of fields not generated or generated as handles
+			if !parseFieldTag(n).changesLayout() {
+				ast.Inspect(n.Type, inspect)
+			}
+			return false
+		case *ast.ArrayType:
+			// Slices are GoSlice_ whatever their elements
+			return n.Len != nil
+		case *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+			return false
+		case *ast.SelectorExpr:
+			if identExpr, isIdent := (n.X).(*ast.Ident); isIdent {
+				addType(identExpr.Name, n.Sel.Name)
+			}
+			return false
+		case *ast.Ident:
+			addType(fast.Name.Name, n.Name)
+		}
+		return true
+	}
+	for _, typeDecl := range typeDecls {
+		for _, s := range typeDecl.Specs {
+			if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec && !isAliasSpec(typeSpec) {
+				ast.Inspect(typeSpec.Type, inspect)
+			}
+		}
+	}
+	list := make([]string, 0, len(headers))
+	for header := range headers {
+		list = append(list, header)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Returns the include directives of the headers, relative to the header of the job
+func includeDirectives(job *fileJob, headers []string) string {
+	code := ""
+	for _, header := range headers {
+		path := header
+		if job.outputFileCH != "" {
+			if rel, err := filepath.Rel(filepath.Dir(job.outputFileCH), header); err == nil {
+				path = rel
+			}
+		}
+		code += "#include \"" + filepath.ToSlash(path) + "\"\n"
+	}
+	return code
+}
+
+// Reports the headers of the jobs including each other, directly or through other headers
+func (g *Generator) checkIncludeCycles(jobs []*fileJob) {
+	includes := make(map[string][]string)
+	var headers []string
+	for _, job := range jobs {
+		if job.outputFileCH != "" {
+			includes[job.outputFileCH] = job.includes
+			headers = append(headers, job.outputFileCH)
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(header string)
+	visit = func(header string) {
+		state[header] = visiting
+		path = append(path, header)
+		for _, include := range includes[header] {
+			switch state[include] {
+			case visiting:
+				cycle := path
+				for i, h := range path {
+					if h == include {
+						cycle = path[i:]
+						break
+					}
+				}
+				g.reportError("%s: types headers include each other through %s, move the types they use from each other to one source",
+					include, strings.Join(append(append([]string(nil), cycle...), include), " -> "))
+			case unvisited:
+				visit(include)
+			}
+		}
+		path = path[:len(path)-1]
+		state[header] = visited
+	}
+	for _, header := range headers {
+		if state[header] == unvisited {
+			visit(header)
+		}
+	}
+}
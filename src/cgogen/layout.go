@@ -0,0 +1,182 @@
+package cgogen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+/*
+Flat types are cast between C and Go through unsafe.Pointer, so their C
+typedefs must have the layout of the Go types. The types header asserts the
+size of each flat type and the offsets of its fields, as laid out by Go for
+the target, so a C compiler disagreeing fails the build
+
+	_Static_assert(sizeof(cipher__Point) == 16, "cipher__Point must match the layout of Go cipher.Point");
+	_Static_assert(offsetof(cipher__Point, Y) == 8, "cipher__Point must match the layout of Go cipher.Point");
+
+With -layouttest the wrappers also list the sizes and offsets of the C types
+and of the exported Go types, compared by a test saved beside them as
+FILE_layout_test.go. It fails when the Go types changed after the header was
+generated.
+*/
+
+// Returns the Go type used to compute the layout of the type expression on the target.
+// Pointers, maps, channels and functions are laid out as unsafe.Pointer. Named types
+// are resolved in the package, the sources of the run and the packages imported.
+func (g *Generator) layoutTypeOf(fast *ast.File, typeExpr ast.Expr, visiting map[*ast.TypeSpec]bool) (types.Type, bool) {
+	switch t := typeExpr.(type) {
+	case *ast.Ident, *ast.SelectorExpr:
+		if identExpr, isIdent := (t).(*ast.Ident); isIdent {
+			if typeName, isTypeName := types.Universe.Lookup(identExpr.Name).(*types.TypeName); isTypeName {
+				return typeName.Type(), true
+			}
+		}
+		if selectorExpr, isSelector := (t).(*ast.SelectorExpr); isSelector && isUnsafePointer(selectorExpr) {
+			return types.Typ[types.UnsafePointer], true
+		}
+		// Fields of types declared by other files are resolved with the imports of those files
+		typeSpec, declFile := g.findNamedType(fast, typeExpr)
+		if typeSpec == nil || visiting[typeSpec] {
+			return nil, false
+		}
+		visiting[typeSpec] = true
+		defer delete(visiting, typeSpec)
+		return g.layoutTypeOf(declFile, typeSpec.Type, visiting)
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType:
+		return types.Typ[types.UnsafePointer], true
+	case *ast.InterfaceType:
+		return types.NewInterfaceType(nil, nil), true
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return types.NewSlice(types.Typ[types.Byte]), true
+		}
+		elem, ok := g.layoutTypeOf(fast, t.Elt, visiting)
+		if !ok {
+			return nil, false
+		}
+		arrayLen, ok := g.evalArrayLen(fast, t.Len)
+		if !ok {
+			return nil, false
+		}
+		length, err := strconv.ParseInt(arrayLen, 0, 64)
+		if err != nil {
+			return nil, false
+		}
+		return types.NewArray(elem, length), true
+	case *ast.StructType:
+		var fields []*types.Var
+		for _, field := range t.Fields.List {
+			fieldType, ok := g.layoutTypeOf(fast, field.Type, visiting)
+			if !ok {
+				return nil, false
+			}
+			for _, name := range structFieldNames(field) {
+				fields = append(fields, types.NewField(token.NoPos, nil, name, fieldType, len(field.Names) == 0))
+			}
+		}
+		return types.NewStruct(fields, nil), true
+	}
+	return nil, false
+}
+
+// Returns whether the wrappers cast values of the type between C and Go
+func (g *Generator) isCastType(fast *ast.File, typeSpec *ast.TypeSpec) bool {
+	return g.isFlatType(fast, typeSpec.Type) && g.findConverter(fast, typeSpec.Name) == nil
+}
+
+// Returns the C assertions of the layout of the type, empty if it isn't cast or its layout is unknown
+func (g *Generator) layoutAssertions(fast *ast.File, typeSpec *ast.TypeSpec) string {
+	if !g.isCastType(fast, typeSpec) {
+		return ""
+	}
+	layoutType, ok := g.layoutTypeOf(fast, typeSpec.Type, make(map[*ast.TypeSpec]bool))
+	if !ok {
+		g.reportWarningAt(fast, typeSpec, "layout of %s is unknown, its C type is cast without checking it", typeSpec.Name.Name)
+		return ""
+	}
+	cName := fast.Name.Name + packageSeparator + typeSpec.Name.Name
+	msg := fmt.Sprintf("\"%s must match the layout of Go %s.%s\"", cName, fast.Name.Name, typeSpec.Name.Name)
+	code := fmt.Sprintf("_Static_assert(sizeof(%s) == %d, %s);\n", cName, g.target.sizes.Sizeof(layoutType), msg)
+	typeStruct, isStruct := (typeSpec.Type).(*ast.StructType)
+	if !isStruct {
+		return code
+	}
+	for _, member := range g.structMembers(fast, typeStruct) {
+		offset, ok := g.memberOffset(layoutType.(*types.Struct), member.goPath)
+		if ok && member.cName != "_" {
+			code += fmt.Sprintf("_Static_assert(offsetof(%s, %s) == %d, %s);\n", cName, member.cName, offset, msg)
+		}
+	}
+	return code
+}
+
+// Adds to the wrappers the sizes and offsets of the exported cast types, in C and in Go.
+// Returns false if there are none.
+func (g *Generator) addLayoutChecks(fast *ast.File, outFile *jen.File, typeSpecs []*ast.TypeSpec) bool {
+	var checks []jen.Code
+	check := func(name string, cValue jen.Code, goValue jen.Code) {
+		checks = append(checks, jen.Line().Values(jen.Lit(name), cValue, goValue))
+	}
+	for _, typeSpec := range typeSpecs {
+		if !typeSpec.Name.IsExported() || !g.isCastType(fast, typeSpec) {
+			continue
+		}
+		cName := fast.Name.Name + packageSeparator + typeSpec.Name.Name
+		cType := jen.Qual("C", cName)
+		goType := g.goTypeCode(fast, typeSpec.Name)
+		check(cName, jen.Qual("unsafe", "Sizeof").Call(jen.Op("*").New(cType)),
+			jen.Qual("unsafe", "Sizeof").Call(jen.Op("*").New(goType)))
+		typeStruct, isStruct := (typeSpec.Type).(*ast.StructType)
+		if !isStruct {
+			continue
+		}
+		for _, member := range g.structMembers(fast, typeStruct) {
+			if !ast.IsExported(member.goName()) || member.cName == "_" {
+				continue
+			}
+			check(cName+"."+member.cName,
+				jen.Qual("unsafe", "Offsetof").Call(jen.New(cType).Dot(member.cName)),
+				jen.Qual("unsafe", "Offsetof").Call(jen.New(goType).Dot(member.goName())))
+		}
+	}
+	if len(checks) == 0 {
+		return false
+	}
+	outFile.Comment("Sizes and offsets of the C types and of the Go types cast from them, compared by the layout test")
+	outFile.Var().Id(layoutChecksName(g.jobOf(fast))).Op("=").Index().Struct(
+		jen.Id("name").String(),
+		jen.List(jen.Id("cValue"), jen.Id("goValue")).Uintptr(),
+	).Values(append(checks, jen.Line())...)
+	return true
+}
+
+// Returns the name of the variable listing the layout checks of the wrappers
+func layoutChecksName(job *fileJob) string {
+	return "layoutChecks_" + helperFileTag(job.path)
+}
+
+// Returns the name of the file of the layout test of the wrappers saved in fileName
+func layoutTestFileName(fileName string) string {
+	return strings.TrimSuffix(fileName, ".go") + "_layout_test.go"
+}
+
+// Returns the test comparing the layouts listed in the wrappers of the job
+func generateLayoutTest(job *fileJob) *jen.File {
+	outFile := jen.NewFile("main")
+	outFile.HeaderComment("Code generated by cgogen. DO NOT EDIT.")
+	outFile.Func().Id("TestLayout_" + helperFileTag(job.path)).Params(jen.Id("t").Op("*").Qual("testing", "T")).Block(
+		jen.For(jen.List(jen.Id("_"), jen.Id("check")).Op(":=").Range().Id(layoutChecksName(job))).Block(
+			jen.If(jen.Id("check").Dot("cValue").Op("!=").Id("check").Dot("goValue")).Block(
+				jen.Id("t").Dot("Errorf").Call(jen.Lit("%s is %d in C and %d in Go, regenerate the types header"),
+					jen.Id("check").Dot("name"), jen.Id("check").Dot("cValue"), jen.Id("check").Dot("goValue")),
+			),
+		),
+	)
+	return outFile
+}
@@ -0,0 +1,205 @@
+package cgogen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Version of cgogen. Sources are regenerated when it changes.
+const cgogenVersion = "0.3.0-dev"
+
+/*
+The manifest records, for every source file, the hash of its inputs, of the
+configuration and the version of cgogen of the last run, along with the hash
+of every output written. The inputs are the source, the files of parameters
+tc, conv, td and fd, the Go files of the directory of the source and the list of
+the sources of the run, which tells those declaring the types included. The Go
+files of the other packages the source resolved constants, types and aliases
+from, sources of the run or imported, are hashed apart, by directory, as they
+are only known once the source is processed. A source is skipped when all of
+them are unchanged and its outputs still hold the content written.
+*/
+type manifestEntry struct {
+	Version    string            `json:"version"`
+	InputHash  string            `json:"input_hash"`
+	ConfigHash string            `json:"config_hash"`
+	Outputs    map[string]string `json:"outputs"`
+	// Hashes of the Go files of the packages the source resolved from, keyed by directory
+	Packages map[string]string `json:"packages,omitempty"`
+	// Kept for the coverage report of runs skipping the source
+	Coverage []coverageEntry `json:"coverage,omitempty"`
+}
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the hash of the contents of the files, missing files hash as empty
+func hashFiles(paths ...string) string {
+	h := sha256.New()
+	for _, path := range paths {
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		if path != "" {
+			contents, _ := ioutil.ReadFile(path)
+			h.Write([]byte(hashText(string(contents))))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the hash of the Go files of the directory, test files excluded
+func hashPackageDir(dir string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	var paths []string
+	for _, match := range matches {
+		if !strings.HasSuffix(match, "_test.go") {
+			paths = append(paths, match)
+		}
+	}
+	return hashFiles(paths...)
+}
+
+// Sets the hash of the inputs of every source of the run
+func (g *Generator) hashInputs(jobs []*fileJob) {
+	var sources []string
+	for _, job := range jobs {
+		sources = append(sources, job.path+":"+job.outputFileCH)
+	}
+	sort.Strings(sources)
+	runHash := hashText(strings.Join(sources, "\n"))
+	for _, job := range jobs {
+		job.inputHash = hashText(runHash + hashPackageDir(filepath.Dir(job.path)) +
+			hashFiles(job.path, g.cfg.TypeConversionFile, g.cfg.ConvertersFile, g.cfg.TypeDependencyFile, g.cfg.FuncDependencyFile))
+	}
+}
+
+// Records that the package of the file resolved constants, types or aliases from the Go files
+// of dir. Callers hold constPackagesLock.
+func (g *Generator) addResolvedDir(fast *ast.File, dir string) {
+	if p := g.localConstPackage(fast); p != nil && dir != "" && dir != p.srcDir {
+		p.resolvedDirs[dir] = true
+	}
+}
+
+// Returns the hashes of the Go files of the other packages the source resolved constants,
+// types and aliases from, directly or through those packages, keyed by directory
+func (g *Generator) resolvedPackagesHashes(job *fileJob) map[string]string {
+	g.constPackagesLock.Lock()
+	defer g.constPackagesLock.Unlock()
+	sourceDir := filepath.Dir(job.path)
+	dirs := map[string]bool{sourceDir: true}
+	pending := []string{sourceDir}
+	for len(pending) > 0 {
+		dir := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, p := range g.constPackages {
+			if p.srcDir != dir {
+				continue
+			}
+			for resolved := range p.resolvedDirs {
+				if !dirs[resolved] {
+					dirs[resolved] = true
+					pending = append(pending, resolved)
+				}
+			}
+		}
+	}
+	hashes := make(map[string]string)
+	for dir := range dirs {
+		// The directory of the source is hashed with the inputs
+		if dir != sourceDir {
+			hashes[dir] = hashPackageDir(dir)
+		}
+	}
+	return hashes
+}
+
+// Returns the hash of the options affecting the outputs
+func (g *Generator) configHash() string {
+	options := g.cfg
+	options.Verbose = false
+	options.VerifyCgocheck = false
+	options.Verify = false
+	options.ManifestFile = ""
+	options.Workers = 0
+	options.Check = false
+	options.CoverageFile = ""
+	options.CoverageTextFile = ""
+	options.WarningsAsErrors = false
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		g.reportError("%v", err)
+	}
+	return hashText(string(encoded))
+}
+
+func (g *Generator) loadManifest(path string) map[string]*manifestEntry {
+	manifest := make(map[string]*manifestEntry)
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			g.reportWarning("Couldn't read manifest %s: %v", path, err)
+		}
+		return manifest
+	}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		g.reportWarning("Ignoring invalid manifest %s: %v", path, err)
+		return make(map[string]*manifestEntry)
+	}
+	return manifest
+}
+
+// Returns whether the outputs of the source file are up to date
+func (g *Generator) isUpToDate(manifestPath string, job *fileJob) bool {
+	entry, found := g.loadManifest(manifestPath)[job.path]
+	if !found || entry.Version != cgogenVersion || entry.InputHash != job.inputHash ||
+		entry.ConfigHash != g.configHash() || len(entry.Outputs) == 0 {
+		return false
+	}
+	for dir, hash := range entry.Packages {
+		if hashPackageDir(dir) != hash {
+			return false
+		}
+	}
+	for fileName, hash := range entry.Outputs {
+		contents, err := ioutil.ReadFile(fileName)
+		if err != nil || hashText(string(contents)) != hash {
+			return false
+		}
+	}
+	job.coverage = entry.Coverage
+	return true
+}
+
+// Records in the manifest the outputs of the source file saved in this run,
+// and the hashes of the packages it resolved from
+func (g *Generator) updateManifest(manifestPath string, job *fileJob) {
+	manifest := g.loadManifest(manifestPath)
+	outputs := make(map[string]string)
+	for fileName, hash := range job.savedOutputs {
+		outputs[fileName] = hash
+	}
+	manifest[job.path] = &manifestEntry{
+		Version:    cgogenVersion,
+		InputHash:  job.inputHash,
+		ConfigHash: g.configHash(),
+		Outputs:    outputs,
+		Packages:   g.resolvedPackagesHashes(job),
+		Coverage:   job.coverage,
+	}
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		g.reportError("%v", err)
+		return
+	}
+	g.saveTextToFile(manifestPath, string(encoded)+"\n")
+}
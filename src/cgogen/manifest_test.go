@@ -0,0 +1,206 @@
+package cgogen
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Files of the package wrapped by the manifest test, in a GOPATH
+var manifestTestFiles = map[string]string{
+	"src/example.com/lib/ledger/ledger.go": `package ledger
+
+import "example.com/lib/sizes"
+
+type Entry struct {
+	Key  [sizes.KeySize]byte
+	Tags [TagCount]uint8
+}
+
+func NewEntry(kind Kind) Entry { return Entry{} }
+`,
+	"src/example.com/lib/ledger/kinds.go": `package ledger
+
+const TagCount = 4
+
+type Kind uint8
+`,
+	"src/example.com/lib/sizes/sizes.go": `package sizes
+
+const KeySize = 32
+`,
+	"src/example.com/lib/notes/notes.go": `package notes
+
+import "example.com/lib/ledger"
+
+type Note struct {
+	Kind ledger.Kind
+	Size uint32
+}
+
+func Pin(note Note) Note { return note }
+`,
+}
+
+// Returns the sources the manifest of the last run doesn't skip in a new run, regenerated by it
+func staleSources(t *testing.T, cfg Config, sources []Source) []string {
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []*fileJob
+	for _, source := range sources {
+		jobs = append(jobs, newFileJob(source.Path, source.OutputFileGO, source.OutputFileCH))
+	}
+	g.indexTypes(sources)
+	g.hashInputs(jobs)
+	var stale []string
+	for _, job := range jobs {
+		if !g.isUpToDate(cfg.ManifestFile, job) {
+			stale = append(stale, filepath.Base(job.path))
+		}
+	}
+	return stale
+}
+
+// Returns whether the manifest of the last run skips the sources in a new run
+func manifestUpToDate(t *testing.T, cfg Config, sources []Source) bool {
+	return len(staleSources(t, cfg, sources)) == 0
+}
+
+func runManifestTest(t *testing.T, cfg Config, sources []Source) {
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.doGoFiles(sources)
+	if diagnostics := diagnosticsText(g); diagnostics != "" {
+		t.Fatalf("unexpected diagnostics:\n%s", diagnostics)
+	}
+}
+
+// Writes the files of the manifest test to a new GOPATH, returning it and the function restoring
+// the GOPATH the imported packages are found in
+func writeManifestTestFiles(t *testing.T) (string, func()) {
+	gopath, err := ioutil.TempDir("", "cgogen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range manifestTestFiles {
+		writeBuildFile(t, filepath.Join(gopath, name), text)
+	}
+	defaultGOPATH := build.Default.GOPATH
+	build.Default.GOPATH = gopath
+	return gopath, func() {
+		build.Default.GOPATH = defaultGOPATH
+		os.RemoveAll(gopath)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	gopath, restore := writeManifestTestFiles(t)
+	defer restore()
+
+	dir := filepath.Join(gopath, "src", "example.com", "lib", "ledger")
+	cfg := Config{
+		ProcessFunctions: true,
+		ProcessTypes:     true,
+		ImportPath:       testImportPath + "ledger",
+		PrefixLib:        "SKY",
+		TargetOS:         "linux",
+		TargetArch:       "amd64",
+		ManifestFile:     filepath.Join(gopath, "manifest.json"),
+	}
+	sources := []Source{{
+		Path:         filepath.Join(dir, "ledger.go"),
+		OutputFileGO: filepath.Join(gopath, "ledger.wrap.go"),
+		OutputFileCH: filepath.Join(gopath, "ledger.h"),
+	}}
+	if manifestUpToDate(t, cfg, sources) {
+		t.Fatal("sources are up to date before the first run")
+	}
+	runManifestTest(t, cfg, sources)
+	if !manifestUpToDate(t, cfg, sources) {
+		t.Fatal("unchanged sources aren't up to date")
+	}
+
+	changes := []struct {
+		name string
+		path string
+		text string
+	}{
+		{"sibling file", filepath.Join(dir, "kinds.go"), "package ledger\n\nconst TagCount = 8\n\ntype Kind uint8\n"},
+		{"new sibling file", filepath.Join(dir, "more.go"), "package ledger\n\ntype Kind2 uint8\n"},
+		{"imported package", filepath.Join(gopath, "src", "example.com", "lib", "sizes", "sizes.go"),
+			"package sizes\n\nconst KeySize = 64\n"},
+		{"output", sources[0].OutputFileCH, "// edited\n"},
+	}
+	for _, change := range changes {
+		writeBuildFile(t, change.path, change.text)
+		if manifestUpToDate(t, cfg, sources) {
+			t.Errorf("%s changed: sources are still up to date", change.name)
+		}
+		runManifestTest(t, cfg, sources)
+		if !manifestUpToDate(t, cfg, sources) {
+			t.Errorf("%s changed: sources aren't up to date after the run", change.name)
+		}
+	}
+
+	cfg.PrefixLib = "LIB"
+	if manifestUpToDate(t, cfg, sources) {
+		t.Error("configuration changed: sources are still up to date")
+	}
+}
+
+func TestManifestBatch(t *testing.T) {
+	gopath, restore := writeManifestTestFiles(t)
+	defer restore()
+
+	cfg := Config{
+		ProcessFunctions: true,
+		ProcessTypes:     true,
+		ImportPath:       testImportPath + "ledger",
+		PrefixLib:        "SKY",
+		TargetOS:         "linux",
+		TargetArch:       "amd64",
+		ManifestFile:     filepath.Join(gopath, "manifest.json"),
+	}
+	var sources []Source
+	for _, name := range []string{"ledger", "notes"} {
+		sources = append(sources, Source{
+			Path:         filepath.Join(gopath, "src", "example.com", "lib", name, name+".go"),
+			OutputFileGO: filepath.Join(gopath, name+".wrap.go"),
+			OutputFileCH: filepath.Join(gopath, name+".h"),
+		})
+	}
+	runManifestTest(t, cfg, sources)
+	if stale := staleSources(t, cfg, sources); len(stale) != 0 {
+		t.Fatalf("unchanged sources %q aren't up to date", stale)
+	}
+
+	// Notes resolve the types of the ledger, not the other way round
+	changes := []struct {
+		name  string
+		path  string
+		text  string
+		stale []string
+	}{
+		{"notes", sources[1].Path, manifestTestFiles["src/example.com/lib/notes/notes.go"] + "\nfunc Unpin(note Note) {}\n",
+			[]string{"notes.go"}},
+		{"ledger", filepath.Join(filepath.Dir(sources[0].Path), "kinds.go"),
+			"package ledger\n\nconst TagCount = 4\n\ntype Kind uint16\n", []string{"ledger.go", "notes.go"}},
+	}
+	for _, change := range changes {
+		writeBuildFile(t, change.path, change.text)
+		if stale := staleSources(t, cfg, sources); !reflect.DeepEqual(stale, change.stale) {
+			t.Errorf("%s changed: sources %q are regenerated, want %q", change.name, stale, change.stale)
+		}
+		runManifestTest(t, cfg, sources)
+		if stale := staleSources(t, cfg, sources); len(stale) != 0 {
+			t.Errorf("%s changed: sources %q aren't up to date after the run", change.name, stale)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cgogen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// Go primitive type and the C typedef representing it
+type primitiveType struct {
+	goType string
+	cType  string
+	// C declaration of the typedef, empty when the width depends on the target
+	cDecl string
+	// Size in bytes, zero when it is the target word size
+	size int64
+}
+
+var primitiveTypes = []primitiveType{
+	{"int8", "GoInt8_", "int8_t", 1},
+	{"int16", "GoInt16_", "int16_t", 2},
+	{"int32", "GoInt32_", "int32_t", 4},
+	{"int64", "GoInt64_", "int64_t", 8},
+	{"uint8", "GoUint8_", "uint8_t", 1},
+	{"uint16", "GoUint16_", "uint16_t", 2},
+	{"uint32", "GoUint32_", "uint32_t", 4},
+	{"uint64", "GoUint64_", "uint64_t", 8},
+	{"int", "GoInt_", "", 0},
+	{"uint", "GoUint_", "", 0},
+	{"uintptr", "GoUintptr_", "", 0},
+	{"float32", "GoFloat32_", "float", 4},
+	{"float64", "GoFloat64_", "double", 8},
+	{"complex64", "GoComplex64_", "float _Complex", 8},
+	{"complex128", "GoComplex128_", "double _Complex", 16},
+}
+
+// Platform the generated code is compiled for
+type targetPlatform struct {
+	goos     string
+	goarch   string
+	wordSize int64
+	// Sizes of Go types laid out by gc
+	sizes types.Sizes
+}
+
+func newTargetPlatform(goos string, goarch string) (targetPlatform, error) {
+	sizes := types.SizesFor("gc", goarch)
+	if sizes == nil {
+		return targetPlatform{}, fmt.Errorf("unsupported architecture %s", goarch)
+	}
+	return targetPlatform{
+		goos:     goos,
+		goarch:   goarch,
+		wordSize: sizes.Sizeof(types.Typ[types.Uintptr]),
+		sizes:    sizes,
+	}, nil
+}
+
+func (t targetPlatform) String() string {
+	return t.goos + "/" + t.goarch
+}
+
+// Returns the size in bytes of a primitive type on the target
+func (t targetPlatform) sizeOf(p primitiveType) int64 {
+	if p.size == 0 {
+		return t.wordSize
+	}
+	return p.size
+}
+
+// Returns the C declaration of a primitive type on the target
+func (t targetPlatform) cDeclOf(p primitiveType) string {
+	if p.cDecl != "" {
+		return p.cDecl
+	}
+	prefix := "int"
+	if p.goType != "int" {
+		prefix = "uint"
+	}
+	return fmt.Sprintf("%s%d_t", prefix, t.wordSize*8)
+}
+
+// Returns the header declaring C types of Go primitives for the target.
+// Size checks make the build fail if the header is compiled for another word size.
+func primitiveTypesHeader(t targetPlatform) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Go primitive types for %s\n\n", t)
+	b.WriteString("#pragma once\n\n#include <stdint.h>\n#include <stdbool.h>\n\n")
+	for _, p := range primitiveTypes {
+		fmt.Fprintf(&b, "typedef %s %s;\n", t.cDeclOf(p), p.cType)
+	}
+	b.WriteString("\n")
+	b.WriteString("// time.Time, as seconds and nanoseconds since the Unix epoch and the offset of its zone in seconds east of UTC\n")
+	b.WriteString("typedef struct { GoInt64_ sec; GoInt32_ nsec; GoInt32_ offset; } GoTime_;\n\n")
+	fmt.Fprintf(&b, "_Static_assert(sizeof(void*) == %d, \"types generated for %s\");\n", t.wordSize, t)
+	for _, p := range primitiveTypes {
+		fmt.Fprintf(&b, "_Static_assert(sizeof(%s) == %d, \"%s must match Go %s\");\n",
+			p.cType, t.sizeOf(p), p.cType, p.goType)
+	}
+	b.WriteString("_Static_assert(sizeof(bool) == 1, \"bool must match Go bool\");\n")
+	return b.String()
+}
+
+func isUnsafePointer(selectorExpr *ast.SelectorExpr) bool {
+	identExpr, isIdent := (selectorExpr.X).(*ast.Ident)
+	return isIdent && identExpr.Name == "unsafe" && selectorExpr.Sel.Name == "Pointer"
+}
+
+// Returns whether the selector names a C type of cgo
+func isCTypeExpr(selectorExpr *ast.SelectorExpr) bool {
+	identExpr, isIdent := (selectorExpr.X).(*ast.Ident)
+	return isIdent && identExpr.Name == "C"
+}
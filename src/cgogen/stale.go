@@ -0,0 +1,62 @@
+package cgogen
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+With -check outputs are generated in memory and compared with the files on
+disk instead of being saved. A unified diff of every file that is missing or
+differs is written to the DiffOutput of the config, if any, and an error
+naming them is reported if any does.
+*/
+
+// Compares the output generated for the file with its contents on disk
+func (g *Generator) checkOutput(fileName string, text string) {
+	fromName := fileName
+	current, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			g.reportError("%v", err)
+			return
+		}
+		fromName = "/dev/null"
+	}
+	diff := unifiedDiff(fromName, fileName, string(current), text)
+	if diff == "" && err == nil {
+		g.applog("Up to date %s", fileName)
+		return
+	}
+	if diff == "" {
+		// Missing file with empty contents
+		diff = fmt.Sprintf("--- %s\n+++ %s\n", fromName, fileName)
+	}
+	g.staleOutputsLock.Lock()
+	defer g.staleOutputsLock.Unlock()
+	g.staleOutputs[fileName] = diff
+}
+
+// Writes the diffs of the stale outputs and reports an error if there are any
+func (g *Generator) reportStaleOutputs() {
+	fileNames := make([]string, 0, len(g.staleOutputs))
+	for fileName := range g.staleOutputs {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	if g.cfg.DiffOutput != nil {
+		for _, fileName := range fileNames {
+			if _, err := io.WriteString(g.cfg.DiffOutput, g.staleOutputs[fileName]); err != nil {
+				g.reportError("%v", err)
+				break
+			}
+		}
+	}
+	if len(fileNames) > 0 {
+		g.reportError("%d generated files are stale: %s", len(fileNames), strings.Join(fileNames, ", "))
+	}
+}
@@ -0,0 +1,84 @@
+package cgogen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Runs the generator checking the primitive types header against the file at path,
+// returning the diffs written and the error
+func runCheck(t *testing.T, path string) (string, error) {
+	diffs := &bytes.Buffer{}
+	g, err := New(Config{
+		ImportPath:            testImportPath + "check",
+		TargetOS:              "linux",
+		TargetArch:            "amd64",
+		OutputFilePrimitivesH: path,
+		Check:                 true,
+		DiffOutput:            diffs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.Run(nil)
+	return diffs.String(), err
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgogen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	g, err := New(Config{ImportPath: testImportPath + "check", TargetOS: "linux", TargetArch: "amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := g.PrimitivesHeader()
+	lines := strings.SplitAfter(strings.TrimSuffix(header, "\n"), "\n")
+	path := filepath.Join(dir, "prims.h")
+
+	var added strings.Builder
+	for _, line := range lines {
+		added.WriteString("+" + line)
+	}
+	for _, test := range []struct {
+		name     string
+		contents *string
+		diff     string
+	}{
+		{"missing", nil, "--- /dev/null\n+++ " + path + "\n@@ -0,0 +1," + strconv.Itoa(len(lines)) + " @@\n" + added.String() + "\n"},
+		{"up to date", &header, ""},
+		{"stale", stringPtr("// edited\n" + header),
+			"--- " + path + "\n+++ " + path + "\n@@ -1,4 +1,3 @@\n-// edited\n " + lines[0] + " " + lines[1] + " " + lines[2]},
+	} {
+		os.Remove(path)
+		if test.contents != nil {
+			writeBuildFile(t, path, *test.contents)
+		}
+		diff, err := runCheck(t, path)
+		if diff != test.diff {
+			t.Errorf("%s: got diff\n%s\nwant\n%s", test.name, diff, test.diff)
+		}
+		if test.diff == "" && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if want := "1 generated files are stale: " + path; test.diff != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%s: got error %v, want %s", test.name, err, want)
+		}
+		if test.contents != nil && readCaseFile(t, path) != *test.contents {
+			t.Errorf("%s: the check changed the file", test.name)
+		} else if _, statErr := os.Stat(path); test.contents == nil && statErr == nil {
+			t.Errorf("%s: the check created the file", test.name)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
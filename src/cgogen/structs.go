@@ -0,0 +1,402 @@
+package cgogen
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+Go structs are generated as C structs with a member per field. Embedded
+fields are members named after the type they embed, as in Go
+
+	type Embeds struct {    typedef struct{
+		Address                 types__Address Address;
+		Note string             GoString_ Note;
+	}                       } types__Embeds;
+
+With -flatten the fields promoted from embedded structs are members of the C
+struct instead, named as the promoted fields
+
+	typedef struct{
+	    GoString_ Street;
+	    GoUint8_  Zip[5];
+	    GoString_ Note;
+	} types__Embeds;
+
+Structs embedded by pointer, declared by other sources, whose promoted fields
+clash with other members or whose members would not keep the layout of Go,
+are embedded as members instead, with a warning.
+
+The cgogen key of the tag of a field changes how it is generated
+
+	Secret []byte `cgogen:"-"`              // not a member, left zero when read from C
+	Amount uint64 `cgogen:"name=amount"`    // member named amount
+	Conn   *Conn  `cgogen:"handle"`         // member Conn__Handle Conn
+
+Handles are named as by CGOGEN HANDLES for the type, or after the type if it
+isn't listed, and are registered and looked up by the functions of the library
+as for the types listed. Structs with fields not generated or generated as
+handles are converted field by field instead of being cast.
+*/
+
+// Key of the tags of struct fields read by cgogen
+const fieldTagKey = "cgogen"
+
+// Mapping of a struct field to C given by its tag
+type fieldMapping struct {
+	skip   bool
+	name   string
+	handle bool
+	// Options that couldn't be understood
+	invalid []string
+}
+
+// Returns the mapping of the field given by its tag
+func parseFieldTag(field *ast.Field) fieldMapping {
+	var mapping fieldMapping
+	if field.Tag == nil {
+		return mapping
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return mapping
+	}
+	value, found := reflect.StructTag(tag).Lookup(fieldTagKey)
+	if !found {
+		return mapping
+	}
+	if value == "-" {
+		mapping.skip = true
+		return mapping
+	}
+	for _, option := range strings.Split(value, ",") {
+		option = strings.TrimSpace(option)
+		switch {
+		case option == "handle":
+			mapping.handle = true
+		case strings.HasPrefix(option, "name="):
+			if name := option[len("name="):]; token.IsIdentifier(name) {
+				mapping.name = name
+			} else {
+				mapping.invalid = append(mapping.invalid, option)
+			}
+		case option != "":
+			mapping.invalid = append(mapping.invalid, option)
+		}
+	}
+	return mapping
+}
+
+// Returns whether the tag of the field changes the layout of its struct in C
+func (mapping fieldMapping) changesLayout() bool {
+	return mapping.skip || mapping.handle
+}
+
+// Returns the name of the handle of the type of a field, empty if it can't be a handle
+func (g *Generator) fieldHandleName(fast *ast.File, typeExpr ast.Expr) string {
+	if key, isHandle := g.handleTypeKey(fast, typeExpr); isHandle {
+		return g.handleTypes[key]
+	}
+	if arrayExpr, isArray := (typeExpr).(*ast.ArrayType); isArray && arrayExpr.Len == nil {
+		return ""
+	}
+	return embeddedFieldName(typeExpr)
+}
+
+// Member of the C struct of a Go struct
+type structMember struct {
+	// Fields selecting the member in the Go struct, through the embedded structs flattened
+	goPath   []string
+	cName    string
+	typeExpr ast.Expr
+	// Name of the handle of the type, when the member is a handle
+	handle string
+}
+
+// Returns the name of the Go field selecting the member, promoted when flattened
+func (member structMember) goName() string {
+	return member.goPath[len(member.goPath)-1]
+}
+
+// Embedded field of a struct not flattened, and why
+type embeddedField struct {
+	field  *ast.Field
+	reason string
+}
+
+// Returns the name of the field embedding the type, that of the type
+func embeddedFieldName(typeExpr ast.Expr) string {
+	if starExpr, isStar := (typeExpr).(*ast.StarExpr); isStar {
+		typeExpr = starExpr.X
+	}
+	switch t := typeExpr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+// Returns the Go names of the fields declared by a struct field
+func structFieldNames(field *ast.Field) []string {
+	var names []string
+	for _, fieldName := range field.Names {
+		names = append(names, fieldName.Name)
+	}
+	if len(field.Names) == 0 {
+		if name := embeddedFieldName(field.Type); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns the members of the C struct of a Go struct
+func (g *Generator) structMembers(fast *ast.File, typeStruct *ast.StructType) []structMember {
+	members, _ := g.flattenStruct(fast, typeStruct)
+	return members
+}
+
+// Returns the struct type embedded by the field, if it can be flattened, or why not.
+// The reason is empty for fields embedding types other than structs.
+func embeddedStruct(fast *ast.File, field *ast.Field) (*ast.StructType, string) {
+	typeExpr := field.Type
+	starExpr, isPointer := (typeExpr).(*ast.StarExpr)
+	if isPointer {
+		typeExpr = starExpr.X
+	}
+	identExpr, isIdent := (typeExpr).(*ast.Ident)
+	if isIdent && IsBasicGoType(identExpr.Name) {
+		return nil, ""
+	}
+	if !isIdent {
+		return nil, "it isn't declared by the source"
+	}
+	typeSpec := findTypeSpec(fast, identExpr.Name)
+	if typeSpec == nil {
+		return nil, "it isn't declared by the source"
+	}
+	typeStruct, isStruct := (typeSpec.Type).(*ast.StructType)
+	if !isStruct {
+		return nil, ""
+	}
+	if isPointer {
+		return nil, "it is embedded by pointer"
+	}
+	return typeStruct, ""
+}
+
+// Returns the members of the C struct of a Go struct, flattening the embedded structs
+// with -flatten, and the embedded structs that couldn't be flattened
+func (g *Generator) flattenStruct(fast *ast.File, typeStruct *ast.StructType) ([]structMember, []embeddedField) {
+	flattened := make(map[*ast.Field][]structMember)
+	members := func() []structMember {
+		var members []structMember
+		for _, field := range typeStruct.Fields.List {
+			if inner, isFlattened := flattened[field]; isFlattened {
+				for _, member := range inner {
+					member.goPath = append([]string{embeddedFieldName(field.Type)}, member.goPath...)
+					members = append(members, member)
+				}
+				continue
+			}
+			mapping := parseFieldTag(field)
+			if mapping.skip {
+				continue
+			}
+			for _, name := range structFieldNames(field) {
+				member := structMember{goPath: []string{name}, cName: name, typeExpr: field.Type}
+				if mapping.name != "" && len(field.Names) <= 1 {
+					member.cName = mapping.name
+				}
+				if mapping.handle {
+					member.handle = g.fieldHandleName(fast, field.Type)
+				}
+				members = append(members, member)
+			}
+		}
+		return members
+	}
+	if !g.cfg.FlattenEmbedded {
+		return members(), nil
+	}
+	var kept []embeddedField
+	for _, field := range typeStruct.Fields.List {
+		if mapping := parseFieldTag(field); len(field.Names) > 0 || mapping.skip || mapping.name != "" || mapping.handle {
+			continue
+		}
+		inner, reason := embeddedStruct(fast, field)
+		if inner == nil {
+			if reason != "" {
+				kept = append(kept, embeddedField{field, reason})
+			}
+			continue
+		}
+		flattened[field] = g.structMembers(fast, inner)
+		if hasDuplicateMembers(members()) {
+			reason = "its fields clash with other members"
+		} else if g.promotesOthers(fast, typeStruct, field) {
+			reason = "its fields are also promoted by other embedded fields"
+		} else if !g.keepsLayout(fast, typeStruct, members()) {
+			reason = "its fields wouldn't keep the layout of Go"
+		}
+		if reason != "" {
+			delete(flattened, field)
+			kept = append(kept, embeddedField{field, reason})
+		}
+	}
+	return members(), kept
+}
+
+// Returns whether the struct embedded by the field promotes fields also promoted by
+// other embedded structs, which Go code can't select by their promoted names
+func (g *Generator) promotesOthers(fast *ast.File, typeStruct *ast.StructType, field *ast.Field) bool {
+	promoted := func(field *ast.Field) []structMember {
+		typeExpr := field.Type
+		if starExpr, isStar := (typeExpr).(*ast.StarExpr); isStar {
+			typeExpr = starExpr.X
+		}
+		if identExpr, isIdent := (typeExpr).(*ast.Ident); isIdent {
+			if typeSpec := findTypeSpec(fast, identExpr.Name); typeSpec != nil {
+				if inner, isStruct := (typeSpec.Type).(*ast.StructType); isStruct {
+					return g.structMembers(fast, inner)
+				}
+			}
+		}
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, member := range promoted(field) {
+		names[member.cName] = true
+	}
+	for _, other := range typeStruct.Fields.List {
+		if other == field || len(other.Names) > 0 {
+			continue
+		}
+		for _, member := range promoted(other) {
+			if names[member.cName] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether members are named alike
+func hasDuplicateMembers(members []structMember) bool {
+	names := make(map[string]bool)
+	for _, member := range members {
+		if member.cName != "_" && names[member.cName] {
+			return true
+		}
+		names[member.cName] = true
+	}
+	return false
+}
+
+// Returns whether the members of the C struct have the offsets of the Go fields they
+// stand for, and the C struct the size of the Go struct, on the target
+func (g *Generator) keepsLayout(fast *ast.File, typeStruct *ast.StructType, members []structMember) bool {
+	goType, ok := g.layoutTypeOf(fast, typeStruct, make(map[*ast.TypeSpec]bool))
+	if !ok {
+		return false
+	}
+	var fields []*types.Var
+	for _, member := range members {
+		memberType, ok := g.layoutTypeOf(fast, member.typeExpr, make(map[*ast.TypeSpec]bool))
+		if !ok {
+			return false
+		}
+		fields = append(fields, types.NewField(token.NoPos, nil, member.cName, memberType, false))
+	}
+	cType := types.NewStruct(fields, nil)
+	if g.target.sizes.Sizeof(cType) != g.target.sizes.Sizeof(goType) {
+		return false
+	}
+	offsets := g.target.sizes.Offsetsof(fields)
+	for i, member := range members {
+		if offset, ok := g.memberOffset(goType.(*types.Struct), member.goPath); !ok || offset != offsets[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the offset in the Go struct of the field selected by the path
+func (g *Generator) memberOffset(goStruct *types.Struct, goPath []string) (int64, bool) {
+	offset := int64(0)
+	for i, name := range goPath {
+		var fields []*types.Var
+		index := -1
+		for j := 0; j < goStruct.NumFields(); j++ {
+			fields = append(fields, goStruct.Field(j))
+			if goStruct.Field(j).Name() == name {
+				index = j
+			}
+		}
+		if index < 0 {
+			return 0, false
+		}
+		offset += g.target.sizes.Offsetsof(fields)[index]
+		if i < len(goPath)-1 {
+			inner, isStruct := fields[index].Type().(*types.Struct)
+			if !isStruct {
+				return 0, false
+			}
+			goStruct = inner
+		}
+	}
+	return offset, true
+}
+
+// Reports the embedded structs of the type that couldn't be flattened with -flatten
+// and the tags of its fields that couldn't be understood
+func (g *Generator) reportStructFields(fast *ast.File, typeSpec *ast.TypeSpec) {
+	typeStruct, isStruct := (typeSpec.Type).(*ast.StructType)
+	if !isStruct {
+		return
+	}
+	for _, field := range typeStruct.Fields.List {
+		mapping := parseFieldTag(field)
+		names := strings.Join(structFieldNames(field), ", ")
+		for _, option := range mapping.invalid {
+			g.reportWarningAt(fast, field.Tag, "option %s of the cgogen tag of field %s of %s not understood",
+				option, names, typeSpec.Name.Name)
+		}
+		if mapping.name != "" && len(field.Names) > 1 {
+			g.reportWarningAt(fast, field.Tag, "fields %s of %s not renamed, a name is given to several fields",
+				names, typeSpec.Name.Name)
+		}
+		if mapping.handle && g.fieldHandleName(fast, field.Type) == "" {
+			g.reportWarningAt(fast, field.Tag, "field %s of %s not generated as a handle, its type isn't named",
+				names, typeSpec.Name.Name)
+		}
+	}
+	_, kept := g.flattenStruct(fast, typeStruct)
+	for _, embedded := range kept {
+		g.reportWarningAt(fast, embedded.field, "embedded field %s of %s not flattened, %s",
+			embeddedFieldName(embedded.field.Type), typeSpec.Name.Name, embedded.reason)
+	}
+}
+
+// Returns the name of a member of the C struct of the type declared twice, if any
+func (g *Generator) duplicateMember(fast *ast.File, typeSpec *ast.TypeSpec) string {
+	typeStruct, isStruct := (typeSpec.Type).(*ast.StructType)
+	if !isStruct {
+		return ""
+	}
+	members, _ := g.flattenStruct(fast, typeStruct)
+	declared := make(map[string]bool)
+	for _, member := range members {
+		if member.cName != "_" && declared[member.cName] {
+			return member.cName
+		}
+		declared[member.cName] = true
+	}
+	return ""
+}
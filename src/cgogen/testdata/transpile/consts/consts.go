@@ -0,0 +1,10 @@
+package consts
+
+const Version = "1.0"
+const MaxItems int32 = 100
+const Ratio float64 = 0.5
+
+const (
+	First  uint64 = 1
+	Second uint64 = 2
+)
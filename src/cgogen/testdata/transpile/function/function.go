@@ -0,0 +1,15 @@
+package function
+
+func Reset(w int32, h int32) {
+	var area int32 = 0
+	const scale int32 = 2
+	var name = "rect"
+}
+
+func Clear() {
+	var count int32 = 0
+}
+
+func Area(w int32, h int32) {
+	var area int32 = 0
+}
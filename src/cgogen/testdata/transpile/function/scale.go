@@ -0,0 +1,9 @@
+package function
+
+func Scale(factor int32) {
+	var scaled int32 = 0
+}
+
+func Flip() {
+	var flipped = "flip"
+}
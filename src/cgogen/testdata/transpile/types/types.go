@@ -0,0 +1,18 @@
+package types
+
+type ID uint64
+
+type Point struct {
+	X, Y int32
+}
+
+type Line struct {
+	From Point
+	To   Point
+	Tag  *ID
+}
+
+type Shape struct {
+	Lines [8]Line
+	Count int
+}
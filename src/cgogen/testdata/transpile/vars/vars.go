@@ -0,0 +1,6 @@
+package vars
+
+var Count int32 = 10
+var Name = "vars"
+var Enabled bool
+var Table [4]int64
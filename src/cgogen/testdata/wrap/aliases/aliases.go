@@ -0,0 +1,44 @@
+package aliases
+
+import "time"
+
+// Defined types over basic, composite and imported types
+type Coins uint64
+
+type Hash [32]byte
+
+type Names []string
+
+type Timeout time.Duration
+
+// Aliases are the type they stand for
+type Amount = Coins
+
+type Digest = Hash
+
+type Bytes = []byte
+
+type Count = int
+
+type Label = string
+
+type Entry struct {
+	Amount Amount
+	Digest Digest
+	Count  Count
+	Label  Label
+}
+
+func Balance(coins Coins) Amount { return coins }
+
+func Sum(hash Hash) Digest { return hash }
+
+func Size(count Count, label Label) Count { return count }
+
+func Split(data Bytes) Names { return nil }
+
+func Lookup(entry *Entry) Coins { return 0 }
+
+func Wait(timeout Timeout) Count { return 0 }
+
+func Deadline() Timeout { return 0 }
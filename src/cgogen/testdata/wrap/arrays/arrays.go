@@ -0,0 +1,21 @@
+package arrays
+
+import "crypto/sha256"
+
+const KeyLen = 32
+
+const (
+	Small = iota + 2
+	Large = Small * 8
+)
+
+type Key [KeyLen]byte
+type Hash [sha256.Size]byte
+type Block [Large]uint32
+type Pair [2]Key
+
+func NewKey(seed [KeyLen]byte) (Key, error) { return Key(seed), nil }
+func Sum(data []byte) Hash                  { return sha256.Sum256(data) }
+func (k Key) Verify(h Hash) error           { return nil }
+func Fill(b *Block, v uint32)               {}
+func Swap(p Pair) Pair                      { return Pair{p[1], p[0]} }
@@ -0,0 +1,24 @@
+package basic
+
+import "unsafe"
+
+type Counter struct {
+	N int
+}
+
+func Add(a, b int) int                         { return a + b }
+func Div(a int64, b int64) (int64, error)      { return a / b, nil }
+func Greet(name string) string                 { return "hello " + name }
+func Flags(on bool, ratio float64) (bool, float32) { return on, float32(ratio) }
+func Prims(r rune, p uintptr, u unsafe.Pointer) (rune, uintptr, unsafe.Pointer) { return r, p, u }
+func Nothing()                                 {}
+func Fail() error                              { return nil }
+
+func (c Counter) Value() int  { return c.N }
+func (c *Counter) Inc(n int)  { c.N += n }
+
+// Not wrapped: panics on failure
+func MustAdd(a, b int) int { return a + b }
+
+// Not wrapped: unexported
+func add(a, b int) int { return a + b }
@@ -0,0 +1,23 @@
+package converters
+
+import (
+	"math/big"
+	"net"
+	"time"
+)
+
+type Coins struct{ v uint64 }
+
+func (c Coins) Value() uint64  { return c.v }
+func NewCoins(v uint64) Coins  { return Coins{v} }
+func Amount(c Coins) Coins     { return c }
+
+type Event struct {
+	At    time.Time
+	Every time.Duration
+	Peers []net.IP
+}
+
+func Schedule(t time.Time, d time.Duration, e Event) (Event, error) { return e, nil }
+func Big(n *big.Int) *big.Int                                        { return n }
+func Peer(ip net.IP) net.IP                                          { return ip }
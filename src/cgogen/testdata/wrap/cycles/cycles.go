@@ -0,0 +1,50 @@
+package cycles
+
+// Blocks of a chain point to each other
+type Block struct {
+	Height uint64
+	Chain  *Chain
+	Prev   *Block
+}
+
+type Chain struct {
+	Head  *Block
+	Tail  *Block
+	Count int
+}
+
+type Tree struct {
+	Value  int32
+	Left   *Tree
+	Right  *Tree
+	Parent *Tree
+}
+
+// Arrays of pointers to a struct declared ahead
+type Children [2]*Node
+
+type Node struct {
+	Children *Children
+	Label    string
+}
+
+// Defined before the cycle it uses
+type Forest struct {
+	Trees [4]Tree
+	Count int
+}
+
+// Pointers to types other than structs can't be declared ahead
+type Link *Link
+
+type Holder struct {
+	First Link
+}
+
+func Depth(tree *Tree) int { return 0 }
+
+func Length(chain Chain) int { return chain.Count }
+
+func Mirror(tree Tree) Tree { return tree }
+
+func Root(tree *Tree) *Tree { return tree }
@@ -0,0 +1,31 @@
+package dependants
+
+import (
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Depends on a type that can't be converted
+type Listener struct {
+	Name   string
+	Events chan string
+}
+
+type Point struct {
+	X, Y int32
+}
+
+func Listen(l Listener) {}
+
+func Move(p *Point, dx int32) {}
+
+func Notify(f func(string)) {}
+
+func (l *Listener) Close() {}
+
+func Lock(m *sync.Mutex) {}
+
+func Wait(d time.Duration, n big.Word) {}
+
+func Halve(n big.Word) big.Word { return n / 2 }
@@ -0,0 +1,65 @@
+package embedded
+
+type Point struct {
+	X int64
+	Y int64
+}
+
+type Size struct {
+	Width  int64
+	Height int64
+}
+
+// Promoted fields are members of the C struct
+type Rect struct {
+	Point
+	Size
+	Layer int32
+}
+
+type Header struct {
+	Version uint8
+	Flags   uint64
+	Tag     uint8
+}
+
+// Members of Header would be packed before Kind
+type Packet struct {
+	Header
+	Kind uint8
+}
+
+type Owner struct {
+	Name string
+}
+
+type Label struct {
+	Name string
+}
+
+// Name would be declared twice
+type Tagged struct {
+	Owner
+	Label
+}
+
+// Converted field by field through the promoted fields
+type Account struct {
+	Owner
+	Balance uint64
+}
+
+type Node struct {
+	*Point
+	Next uint32
+}
+
+func Area(rect Rect) int64 { return rect.Width * rect.Height }
+
+func Send(packet *Packet) uint8 { return packet.Kind }
+
+func Describe(tagged Tagged) string { return tagged.Owner.Name }
+
+func Open(name string) Account { return Account{Owner: Owner{name}} }
+
+func Deposit(account *Account, amount uint64) {}
@@ -0,0 +1,17 @@
+package handles
+
+type Node struct {
+	Value int
+	Next  *Node
+}
+
+type Wallet struct {
+	Name string
+}
+
+func NewNode(v int) *Node                   { return &Node{Value: v} }
+func (n *Node) Get() int                    { return n.Value }
+func Link(a *Node, b *Node)                 { a.Next = b }
+func Nodes(n []*Node) []*Node               { return n }
+func OpenWallet(name string) (*Wallet, error) { return &Wallet{name}, nil }
+func (w *Wallet) Rename(name string)        { w.Name = name }
@@ -0,0 +1,6 @@
+package includecycle
+
+type Child struct {
+	Parent *Parent
+	Name   string
+}
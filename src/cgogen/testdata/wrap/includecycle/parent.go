@@ -0,0 +1,6 @@
+package includecycle
+
+type Parent struct {
+	Children []Child
+	First    *Child
+}
@@ -0,0 +1,38 @@
+package layout
+
+import "unsafe"
+
+// Cast between C and Go, fields are padded to their alignment
+type Header struct {
+	Version  uint8
+	Length   uint32
+	Flags    uint16
+	Sequence uint64
+	Ready    bool
+}
+
+type Hash [32]byte
+
+type Amount uint64
+
+type Point struct {
+	X, Y float64
+}
+
+type Record struct {
+	Hash   Hash
+	Amount Amount
+	Origin Point
+	Ratio  complex64
+	_      [3]byte
+	id     int32
+}
+
+// Pointers and strings are copied, so their layouts aren't cast
+type Named struct {
+	Name string
+	Next *Named
+	Data unsafe.Pointer
+}
+
+func Check(header *Header, record Record) error { return nil }
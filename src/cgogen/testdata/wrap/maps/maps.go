@@ -0,0 +1,4 @@
+package maps
+
+func Labels() map[string]string                    { return nil }
+func Lookup(key string) (map[string]string, error) { return nil, nil }
@@ -0,0 +1,13 @@
+package packages
+
+import "example.com/lib/packages/shared"
+
+type Amount uint64
+
+type Account struct {
+	Owner   string
+	Balance Amount
+	Kind    shared.Kind
+}
+
+type Total = Amount
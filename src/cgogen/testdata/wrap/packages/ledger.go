@@ -0,0 +1,21 @@
+package packages
+
+import "example.com/lib/packages/shared"
+
+// Declared before the types of the other source it uses
+type Book struct {
+	Entries [4]Entry
+	Owner   Account
+}
+
+type Entry struct {
+	Amount  Amount
+	Account *Account
+	Tags    shared.Tags
+}
+
+// Aliases declared by the other sources
+type Summary struct {
+	Total    Total
+	Category shared.Category
+}
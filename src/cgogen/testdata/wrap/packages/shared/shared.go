@@ -0,0 +1,10 @@
+package shared
+
+type Kind int32
+
+type Tags struct {
+	Names []string
+	Kind  Kind
+}
+
+type Category = Kind
@@ -0,0 +1,29 @@
+package pointerrules
+
+import (
+	"context"
+	"io"
+)
+
+type (
+	Good struct{ A int }
+	Bad  struct {
+		F func()
+		R io.Reader
+	}
+)
+
+type WithMap struct {
+	M map[string]string
+}
+
+type Dep struct{ B Bad }
+
+func UsesReader(r io.Reader) int               { return 0 }
+func UsesFunc(f func()) int                    { return 0 }
+func ReturnsCtx() context.Context              { return nil }
+func (g *Good) Take(b Bad, x int) (int, error) { return 0, nil }
+func UseMap(w WithMap) WithMap                 { return w }
+func UseDep(d *Dep)                            {}
+func Fine(a int) int                           { return a }
+func KeepRecord(r Record) int                  { return len(r.Tags) }
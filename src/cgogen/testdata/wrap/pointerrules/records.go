@@ -0,0 +1,6 @@
+package pointerrules
+
+// Declared by another file than the functions using it
+type Record struct {
+	Tags []string
+}
@@ -0,0 +1,6 @@
+package rawstrings
+
+// String results are returned as Go strings when they aren't dealt as GoString_
+func Greet(name string) string { return "Hello " + name }
+
+func Lookup(key string) (string, error) { return key, nil }
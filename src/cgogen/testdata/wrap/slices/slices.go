@@ -0,0 +1,15 @@
+package slices
+
+type Point struct {
+	X, Y int
+}
+
+type Names []string
+
+func Bytes(b []byte) []byte                          { return b }
+func Nested(in [][]byte) ([][]byte, error)           { return in, nil }
+func Strings(s []string) []string                    { return s }
+func Points(p []Point) []Point                       { return p }
+func PointPtrs(p []*Point) []*Point                  { return p }
+func ListNames(n Names) Names                        { return n }
+func Ints(v []int) (int, error)                      { return len(v), nil }
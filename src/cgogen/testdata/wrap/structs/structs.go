@@ -0,0 +1,25 @@
+package structs
+
+type Inner struct {
+	Label string
+	Data  []byte
+}
+
+type Outer struct {
+	ID    uint64
+	In    Inner
+	Ptr   *Inner
+	Items []Inner
+	Key   [4]byte
+}
+
+type Plain struct {
+	A, B int32
+	C    float64
+}
+
+func (o *Outer) Rename(s string)       { o.In.Label = s }
+func MakeOuter(o Outer) (Outer, error) { return o, nil }
+func UpdateOuter(o *Outer) *Outer      { return o }
+func MovePlain(p Plain) Plain          { return p }
+func (p *Plain) Scale(f float64)       { p.C *= f }
@@ -0,0 +1,12 @@
+package tags
+
+// Both fields are generated as Total
+type Totals struct {
+	Sum   uint64 `cgogen:"name=Total"`
+	Total uint64
+}
+
+// Not generated without the struct it holds
+type Report struct {
+	Totals Totals
+}
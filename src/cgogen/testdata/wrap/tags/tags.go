@@ -0,0 +1,32 @@
+package tags
+
+type Session struct {
+	Events chan string
+}
+
+type Peer struct {
+	Address string
+	Inbox   chan []byte
+}
+
+// Renamed members keep the struct cast
+type Transfer struct {
+	From   uint32
+	Amount uint64 `cgogen:"name=amount" json:"amount"`
+}
+
+// Converted field by field, the channel isn't a member
+type Account struct {
+	Name    string
+	Balance uint64     `cgogen:"name=balance"`
+	Updates chan int64 `cgogen:"-"`
+	Session *Session   `cgogen:"handle"`
+	Peer    Peer       `cgogen:"handle"`
+	Note    string     `cgogen:"name=note,compact"`
+}
+
+func Send(transfer *Transfer) uint64 { return transfer.Amount }
+
+func Open(name string) Account { return Account{Name: name} }
+
+func Refresh(account *Account) {}
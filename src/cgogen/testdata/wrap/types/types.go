@@ -0,0 +1,45 @@
+package types
+
+import "time"
+
+// Declared before the types it uses
+type Order struct {
+	Buyer  Customer
+	Items  []Item
+	Total  Money
+	Placed time.Duration
+}
+
+type Customer struct {
+	Name    string
+	Address *Address
+}
+
+type Address struct {
+	Street string
+	Zip    [5]byte
+}
+
+type Item struct {
+	SKU   string
+	Price Money
+}
+
+type Money uint64
+
+type Embeds struct {
+	Address
+	Note string
+}
+
+type Callbacks struct {
+	OnDone func(int)
+	Sink   interface{}
+	Events chan int
+	Index  map[string]int
+}
+
+type Pointers struct {
+	Next *Pointers
+	Raw  uintptr
+}
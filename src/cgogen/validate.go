@@ -0,0 +1,112 @@
+package cgogen
+
+import (
+	"go/ast"
+
+	"github.com/dave/jennifer/jen"
+)
+
+/*
+Wrappers validate the arguments received from C before converting them.
+A NULL pointer where a value is expected, or NULL data with a non-zero
+length, makes the wrapper return <PREFIX>_ERROR_NULL_ARGUMENT. Fixed size
+arrays passed as GoSlice_ with a length other than the array length make it
+return <PREFIX>_ERROR_INVALID_LENGTH. Both codes are defined by the library.
+*/
+
+const (
+	errorNullArgument  = "_ERROR_NULL_ARGUMENT"
+	errorInvalidLength = "_ERROR_INVALID_LENGTH"
+)
+
+// Returns jen code making the wrapper return the error when cond holds
+func (g *Generator) getFailIfCode(cond jen.Code, errorName string) jen.Code {
+	return jen.If(cond).Block(jen.Id(returnVarName).Op("=").Id(g.functionPrefix+errorName), jen.Return())
+}
+
+// Returns jen code making a conversion helper return an error for NULL data with non-zero length
+func (g *Generator) getNullDataCheckCode(data jen.Code, length jen.Code) jen.Code {
+	return jen.If(jen.Add(data).Op("==").Nil().Op("&&").Add(length).Op("!=").Lit(0)).
+		Block(jen.Return(jen.Id(g.functionPrefix + errorNullArgument)))
+}
+
+func (g *Generator) getNullArgumentCheckCode(name string) jen.Code {
+	return g.getFailIfCode(jen.Id(name).Op("==").Nil(), errorNullArgument)
+}
+
+// Returns jen code validating an input parameter of the wrapper.
+// typeName is the type of the parameter in the wrapper signature.
+func (g *Generator) getValidateInParameterCode(fast *ast.File, typeExpr ast.Expr, name string, typeName string) []jen.Code {
+	if isContextType(fast, typeExpr) {
+		return nil
+	}
+	if g.findConverter(fast, typeExpr) != nil {
+		return jenCodeToArray(g.getNullArgumentCheckCode(name))
+	}
+	switch t := typeExpr.(type) {
+	case *ast.StarExpr:
+		// Nil pointers are passed on unless their value has to be copied
+		if g.needsDeepConversion(fast, t.X) {
+			return jenCodeToArray(g.getNullArgumentCheckCode(name))
+		}
+		if arrayExpr, isArray := (t.X).(*ast.ArrayType); isArray && arrayExpr.Len != nil {
+			return g.getValidateFixedArrayCode(fast, arrayExpr, name)
+		}
+		return nil
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return g.getValidateFixedArrayCode(fast, t, name)
+		}
+		if len(typeName) > 0 && typeName[0] == '[' {
+			header := jen.Parens(jen.Op("*").Qual("reflect", "SliceHeader")).
+				Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Op("&").Id(name)))
+			return jenCodeToArray(g.getFailIfCode(jen.Add(header).Dot("Data").Op("==").Lit(0).Op("&&").
+				Len(jen.Id(name)).Op("!=").Lit(0), errorNullArgument))
+		}
+		// Slices converted by helpers are checked there
+		return nil
+	}
+	if typeName == "string" {
+		header := jen.Parens(jen.Op("*").Qual("reflect", "StringHeader")).
+			Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Op("&").Id(name)))
+		return jenCodeToArray(g.getFailIfCode(jen.Add(header).Dot("Data").Op("==").Lit(0).Op("&&").
+			Len(jen.Id(name)).Op("!=").Lit(0), errorNullArgument))
+	}
+	if len(typeName) > 0 && typeName[0] == '*' {
+		// Values passed by reference
+		return jenCodeToArray(g.getNullArgumentCheckCode(name))
+	}
+	return nil
+}
+
+// Returns whether the code validating the input parameter rejects NULL values
+func (g *Generator) checksNullArgument(fast *ast.File, typeExpr ast.Expr, typeName string) bool {
+	if isContextType(fast, typeExpr) {
+		return false
+	}
+	if g.findConverter(fast, typeExpr) != nil {
+		return true
+	}
+	switch t := typeExpr.(type) {
+	case *ast.StarExpr:
+		arrayExpr, isArray := (t.X).(*ast.ArrayType)
+		return g.needsDeepConversion(fast, t.X) || (isArray && arrayExpr.Len != nil)
+	case *ast.ArrayType:
+		return t.Len != nil
+	}
+	return len(typeName) > 0 && typeName[0] == '*'
+}
+
+// Returns jen code validating a fixed size array passed as a GoSlice_
+func (g *Generator) getValidateFixedArrayCode(fast *ast.File, arrayExpr *ast.ArrayType, name string) []jen.Code {
+	arrayLen, ok := g.evalArrayLen(fast, arrayExpr.Len)
+	if !ok {
+		return jenCodeToArray(g.getNullArgumentCheckCode(name))
+	}
+	return jenCodeToArray(
+		g.getNullArgumentCheckCode(name),
+		g.getFailIfCode(jen.Id(name).Dot("len").Op("!=").Id(arrayLen), errorInvalidLength),
+		g.getFailIfCode(jen.Id(name).Dot("data").Op("==").Nil().Op("&&").Id(name).Dot("len").Op("!=").Lit(0),
+			errorNullArgument),
+	)
+}
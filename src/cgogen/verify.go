@@ -0,0 +1,195 @@
+package cgogen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+/*
+With -verify the generated bindings are compiled and run as C code would use
+them. The package of the wrappers is built with go build -buildmode=c-archive,
+then a C program calling the wrappers is compiled against the archive and its
+header with the C compiler given by CC, cc by default, and run.
+
+Wrappers with a parameter checked against NULL, such as their outputs, are
+called with NULL pointers and zero values, and must reject them with an error
+code. Other wrappers, such as those passing NULL pointers on to the wrapped
+function, are only linked, since calling them would run the wrapped functions
+with values they may not expect. The bindings can only be verified for the host platform.
+*/
+
+// Wrapper exported to C and its parameters
+type exportedWrapper struct {
+	name   string
+	params []wrapperParam
+	// Function freeing the outputs, if any, and its parameters
+	free       string
+	freeParams []wrapperParam
+	// Types of the copyFromC_ helpers reading the parameters, by parameter
+	inputHelpers map[string]string
+	// Whether the smoke test of -cgocheck calls the wrapper
+	smoke bool
+}
+
+// Names of the archive and the header built from the package of the wrappers
+const (
+	verifyArchive = "libcgogen.a"
+	verifyHeader  = "libcgogen.h"
+)
+
+// Builds and runs the C smoke test of the wrappers saved in every output directory
+func (g *Generator) verifyBindings(jobs []*fileJob) {
+	if g.target.goos != runtime.GOOS || g.target.goarch != runtime.GOARCH {
+		g.reportWarning("bindings for %v not verified, only those for %s/%s can be run",
+			g.target, runtime.GOOS, runtime.GOARCH)
+		return
+	}
+	var dirs []string
+	wrappers := make(map[string][]exportedWrapper)
+	for _, job := range jobs {
+		if !job.generated || job.outputFileGO == "" {
+			continue
+		}
+		dir := filepath.Dir(job.outputFileGO)
+		if _, found := wrappers[dir]; !found {
+			dirs = append(dirs, dir)
+		}
+		wrappers[dir] = append(wrappers[dir], job.wrappers...)
+	}
+	for _, dir := range dirs {
+		if err := g.verifyPackage(dir, wrappers[dir]); err != nil {
+			g.reportError("%s: %v", dir, err)
+		}
+	}
+}
+
+// Builds the package in dir as a C archive, then compiles and runs the C smoke test of its wrappers
+func (g *Generator) verifyPackage(dir string, wrappers []exportedWrapper) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := ioutil.TempDir("", "cgogen")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, verifyArchive)
+	build := exec.Command("go", "build", "-buildmode=c-archive", "-o", archive, ".")
+	build.Dir = dir
+	if output, err := build.CombinedOutput(); err != nil {
+		return fmt.Errorf("building the C archive failed: %v\n%s", err, output)
+	}
+
+	program := filepath.Join(tmpDir, "smoke.c")
+	if err := ioutil.WriteFile(program, []byte(generateCSmokeTest(verifyHeader, wrappers)), 0644); err != nil {
+		return err
+	}
+	binary := filepath.Join(tmpDir, "smoke")
+	compiler := cCompiler()
+	args := append(compiler[1:], "-o", binary, "-I", absDir, program, archive)
+	args = append(args, cLinkFlags(runtime.GOOS)...)
+	compile := exec.Command(compiler[0], args...)
+	if output, err := compile.CombinedOutput(); err != nil {
+		return fmt.Errorf("compiling the C smoke test failed: %v\n%s", err, output)
+	}
+
+	output, err := exec.Command(binary).CombinedOutput()
+	g.applog("C smoke test output:\n%s", output)
+	if err != nil {
+		return fmt.Errorf("C smoke test failed: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// Returns the command line of the C compiler, from CC if set
+func cCompiler() []string {
+	if compiler := strings.Fields(os.Getenv("CC")); len(compiler) > 0 {
+		return compiler
+	}
+	return []string{"cc"}
+}
+
+// Returns the flags linking the libraries needed by the Go runtime of a C archive
+func cLinkFlags(goos string) []string {
+	switch goos {
+	case "darwin", "ios":
+		return []string{"-framework", "CoreFoundation", "-framework", "Security"}
+	case "windows":
+		return []string{"-lwinmm", "-lntdll", "-lws2_32"}
+	default:
+		return []string{"-lpthread", "-lm"}
+	}
+}
+
+// Returns the C type of a wrapper parameter in the header exported by cgo
+func exportCType(typeName string) string {
+	switch {
+	case strings.HasPrefix(typeName, "*"):
+		return exportCType(typeName[1:]) + "*"
+	case strings.HasPrefix(typeName, "C."):
+		return typeName[len("C."):]
+	case strings.HasPrefix(typeName, "[]"), strings.HasPrefix(typeName, "..."):
+		return "GoSlice"
+	case strings.HasPrefix(typeName, "map["):
+		return "GoMap"
+	case strings.HasPrefix(typeName, "chan "):
+		return "GoChan"
+	case strings.HasPrefix(typeName, "interface"):
+		return "GoInterface"
+	case typeName == "bool":
+		return "GoUint8"
+	}
+	if ctype, ok := GetCTypeFromGoType(typeName); ok {
+		// cgo names the basic types as the primitives header, without the suffix
+		return strings.TrimSuffix(ctype, "_")
+	}
+	return typeName
+}
+
+// Returns whether the wrapper rejects the zero values of its parameters
+func rejectsZeroValues(wrapper exportedWrapper) bool {
+	for _, param := range wrapper.params {
+		if param.checksNull {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the C program calling the wrappers declared in header.
+// Its exit status is the number of wrappers accepting NULL pointers.
+func generateCSmokeTest(header string, wrappers []exportedWrapper) string {
+	var code strings.Builder
+	code.WriteString("// Code generated by cgogen. DO NOT EDIT.\n\n")
+	code.WriteString("#include <stdio.h>\n#include <string.h>\n\n")
+	code.WriteString("#include \"" + header + "\"\n\n")
+	code.WriteString("int main(void) {\n")
+	code.WriteString("\tint failed = 0;\n")
+	for _, wrapper := range wrappers {
+		if !rejectsZeroValues(wrapper) {
+			fmt.Fprintf(&code, "\tprintf(\"%s linked %%d\\n\", %s != NULL);\n", wrapper.name, wrapper.name)
+			continue
+		}
+		code.WriteString("\t{\n")
+		args := make([]string, 0, len(wrapper.params))
+		for i, param := range wrapper.params {
+			arg := fmt.Sprintf("arg%d", i)
+			fmt.Fprintf(&code, "\t\t%s %s;\n", exportCType(param.typeName), arg)
+			fmt.Fprintf(&code, "\t\tmemset(&%s, 0, sizeof(%s));\n", arg, arg)
+			args = append(args, arg)
+		}
+		fmt.Fprintf(&code, "\t\tGoUint32 code = %s(%s);\n", wrapper.name, strings.Join(args, ", "))
+		fmt.Fprintf(&code, "\t\tprintf(\"%s %%u\\n\", (unsigned)code);\n", wrapper.name)
+		code.WriteString("\t\tif (code == 0) {\n\t\t\tfailed++;\n\t\t}\n")
+		code.WriteString("\t}\n")
+	}
+	code.WriteString("\treturn failed;\n}\n")
+	return code.String()
+}
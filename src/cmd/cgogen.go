@@ -1,42 +1,26 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
-	"log"
+	"go/build"
 	"os"
-	"strings"
+	"runtime"
 
-	"github.com/dave/jennifer/jen"
+	"github.com/simelo/cgogen/src/cgogen"
 )
 
-type Config struct {
-	Path                    string
-	Verbose                 bool
-	ProcessFunctions        bool
-	ProcessTypes            bool
-	OutputFileGO            string
-	OutputFileC             string
-	OutputFileCH            string
-	ProcessDependencies     bool
-	DependOnlyExternal      bool
-	TypeDependencyFile      string
-	FuncDependencyFile      string
-	TypeConversionFile      string
-	IgnoreDependants        bool
-	FullTranspile           bool //Full conversion to c code
-	FullTranspileDir        string
-	FullTranspileOut        string
-	MainPackagePath         string
-	PrefixLib               string
-	DealOutStringAsGostring bool
+type options struct {
+	cgogen.Config
+	Path         string
+	OutputFileGO string
+	OutputFileC  string
+	OutputFileCH string
+	BatchFile    string
+	OutputDir    string
 }
 
-func (c *Config) register() {
+func (c *options) register() {
 	flag.StringVar(&c.Path, "i", "", "PATH to source file")
 	flag.StringVar(&c.OutputFileGO, "g", "", "PATH to destination file for go code")
 	flag.StringVar(&c.OutputFileC, "c", "", "PATH to destination file for C code")
@@ -56,1337 +40,106 @@ func (c *Config) register() {
 	flag.StringVar(&c.MainPackagePath, "main", "", "Define main package path the functions")
 	flag.StringVar(&c.PrefixLib, "prefix", "SKY", "Define prefix the function and type error export")
 	flag.BoolVar(&c.DealOutStringAsGostring, "dealoutString", true, "Disable or enable export GoString")
+	flag.StringVar(&c.ConvertersFile, "conv", "", "PATH to JSON file with project type converters")
+	flag.StringVar(&c.OutputFilePrimitivesH, "ph", "", "PATH to destination file for C primitive types header")
+	flag.StringVar(&c.TargetOS, "goos", build.Default.GOOS, "Target operating system")
+	flag.StringVar(&c.TargetArch, "goarch", build.Default.GOARCH, "Target architecture")
+	flag.StringVar(&c.OutputFileContextGO, "ctx", "", "PATH to destination file for go code of the cancellation tokens API")
+	flag.BoolVar(&c.VerifyCgocheck, "cgocheck", false, "Run a smoke test of the conversions of the generated wrappers, and of the wrappers of setting CGOGEN SMOKE, under cgocheck=2")
+	flag.BoolVar(&c.Verify, "verify", false, "Build the wrappers as a C archive, then compile and run a C smoke test calling them")
+	flag.BoolVar(&c.LayoutTest, "layouttest", false, "Generate a Go test beside the wrappers comparing the layouts of the C types with those of the Go types")
+	flag.BoolVar(&c.FlattenEmbedded, "flatten", false, "Flatten the fields promoted from embedded structs into the C structs embedding them")
+	flag.StringVar(&c.ManifestFile, "manifest", "", "PATH to manifest file used to skip unchanged sources")
+	flag.StringVar(&c.BatchFile, "batch", "", "PATH to file listing the sources to process, one per line as -i SRC [-g GO] [-h H]")
+	flag.StringVar(&c.OutputDir, "out", "cgo", "Directory of the outputs when run by go generate, relative to the package")
+	flag.IntVar(&c.Workers, "j", 0, "Number of sources processed in parallel, the number of CPUs if 0 and 1 with -d")
+	flag.StringVar(&c.CoverageFile, "cov", "", "PATH to destination file for the JSON report of the API wrapped and skipped")
+	flag.StringVar(&c.CoverageTextFile, "covtxt", "", "PATH to destination file for the text report of the API wrapped and skipped")
+	flag.BoolVar(&c.WarningsAsErrors, "Werror", false, "Treat warnings as errors")
+	flag.BoolVar(&c.Check, "check", false, "Compare the generated code with the files on disk, print the differences and fail if any")
 }
 
-var (
-	cfg    Config
-	applog = func(format string, v ...interface{}) {
-		// Logging disabled
-	}
-)
-
-//Map of types that will replaced by custom types
-var customTypesMap = make(map[string]string)
-
-// Configure prefix
-var (
-	functionPrefix = ""
-	includePrefix  = ""
-)
-
-//Types that will use functions of type inplace to convert
-var inplaceConvertTypesPackages map[string]string
-
-var (
-	mainPackagePath = ""
-	packagePath     = ""
-)
-
-var arrayTypes map[string]string
-
-//Imports used in this code file
-var importDefs []*ast.GenDecl
-
-//types that will be replaced by handles
-var handleTypes map[string]string
-var returnVarName = "____error_code"
-var returnErrName = "____return_err"
-var dealOutStringAsGostring bool
-var getPackagePathFromFilename bool
-
 func main() {
-	handleTypes = make(map[string]string)
-	arrayTypes = make(map[string]string)
-	cfg.register()
+	var opts options
+	opts.register()
 	flag.Parse()
-	if cfg.MainPackagePath == "" {
-		fmt.Println("The main package path is required")
-		return
-	}
-	packagePath, mainPackagePath = getPathPackage(cfg.MainPackagePath)
-	functionPrefix = strings.ToUpper(string(cfg.PrefixLib))
-	includePrefix = strings.ToLower(cfg.PrefixLib)
-	dealOutStringAsGostring = cfg.DealOutStringAsGostring
-	log.Println("Load prefix " + functionPrefix)
-
-	inplaceConvertTypesPackages = make(map[string]string)
-
-	if cfg.Verbose {
-		applog = log.Printf
-	}
-
-	if cfg.FullTranspile {
-		doFullTranspile()
-		getPackagePathFromFilename = false
-	} else {
-		doGoFile()
-		getPackagePathFromFilename = true
-	}
-	applog("Number of array types : %d", len(arrayTypes))
-	applog("Number of handle types :  %d", len(handleTypes))
-	applog("Number of custom types : %d", len(customTypesMap))
-}
-
-func doGoFile() {
-	var dependantFunctions []string
-	var dependantTypes []string
-	var typeConversions []string
-	if cfg.ProcessDependencies {
-		if cfg.TypeDependencyFile != "" {
-			dependantTypes = loadDependencyFile(cfg.TypeDependencyFile, "|")
-		}
-		if cfg.FuncDependencyFile != "" {
-			dependantFunctions = loadDependencyFile(cfg.FuncDependencyFile, "\n")
-		}
-	}
-	if cfg.TypeConversionFile != "" {
-		typeConversions = loadDependencyFile(cfg.TypeConversionFile, "\n")
-		for _, str := range typeConversions {
-			processTypeSetting(str)
-		}
-	}
-	applog("Opening %v \n", cfg.Path)
-	fo, err := os.Open(cfg.Path)
-	check(err)
-
-	defer fo.Close()
-
-	fset := token.NewFileSet()
-	fast, err := parser.ParseFile(fset, "", fo, parser.AllErrors|parser.ParseComments)
-	check(err)
-
-	packagePath := ""
-	if getPackagePathFromFilename {
-		packagePath = getPackagePathFromFileName(cfg.Path) + "/" + fast.Name.Name
-		applog("Package Path: %s ", packagePath)
-	}
-	if packagePath == "" {
-		packagePath = fast.Name.Name
-	}
-
-	var outFile *jen.File
-
-	if cfg.ProcessFunctions {
-		outFile = jen.NewFile("main")
-
-		outFile.CgoPreamble(`
-	  #include <string.h>
-	  #include <stdlib.h>
-	  
-	  #include "` + includePrefix + `types.h"`)
-	}
-
-	typeDefs := make([]*ast.GenDecl, 0)
-
-	for _, _decl := range fast.Decls {
-
-		if cfg.ProcessFunctions {
-			if decl, ok := (_decl).(*ast.FuncDecl); ok {
-
-				var plist *[]string
-				if cfg.ProcessDependencies {
-					plist = &dependantTypes
-				}
-				if isDependant := processFunc(fast, decl, outFile, plist); isDependant {
-					addDependant(&dependantFunctions, packagePath+" "+decl.Name.Name)
-				}
-			}
-		}
-		if cfg.ProcessTypes {
-			if decl, ok := (_decl).(*ast.GenDecl); ok {
-				if decl.Tok == token.TYPE {
-					typeDefs = append(typeDefs, decl)
-				} else if decl.Tok == token.IMPORT {
-					importDefs = append(importDefs, decl)
-				}
-			}
-		}
-	}
-	if cfg.ProcessTypes {
-		typeDefsCode := processTypeDefs(fast, typeDefs, &dependantTypes)
-		if cfg.OutputFileCH != "" {
-			saveTextToFile(cfg.OutputFileCH, typeDefsCode)
-		} else {
-			fmt.Println(typeDefsCode)
-		}
-	}
-	if cfg.ProcessFunctions {
-		if cfg.OutputFileGO != "" {
-			err := outFile.Save(cfg.OutputFileGO)
-			check(err)
-		} else {
-			fmt.Printf("%#v", outFile)
-		}
-	}
-	if cfg.ProcessDependencies {
-		if cfg.TypeDependencyFile != "" {
-			saveDependencyFile(cfg.TypeDependencyFile, dependantTypes, "|")
-
-		} else {
-			fmt.Println("Dependant Types: ", dependantTypes)
-		}
-		if cfg.FuncDependencyFile != "" {
-			saveDependencyFile(cfg.FuncDependencyFile, dependantFunctions, "\r\n")
-		} else {
-			fmt.Println("Dependant Functions: ", dependantFunctions)
-		}
-	}
-	applog("Finished %v", cfg.Path)
-	if cfg.OutputFileGO != "" {
-		fixExportComment(cfg.OutputFileGO)
-	}
-}
-
-func doFullTranspile() {
-	if cfg.FullTranspileDir == "" {
-		fmt.Println("Must specify full transpile source directory")
-		return
-	}
-	if cfg.FullTranspileOut == "" {
-		fmt.Println("Must specify full transpile destination directory")
-		return
-	}
-	Full_Transpile(cfg.FullTranspileDir, cfg.FullTranspileOut)
+	os.Exit(run(&opts))
 }
 
-func saveTextToFile(fileName string, text string) {
-	f, err := os.Create(fileName)
-	check(err)
-	defer f.Close()
-	_, err = f.WriteString(text)
-	check(err)
-	err = f.Sync()
-	check(err)
+// Whether cgogen was run by go generate to wrap the package of the directive
+func (c *options) isGoGenerate() bool {
+	return os.Getenv("GOFILE") != "" && c.Path == "" && c.BatchFile == "" && !c.FullTranspile
 }
 
-func saveDependencyFile(path string, list []string, separator string) {
-	f, err := os.Create(path)
-	check(err)
-	defer f.Close()
-	_, err = f.WriteString(strings.Join(list, separator))
-	check(err)
-	err = f.Sync()
-	check(err)
-}
-
-func loadDependencyFile(path string, separator string) (list []string) {
-	f, err := os.Open(path)
-	if err == nil {
-		defer f.Close()
-		buf := new(bytes.Buffer)
-		_, err = buf.ReadFrom(f)
-		check(err)
-		contents := buf.String()
-		tlist := strings.Split(contents, separator)
-		for _, str := range tlist {
-			nstr := strings.Replace(str, "\r", "", -1)
-			nstr = strings.Replace(nstr, "\n", "", -1)
-			if nstr != "" {
-				list = append(list, nstr)
-			}
-		}
-	}
-	return
-}
-
-func check(err error) {
+// Loads the package of go generate and applies its directives.
+// Flags of the go:generate line override those of the directives.
+func (c *options) loadGoGeneratePackage() ([]cgogen.Source, error) {
+	pkg, err := cgogen.LoadPackage(".", os.Getenv("GOPACKAGE"))
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
-}
-
-func isAsciiUpper(c rune) bool {
-	return c >= 'A' && c <= 'Z'
-}
-
-//Returns the path of the package imported
-func findImportPath(importName string) (string, bool) {
-	for _, importDef := range importDefs {
-		for _, s := range importDef.Specs {
-			if importSpec, isImportSpec := (s).(*ast.ImportSpec); isImportSpec {
-				name := ""
-				path := importSpec.Path.Value
-
-				path = strings.TrimPrefix(path, "\"")
-
-				path = strings.TrimSuffix(path, "\"")
-
-				if importSpec.Name != nil {
-					name = importSpec.Name.Name
-				} else {
-					pathParts := strings.Split(path, "/")
-					if len(pathParts) > 0 {
-						name = pathParts[len(pathParts)-1]
-					}
-				}
-				if name == importName {
-					return path, true
-				}
-			}
-		}
-	}
-	return "", false
-}
-
-func isLibName(importName string) bool {
-	path, result := findImportPath(importName)
-	if result {
-		return strings.HasPrefix(path, packagePath)
-	} else {
-		return false
+	if err := flag.CommandLine.Parse(pkg.Args); err != nil {
+		return nil, err
 	}
-}
-
-func isExternalName(importName string) bool {
-	path, result := findImportPath(importName)
-	if result {
-		return strings.HasPrefix(path, "github.com/") || strings.HasPrefix(path, "golang.org/")
-	} else {
-		return false
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		return nil, err
 	}
-}
-
-func typeSpecStr(_typeExpr *ast.Expr, packageName string, isOutput bool) (string, bool) {
-	addPointer := false
-	spec := ""
-	for _typeExpr != nil {
-		if arrayExpr, isArray := (*_typeExpr).(*ast.ArrayType); isArray {
-			if arrayExpr.Len != nil || isOutput {
-				return "*C.GoSlice_", true
-			} else {
-				spec += "[]"
-				_typeExpr = &arrayExpr.Elt
-				continue
-			}
-		}
-		if starExpr, isStar := (*_typeExpr).(*ast.StarExpr); isStar {
-			spec += "*"
-			_typeExpr = &starExpr.X
-			continue
-		}
-		if ellipsisExpr, isEllipsis := (*_typeExpr).(*ast.Ellipsis); isEllipsis {
-			tspec, ok := typeSpecStr(&ellipsisExpr.Elt, packageName, isOutput)
-			if ok {
-				spec += "..." + tspec
-				_typeExpr = nil
-				continue
-			} else {
-				return "", false
-			}
-		}
-		if _, isFunc := (*_typeExpr).(*ast.FuncType); isFunc {
-			return "", false
-		}
-		if _, isStruct := (*_typeExpr).(*ast.StructType); isStruct {
-			spec += "struct{}"
-			_typeExpr = nil
-			continue
-		}
-		if _, isIntf := (*_typeExpr).(*ast.InterfaceType); isIntf {
-			return "", false
-		}
-		if _, isChan := (*_typeExpr).(*ast.ChanType); isChan {
-			// TODO: Improve func type translation
-			spec += "C.GoChan_"
-			_typeExpr = nil
-			continue
-		}
-		if mapExpr, isMap := (*_typeExpr).(*ast.MapType); isMap {
-			tspeckey, okkey := typeSpecStr(&mapExpr.Key, packageName, false)
-			tspecvalue, okvalue := typeSpecStr(&mapExpr.Key, packageName, false)
-			if okkey && okvalue {
-				return spec + "map[" + tspeckey + "]" + tspecvalue, true
-			} else {
-				return "", false
-			}
-		}
-		identExpr, isIdent := (*_typeExpr).(*ast.Ident)
-		selExpr, isSelector := (*_typeExpr).(*ast.SelectorExpr)
-		if isIdent || isSelector {
-			isDealt := false
-			externPackage := packageName
-			typeName := ""
-			if isIdent {
-				typeName = identExpr.Name
-				isDealt = isInHandleTypesList(typeName)
-				if isDealt {
-					spec = getHandleName(typeName)
-				} else if isInCustomTypesList(typeName) {
-					spec = getCustomTypeName(typeName)
-					isDealt = true
-				}
-			} else {
-				typeName = selExpr.Sel.Name
-				identSelExpr, isSelIdent := (selExpr.X).(*ast.Ident)
-				if isSelIdent {
-					externPackage = identSelExpr.Name
-					isDealt = isInHandleTypesList(externPackage + "." + typeName)
-					if isDealt {
-						spec = getHandleName(externPackage + "." + typeName)
-					} else if isInCustomTypesList(externPackage + "." + typeName) {
-						spec = getCustomTypeName(externPackage + "." + typeName)
-						isDealt = true
-					} else if !isLibName(externPackage) {
-						return externPackage, false
-					}
-				}
-			}
-			if !isDealt {
-				if isInHandleTypesList(externPackage + packageSeparator + typeName) {
-					spec = getHandleName(externPackage + packageSeparator + typeName)
-				} else if isInCustomTypesList(externPackage + packageSeparator + typeName) {
-					spec = getCustomTypeName(externPackage + packageSeparator + typeName)
-				} else {
-					isExported := isAsciiUpper(rune(typeName[0]))
-					if spec == "" && !addPointer && isExported {
-						addPointer = true
-					}
-					if isExported {
-						spec += "C." + externPackage + packageSeparator
-					} else {
-						if !IsBasicGoType(typeName) {
-							return "", false //Don't deal with unexported types
-						}
-					}
-					spec += typeName
-				}
-			}
-			_typeExpr = nil
-		} else {
-			applog("No rules to follow with %s", (*_typeExpr).(*ast.Ident))
-			_typeExpr = nil
+	if c.MainPackagePath == "" {
+		if pkg.ImportPath == "" {
+			return nil, fmt.Errorf("%s is not in GOPATH, set the main package path with -main", pkg.Dir)
 		}
+		c.ImportPath = pkg.ImportPath
 	}
-	if addPointer {
-		return "*" + spec, true
+	c.TypeSettings = append(c.TypeSettings, pkg.TypeSettings...)
+	if !c.ProcessFunctions && !c.ProcessTypes {
+		c.ProcessFunctions, c.ProcessTypes = true, true
 	}
-	return spec, true
-}
-
-func argName(name string) string {
-	return "_" + name
-}
-
-func resultName(name string) string {
-	return "__" + name
-}
-
-func isInHandleTypesList(typeName string) bool {
-	_, ok := handleTypes[typeName]
-	return ok
-}
-
-func isInCustomTypesList(typeName string) bool {
-	_, ok := customTypesMap[typeName]
-	return ok
-}
-
-func getHandleName(typeName string) string {
-	return "*C." + handleTypes[typeName] + packageSeparator + "Handle"
-}
-
-func getSliceName(typeName string) string {
-	return arrayTypes[typeName] + "__" + typeName
-}
-
-func getCustomTypeName(typeName string) string {
-	return "*C." + customTypesMap[typeName]
-}
-
-/*
-Get the package path from file name. Assumes that file is formed by joining path folders with dot
-Example: pack.folder1.folder2  ==>  pack/folder1/folder2
-*/
-func getPackagePathFromFileName(filePath string) string {
-	packagePath := ""
-	folders := strings.Split(filePath, "/")
-	if len(folders) > 0 {
-		fileName := folders[len(folders)-1]
-		packageFolders := strings.Split(fileName, ".")
-		if len(packageFolders) > 2 {
-			packageFolders = packageFolders[:len(packageFolders)-2]
-			var result []string
-			for _, s := range packageFolders {
-				if s == "internal" || s == "example" {
-					break
-				} else {
-					result = append(result, s)
-				}
-			}
-			packagePath = strings.Join(result, "/")
-		}
+	if err := os.MkdirAll(c.OutputDir, 0755); err != nil {
+		return nil, err
 	}
-	return packagePath
+	return pkg.Sources(c.OutputDir), nil
 }
 
-//Create code for wrapper function
-func processFunc(fast *ast.File, fdecl *ast.FuncDecl, outFile *jen.File, dependantTypes *[]string) (isDependant bool) {
-	isDependant = false
-	packagePath := ""
-	if getPackagePathFromFilename {
-		packagePath = getPackagePathFromFileName(cfg.Path)
-	}
-	if packagePath == "" {
-		packagePath = fast.Name.Name
-	}
-
-	funcName := fdecl.Name.Name
-
-	if !fdecl.Name.IsExported() || strings.HasPrefix(funcName, "Must") {
-		applog("Skipping %v \n", funcName)
-		return
-	}
-
-	applog("Processing %v \n", funcName)
-	var blockParams []jen.Code
-
-	var params jen.Statement
-	var isPointerRecv bool
-	if receiver := fdecl.Recv; receiver != nil {
-		// Method
-		_type := &receiver.List[0].Type
-		typeName := ""
-		if starExpr, _isPointerRecv := (*_type).(*ast.StarExpr); _isPointerRecv {
-			_type = &starExpr.X
-			isPointerRecv = _isPointerRecv
-		}
-		if identExpr, isIdent := (*_type).(*ast.Ident); isIdent {
-			typeName = identExpr.Name
-		}
-		recvParamName := receiver.List[0].Names[0].Name
-		recvParam := jen.Id(argName(recvParamName))
-		typeSpec, ok := typeSpecStr(_type, fast.Name.Name, false)
-		if !ok || isTypeSpecInDependantList(typeSpec, dependantTypes) {
-			isDependant = true
-			if cfg.IgnoreDependants {
-				//TODO: stdevEclipse Check if type can be replaced by another type or handle
-				return
-			}
-		}
-		recvParam = recvParam.Id(typeSpec)
-		params = append(params, recvParam)
-		funcName = typeName + "_" + funcName
-		convertCodes := getCodeToConvertInParameter(_type, fast.Name.Name, recvParamName, isPointerRecv, outFile)
-		if convertCodes != nil {
-			blockParams = append(blockParams, convertCodes...)
-		}
-	}
-
-	allparams := fdecl.Type.Params.List[:]
-	returnFieldsIndex := len(allparams)
-	var retField *ast.Field = nil
-
-	if fdecl.Type.Results != nil && fdecl.Type.Results.List != nil {
-		//Find the return argument of type error.
-		//It should always be the last argument but search just in case
-		errorIndex := -1
-		for index, field := range fdecl.Type.Results.List {
-			identExpr, isIdent := (field.Type).(*ast.Ident)
-			if isIdent && identExpr.Name == "error" {
-				errorIndex = index
-				break
-			}
-		}
-		if errorIndex >= 0 {
-			retField = fdecl.Type.Results.List[errorIndex]
-			returnParams := append(fdecl.Type.Results.List[0:errorIndex], fdecl.Type.Results.List[errorIndex+1:]...)
-			allparams = append(allparams, returnParams...)
-		} else {
-			allparams = append(allparams, fdecl.Type.Results.List[:]...)
+// Runs cgogen printing its diagnostics, returns the exit status
+func run(opts *options) int {
+	var sources []cgogen.Source
+	if opts.isGoGenerate() {
+		var err error
+		if sources, err = opts.loadGoGeneratePackage(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
 		}
 	}
-
-	var outputVarsConvertCode []jen.Code
-
-	for fieldIdx, field := range allparams {
-		if fieldIdx >= returnFieldsIndex {
-			// Field in return types list
-			typeName, ok := typeSpecStr(&field.Type, fast.Name.Name, true)
-			if !ok || isTypeSpecInDependantList(typeName, dependantTypes) {
-				isDependant = true
-				if cfg.IgnoreDependants {
-					//TODO: stdevEclipse Check if type can be replaced by another type or handle
-					return
-				}
-			}
-			if len(typeName) > 0 && rune(typeName[0]) == '[' {
-				typeName = "*C.GoSlice_"
-			} else if dealOutStringAsGostring && typeName == "string" {
-				typeName = "*C.GoString_"
-			} else if IsBasicGoType(typeName) {
-				typeName = "*" + typeName
-			} else if typeName == "map[string]string" {
-				typeName = "*C.GoStringMap_"
-			}
-			paramName := argName("arg" + fmt.Sprintf("%d", fieldIdx))
-			params = append(params, jen.Id(paramName).Id(typeName))
-			convertCode := getCodeToConvertOutParameter(&field.Type, fast.Name.Name, paramName, false)
-			if convertCode != nil {
-				outputVarsConvertCode = append(outputVarsConvertCode, convertCode)
-			}
-
-		} else {
-			lastNameIdx := len(field.Names) - 1
-			for nameIdx, ident := range field.Names {
-				if nameIdx != lastNameIdx {
-					params = append(params, jen.Id(argName(ident.Name)))
-				} else {
-					typeName, ok := typeSpecStr(&field.Type, fast.Name.Name, false)
-					if !ok || isTypeSpecInDependantList(typeName, dependantTypes) {
-						isDependant = true
-						if cfg.IgnoreDependants {
-							//TODO: stdevEclipse Check if type can be replaced by another type or handle
-							return
-						}
-					}
-					params = append(params, jen.Id(
-						argName(ident.Name)).Id(typeName))
-				}
-				convertCodes := getCodeToConvertInParameter(&field.Type, fast.Name.Name, ident.Name, false, outFile)
-				if convertCodes != nil {
-					blockParams = append(blockParams, convertCodes...)
-				}
-			}
-		}
-	}
-
-	cfuncName := functionPrefix + "_" + fast.Name.Name + "_" + funcName
-	stmt := outFile.Comment("export " + cfuncName) //nolint staticcheck
-	stmt = outFile.Func().Id(cfuncName)
-	stmt = stmt.Params(params...)
-
-	var callparams []jen.Code
-	for _, field := range fdecl.Type.Params.List {
-		for _, name := range field.Names {
-			callparams = append(callparams, *jen.Id(name.Name)...)
-		}
+	if opts.Workers == 0 && !opts.ProcessDependencies {
+		opts.Workers = runtime.NumCPU()
 	}
-	var retvars []jen.Code
-	if returnFieldsIndex < len(allparams) {
-		for i := returnFieldsIndex; i < len(allparams); i++ {
-			retvars = append(retvars, jen.Id(resultName("arg"+fmt.Sprintf("%d", i))))
-		}
-	}
-	if retField != nil {
-		retvars = append(retvars, jen.Id(returnErrName))
-	}
-	var callFuncCode jen.Code
-	if len(retvars) > 0 {
-		if fdecl.Recv != nil {
-			callFuncCode =
-				jen.List(retvars...).Op(":=").Id(fdecl.Recv.List[0].Names[0].Name).Dot(fdecl.Name.Name).Call(callparams...)
-		} else {
-			if mainPackagePath != "" {
-				callFuncCode =
-					jen.List(retvars...).Op(":=").Qual(mainPackagePath+packagePath,
-						fdecl.Name.Name).Call(callparams...)
-			} else {
-				callFuncCode =
-					jen.List(retvars...).Op(":=").Id(fdecl.Name.Name).Call(callparams...)
-			}
-		}
-	} else {
-		if fdecl.Recv != nil {
-			callFuncCode = jen.Id(fdecl.Recv.List[0].Names[0].Name).Dot(fdecl.Name.Name).Call(callparams...)
-		} else {
-			if mainPackagePath != "" {
-				callFuncCode = jen.Qual(mainPackagePath+packagePath,
-					fdecl.Name.Name).Call(callparams...)
-			} else {
-				callFuncCode = jen.Id(fdecl.Name.Name).Call(callparams...)
-			}
-		}
-	}
-	blockParams = append(blockParams, callFuncCode)
-
-	stmt = stmt.Parens(jen.Id(returnVarName).Id("uint32"))
-	if retField != nil {
-		blockParams = append(blockParams, jen.Id(returnVarName).Op("=").Id("libErrorCode").Call(jen.Id(returnErrName)))
-		convertOutputCode := jen.If(jen.Id(returnErrName).Op("==").Nil()).Block(outputVarsConvertCode...)
-		blockParams = append(blockParams, convertOutputCode)
-	} else {
-		blockParams = append(blockParams, outputVarsConvertCode...)
-	}
-
-	blockParams = append(blockParams, jen.Return())
-
-	stmt.Block(blockParams...)
-	return
-}
-
-//Check if type is in dependant list
-func isTypeSpecInDependantList(typeSpec string, dependantList *[]string) bool {
-	if dependantList == nil {
-		return false
-	}
-	//Do not allow extern types in function parameters
-	if strings.Contains(typeSpec, "C._") {
-		return true
-	}
-	for _, t := range *dependantList {
-		if strings.HasSuffix(typeSpec, "C."+t) {
-			return true
-		}
-	}
-	return false
-}
-
-//Creates code to make a typecast
-//nolint unparam
-func getTypeCastCode(leftPart *jen.Statement, typeExpr *ast.Expr,
-	packName string, name string, outFile *jen.File) jen.Code {
-	if identExpr, isIdent := (*typeExpr).(*ast.Ident); isIdent {
-		typeName := identExpr.Name
-		if IsBasicGoType(typeName) {
-			return leftPart.Id(identExpr.Name)
-		} else {
-			return leftPart.Id(packName).Dot(typeName)
-		}
-	} else if selectorExpr, isSelector := (*typeExpr).(*ast.SelectorExpr); isSelector {
-		if identExpr, isIdent := (selectorExpr.X).(*ast.Ident); isIdent {
-			externPackage, found := findImportPath(identExpr.Name)
-			typeName := selectorExpr.Sel.Name
-			if found {
-				outFile.ImportAlias(externPackage, identExpr.Name)
-				return leftPart.Qual(externPackage, typeName)
-			} else {
-				return leftPart.Id(identExpr.Name).Dot(typeName)
-			}
-		}
-	}
-	return nil
-}
-
-func getLookupHandleCode(name string, typeName string, isPointer bool) []jen.Code {
-	varname := name
-	if !isPointer {
-		varname = "__" + name
-	}
-	listVar := jen.List(jen.Id(varname), jen.Id("ok"+name)).Op(":=")
-	lookUpName := "lookup" + handleTypes[typeName] + "Handle"
-	listVar = listVar.Id(lookUpName).Call(jen.Op("*").Id(argName(name)))
-	checkError := jen.If(jen.Op("!").Id("ok"+name)).
-		Block(jen.Id(returnVarName).Op("=").Id(functionPrefix+"_BAD_HANDLE"), jen.Return())
-	if !isPointer {
-		assign := jen.Id(name).Op(":=").Op("*").Id(varname)
-		return jenCodeToArray(listVar, checkError, assign)
-	} else {
-		return jenCodeToArray(listVar, checkError)
-	}
-}
-
-func jenCodeToArray(statements ...jen.Code) []jen.Code {
-	var codeArray []jen.Code
-	codeArray = append(codeArray, statements...)
-	return codeArray
-}
-
-/*Returns jen code to convert an input parameter from wrapper to original function*/
-func getCodeToConvertInParameter(_typeExpr *ast.Expr, packName string, name string, isPointer bool, outFile *jen.File) []jen.Code {
-	leftPart := jen.Id(name).Op(":=")
-	if arrayExpr, isArray := (*_typeExpr).(*ast.ArrayType); isArray {
-		typeExpr := arrayExpr.Elt
-		arrayLen := ""
-		if arrayExpr.Len != nil {
-			if litExpr, isLit := (arrayExpr.Len).(*ast.BasicLit); isLit {
-				arrayLen = litExpr.Value
-			}
-		}
-		arrayPart := jen.Op("*").Op("[" + arrayLen + "]")
-		arrayTypeCode := getTypeCastCode(arrayPart, &typeExpr, packName, name, outFile)
-		if arrayTypeCode != nil {
-			if !isPointer {
-				leftPart = leftPart.Op("*")
-			}
-			leftPart = leftPart.Parens(arrayTypeCode)
-			var argCode jen.Code
-			if !isPointer && arrayExpr.Len == nil {
-				argCode = jen.Op("&").Id(argName(name))
-			} else {
-				argCode = jen.Id(argName(name))
-			}
-			rightCode := jen.Qual("unsafe", "Pointer").Parens(argCode)
-			leftPart = leftPart.Parens(rightCode)
-			return jenCodeToArray(leftPart)
-		}
-	} else if starExpr, isPointerParam := (*_typeExpr).(*ast.StarExpr); isPointerParam {
-		_type := &starExpr.X
-		return getCodeToConvertInParameter(_type, packName, name, true, outFile)
-	} else if identExpr, isIdent := (*_typeExpr).(*ast.Ident); isIdent {
-		typeName := identExpr.Name
-		if IsBasicGoType(typeName) {
-			return jenCodeToArray(leftPart.Id(argName(name)))
-		} else if isInHandleTypesList(typeName) {
-			return getLookupHandleCode(name, typeName, isPointer)
-		} else if isInplaceConvertType(typeName) {
-			if !isPointer {
-				leftPart = leftPart.Op("*")
-			}
-			return jenCodeToArray(leftPart.Id("inplace" + typeName).Call(jen.Id(argName(name))))
-		} else {
-			if isInHandleTypesList(packName + packageSeparator + typeName) {
-				return getLookupHandleCode(name, packName+packageSeparator+typeName, isPointer)
-			} else {
-				if !isPointer {
-					leftPart = leftPart.Op("*")
-				}
-				leftPart = leftPart.Parens(jen.Op("*").Id(packName).Id(".").Id(typeName)).
-					Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Id(argName(name))))
-				return jenCodeToArray(leftPart)
-			}
-		}
-	} else if selectorExpr, isSelector := (*_typeExpr).(*ast.SelectorExpr); isSelector {
-		if identExpr, isIdent := (selectorExpr.X).(*ast.Ident); isIdent {
-			packName = identExpr.Name
-			typeName := selectorExpr.Sel.Name
-			if isInHandleTypesList(packName + packageSeparator + typeName) {
-				return getLookupHandleCode(name, packName+packageSeparator+typeName, isPointer)
-			}
-		}
-		if !isPointer {
-			leftPart = leftPart.Op("*")
-		}
-		typeCastCode := getTypeCastCode(jen.Op("*"), _typeExpr, packName, name, outFile)
-		return jenCodeToArray(leftPart.Parens(typeCastCode).
-			Parens(jen.Qual("unsafe", "Pointer").Parens(jen.Id(argName(name)))))
-	} else if _, isEllipsis := (*_typeExpr).(*ast.Ellipsis); isEllipsis {
-		//TODO: stdevEclipse Implement
-		return jenCodeToArray(leftPart.Id(argName(name)))
-	} else if _, isIntf := (*_typeExpr).(*ast.InterfaceType); isIntf {
-		return jenCodeToArray(leftPart.Id("convertToInterface").Call(jen.Id(argName(name))))
-	} else if _, isFunc := (*_typeExpr).(*ast.FuncType); isFunc {
-		return jenCodeToArray(leftPart.Id("copyToFunc").Call(jen.Id(argName(name))))
-	}
-	return nil
-}
-
-/*Returns jen Code to convert an output parameter from original to wrapper function*/
-func getCodeToConvertOutParameter(_typeExpr *ast.Expr, packageName string, name string, isPointer bool) jen.Code {
-
-	if _, isArray := (*_typeExpr).(*ast.ArrayType); isArray {
-		return jen.Id("copyToGoSlice").Call(jen.Qual("reflect", "ValueOf").Call(jen.Id(argName(name))),
-			jen.Id(name))
-	} else if starExpr, isPointerRecv := (*_typeExpr).(*ast.StarExpr); isPointerRecv {
-		_type := &starExpr.X
-		return getCodeToConvertOutParameter(_type, packageName, name, true)
-	} else if identExpr, isIdent := (*_typeExpr).(*ast.Ident); isIdent {
-		typeName := identExpr.Name
-		if isLibArrayType(typeName, packageName) {
-			return jen.Id("copyTo"+getSliceName(typeName)).Call(jen.Qual("reflect", "ValueOf").Call(jen.Id(argName(name))),
-				jen.Id(name))
-		}
-		if dealOutStringAsGostring && typeName == "string" {
-			return jen.Id("copyString").Call(jen.Id(argName(name)), jen.Id(name))
-		} else if IsBasicGoType(typeName) {
-			return jen.Op("*").Id(name).Op("=").Id(argName(name))
-		} else if isInHandleTypesList(packageName + packageSeparator + typeName) {
-			var argCode jen.Code
-			if isPointer {
-				argCode = jen.Id(argName(name))
-			} else {
-				argCode = jen.Op("&").Id(argName(name))
-			}
-			return jen.Op("*").Id(name).Op("=").Id("register" + handleTypes[packageName+packageSeparator+typeName] + "Handle").Call(argCode)
-		} else if isLibArrayType(typeName, packageName) {
-			var argCode jen.Code
-			if isPointer {
-				argCode = jen.Parens(jen.Op("*").Id(argName(name))).Op("[:]")
-			} else {
-				argCode = jen.Id(argName(name)).Op("[:]")
-			}
-
-			return jen.Id("copyToBuffer").Call(jen.Qual("reflect", "ValueOf").Call(argCode),
-				jen.Qual("unsafe", "Pointer").Call(jen.Id(name)),
-				jen.Id("uint").Parens(jen.Id("Sizeof"+typeName)))
-
-		} else {
-			var argCode jen.Code
-			if isPointer {
-				argCode = jen.Id(argName(name))
-			} else {
-				argCode = jen.Op("&").Id(argName(name))
-			}
-			return jen.Op("*").Id(name).Op("=").Op("*").Parens(jen.Op("*").
-				Qual("C", packageName+packageSeparator+typeName)).
-				Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
-		}
-	} else if selectorExpr, isSelector := (*_typeExpr).(*ast.SelectorExpr); isSelector {
-		identExpr, isIdent := (selectorExpr.X).(*ast.Ident)
-		if isIdent {
-			selName := identExpr.Name
-			typeName := selectorExpr.Sel.Name
-			var argCode jen.Code
-			if isPointer {
-				argCode = jen.Id(argName(name))
-			} else {
-				argCode = jen.Op("&").Id(argName(name))
-			}
-			if isInHandleTypesList(selName + packageSeparator + typeName) {
-				return jen.Op("*").Id(name).Op("=").
-					Id("register" + handleTypes[selName+packageSeparator+typeName] + "Handle").
-					Call(argCode)
-			}
-			if isInCustomTypesList(selName + packageSeparator + typeName) {
-				return jen.Op("*").Id(name).Op("=").Op("*").Parens(jen.Op("*").
-					Qual("C", selName+packageSeparator+typeName)).
-					Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
-			} else {
-				return jen.Op("*").Id(name).Op("=").Op("*").Parens(jen.Op("*").
-					Qual("C", selName+packageSeparator+typeName)).
-					Parens(jen.Qual("unsafe", "Pointer").Parens(argCode))
-			}
-		}
-	} else if mapExpr, isMap := (*_typeExpr).(*ast.MapType); isMap {
-		identKeyExpr, isKeyIdent := (mapExpr.Key).(*ast.Ident)
-		identValueExpr, isValueIdent := (mapExpr.Value).(*ast.Ident)
-		if isKeyIdent && isValueIdent {
-			if identKeyExpr.Name == "string" && identValueExpr.Name == "string" {
-				return jen.Id("copyToStringMap").Call(jen.Id(argName(name)), jen.Id(name))
-			}
-		}
-	}
-	return nil
-}
-
-func isLibArrayType(name, packageName string) bool {
-	return arrayTypes[name] == packageName
-}
-
-func isInplaceConvertType(typeName string) bool {
-	if _, ok := inplaceConvertTypesPackages[typeName]; ok {
-		return true
-	}
-	return false
-
-}
-
-/* Process a type expression. Returns the code in C for the type and ok if successful */
-func processTypeExpression(fast *ast.File, type_expr ast.Expr,
-	packageName string, name string,
-	definedTypes *[]string,
-	forwardsDeclarations *[]string, depth int,
-	dependantTypes *[]string) (string, bool, bool) {
-	cCode := ""
-	result := false
-	dependant := false
-	if typeStruct, isTypeStruct := (type_expr).(*ast.StructType); isTypeStruct {
-		cCode += "struct{\n"
-		err := false
-		for _, field := range typeStruct.Fields.List {
-			var names []string
-			for _, fieldName := range field.Names {
-				names = append(names, fieldName.Name)
-			}
-			if len(names) == 0 {
-				names = append(names, "_unnamed")
-			}
-			for _, fieldName := range names {
-				for i := 0; i < depth*4; i++ {
-					cCode += " "
-				}
-				typeCode, result, isFieldDependant := processTypeExpression(fast, field.Type, packageName, fieldName,
-					definedTypes, forwardsDeclarations, depth+1, dependantTypes)
-				if result {
-					if isFieldDependant {
-						dependant = true
-					}
-					cCode += typeCode
-				} else {
-					err = true
-				}
-				cCode += ";\n"
-			}
-
-		}
-		for i := 0; i < (depth-1)*4; i++ {
-			cCode += " "
-		}
-		cCode += "} "
-		typeName := name
-		if depth == 1 {
-			typeName = packageName + packageSeparator + typeName
-		}
-		cCode += typeName
-		if dependant && depth == 1 {
-			addDependant(dependantTypes, typeName)
-		}
-		result = !err
-	} else if arrayExpr, isArray := (type_expr).(*ast.ArrayType); isArray {
-		var arrayCode string
-		var arrayElCode string
-		result = false
-		newName := name
-		if depth == 1 {
-			newName = packageName + packageSeparator + name
-		}
-		if arrayExpr.Len == nil {
-			arrayCode = newName
-			arrayElCode = "GoSlice_ "
-			result = true
-		} else if litExpr, isLit := (arrayExpr.Len).(*ast.BasicLit); isLit {
-			arrayElCode, result, dependant = processTypeExpression(fast, arrayExpr.Elt, packageName, "",
-				definedTypes, forwardsDeclarations, depth+1, dependantTypes)
-			if result {
-				arrayCode = newName + "[" + litExpr.Value + "]"
-			}
-		}
-		if result {
-			if dependant && depth == 1 {
-				addDependant(dependantTypes, newName)
-			}
-			cCode += arrayElCode + " " + arrayCode
-		}
-	} else if _, isFunc := (type_expr).(*ast.FuncType); isFunc {
-		newName := name
-		if depth == 1 {
-			newName = packageName + packageSeparator + name
-		}
-		cCode += "Handle " + newName
-		result = true
-		dependant = true
-	} else if _, isIntf := (type_expr).(*ast.InterfaceType); isIntf {
-		newName := name
-		if depth == 1 {
-			newName = packageName + packageSeparator + name
-		}
-		cCode += "GoInterface_ " + newName
-		result = true
-		dependant = true
-	} else if _, isChan := (type_expr).(*ast.ChanType); isChan {
-		newName := name
-		if depth == 1 {
-			newName = packageName + packageSeparator + name
-		}
-		cCode += "GoChan_ " + newName
-		result = true
-		dependant = true
-	} else if _, isMap := (type_expr).(*ast.MapType); isMap {
-		newName := name
-		if depth == 1 {
-			newName = packageName + packageSeparator + name
-		}
-		cCode += "GoMap_ " + newName
-		result = true
-		dependant = true
-	} else if starExpr, isStart := (type_expr).(*ast.StarExpr); isStart {
-		targetTypeExpr := starExpr.X
-		typeCode, ok, isFieldDependant := processTypeExpression(fast, targetTypeExpr, packageName, "",
-			definedTypes, forwardsDeclarations, depth+1, dependantTypes)
-		if ok {
-			if isFieldDependant {
-				dependant = true
-			}
-			cCode += typeCode
-			newName := name
-			if depth == 1 {
-				newName = packageName + packageSeparator + name
-			}
-			cCode += "* " + newName
-			if dependant && depth == 1 {
-				addDependant(dependantTypes, newName)
-			}
-			result = true
-		}
-	} else if identExpr, isIdent := (type_expr).(*ast.Ident); isIdent {
-		typeCode, isBasic := GetCTypeFromGoType(identExpr.Name)
-		if !isBasic {
-			addDependency := false
-			if packageName != fast.Name.Name && !isLibName(packageName) {
-				if cfg.DependOnlyExternal {
-					if isExternalName(packageName) {
-						addDependency = true
-					}
-				} else {
-					addDependency = true
-				}
-			}
-			typeCode = packageName + packageSeparator + typeCode
-			if addDependency {
-				addDependant(dependantTypes, typeCode)
-				dependant = true
-			}
-		}
-		cCode = typeCode
-		cCode += " "
-		newName := name
-		if depth == 1 {
-			newName = packageName + packageSeparator + name
-		}
-		cCode += newName
-		if !dependant {
-			if isDependantType(dependantTypes, typeCode) {
-				dependant = true
-			}
-		}
-		typeFound := false
-		for _, definedTypeIndex := range *definedTypes {
-			if definedTypeIndex == typeCode {
-				typeFound = true
-			}
-		}
-		if dependant && depth == 1 {
-			addDependant(dependantTypes, newName)
-		}
-		if !typeFound {
-			if forwardsDeclarations != nil {
-				*forwardsDeclarations = append(*forwardsDeclarations, identExpr.Name)
-				result = true
-			} else {
-				result = false
-			}
-		} else {
-			result = true
-		}
-	} else if selectorExpr, isSelector := (type_expr).(*ast.SelectorExpr); isSelector {
-		externPackage := packageName
-		identExpr, isIdent := (selectorExpr.X).(*ast.Ident)
-		if isIdent {
-			externPackage = identExpr.Name
-		}
-		newName := name
-		if depth == 1 {
-			newName = packageName + packageSeparator + name
-		}
-		typeCode, ok, isFieldDependant := processTypeExpression(fast, selectorExpr.Sel, externPackage, newName,
-			definedTypes, forwardsDeclarations, depth+1, dependantTypes)
-		if isFieldDependant {
-			dependant = true
-		}
-		if dependant && depth == 1 {
-			addDependant(dependantTypes, newName)
-		}
-		if ok {
-			cCode = typeCode
-			result = true
-		}
-	}
-	return cCode, result, dependant
-}
-
-func isDependantType(dependantTypes *[]string, typeName string) bool {
-	for _, t := range *dependantTypes {
-		if t == typeName {
-			return true
-		}
-	}
-	return false
-}
-
-func addDependant(dependantTypes *[]string, typeName string) {
-	for _, t := range *dependantTypes {
-		if t == typeName {
-			return
-		}
-	}
-	*dependantTypes = append(*dependantTypes, typeName)
-}
-
-/* Process a type definition in GO and returns the c code for the definition */
-func processTypeDef(fast *ast.File, tdecl *ast.GenDecl,
-	definedTypes *[]string, forwardsDeclarations *[]string,
-	dependantTypes *[]string) (string, bool, bool) {
-	resultCode := ""
-	result := true
-	isDependant := false
-	for _, s := range tdecl.Specs {
-		if typeSpec, isTypeSpec := (s).(*ast.TypeSpec); isTypeSpec {
-			typeCCode, ok, isDependantExpr := processTypeExpression(fast, typeSpec.Type,
-				fast.Name.Name, typeSpec.Name.Name, definedTypes, forwardsDeclarations, 1,
-				dependantTypes)
-			if ok {
-				if isDependantExpr {
-					isDependant = true
-				}
-				resultCode += "typedef "
-				resultCode += typeCCode
-				resultCode += ";\n"
-				*definedTypes = append(*definedTypes, fast.Name.Name+packageSeparator+typeSpec.Name.Name)
-			} else {
-				result = false
-			}
-		}
-	}
-	return resultCode, result, isDependant
-}
-
-/* Process all type definitions. Returns c code for all the defintions */
-func processTypeDefs(fast *ast.File, typeDecls []*ast.GenDecl, dependantTypes *[]string) string {
-	resultCode := ""
-	var definedTypes []string
-	for key := range GetBasicTypes() {
-		ctype, ok := GetCTypeFromGoType(key)
-		if ok {
-			definedTypes = append(definedTypes, ctype)
-		}
-	}
-
-	unprocessed := len(typeDecls)
-	wentBlank := false
-	for unprocessed > 0 && !wentBlank {
-		wentBlank = true
-		for index, typeDecl := range typeDecls {
-			if typeDecl != nil {
-				typeCode, ok, isDependant := processTypeDef(fast, typeDecl, &definedTypes, nil, dependantTypes)
-				if ok {
-					wentBlank = false
-					typeDecls[index] = nil
-					if !(cfg.IgnoreDependants && isDependant) {
-						resultCode += typeCode
-					}
-					unprocessed -= 1
-				}
-			}
-		}
-	}
-
-	//TODO: if unprocessed > 0 then there are cyclic type references. Use forward declarations.
-	var forwardsDeclarations []string
-	if unprocessed > 0 {
-		for _, typeDecl := range typeDecls {
-			if typeDecl != nil {
-				typeCode, ok, isDependant := processTypeDef(fast, typeDecl, &definedTypes, &forwardsDeclarations, dependantTypes)
-				if ok {
-					if !(cfg.IgnoreDependants && isDependant) {
-						resultCode += typeCode
-					}
-				}
-			}
+	opts.DiffOutput = os.Stdout
+	g, err := cgogen.New(opts.Config)
+	if err != nil {
+		if _, isDiagnostics := err.(cgogen.Diagnostics); !isDiagnostics {
+			err = fmt.Errorf("error: %v", err)
 		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
-	return resultCode
-}
-
-//Remove extra space in export indication
-func fixExportComment(filePath string) {
-	f, err := os.Open(filePath)
-	check(err)
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(f)
-	check(err)
-
-	contents := buf.String()
-	err = f.Close()
-	check(err)
-
-	contents = strings.Replace(contents, "// export "+functionPrefix+"_", "//export "+functionPrefix+"_", -1)
-	f, err = os.Create(filePath)
-	check(err)
-	_, err = f.WriteString(contents)
-	check(err)
-	err = f.Sync()
-	check(err)
-	err = f.Close()
-	check(err)
-}
-
-func processTypeSetting(comment string) {
-	handlePrefix := "CGOGEN HANDLES "
-	typeConversionPrefix := "CGOGEN TYPES_CONVERSION "
-	typeSliceCustomPrefix := "CGOGEN SLICE "
-	inplacePrefix := "CGOGEN INPLACE "
-	if strings.HasPrefix(comment, handlePrefix) {
-		handlesPart := comment[len(handlePrefix):]
-		handles := strings.Split(handlesPart, ",")
-		for _, handle := range handles {
-			handleParts := strings.Split(handle, "|")
-			if len(handleParts) > 1 {
-				handleTypes[handleParts[0]] = handleParts[1]
-			} else if len(handleParts) > 0 {
-				handleTypes[handleParts[0]] = handleParts[0]
-			}
-		}
-	} else if strings.HasPrefix(comment, typeConversionPrefix) {
-		typesPart := comment[len(typeConversionPrefix):]
-		types := strings.Split(typesPart, ",")
-		for _, t := range types {
-			typesPart := strings.Split(t, "|")
-			if len(typesPart) > 1 {
-				customTypesMap[typesPart[0]] = typesPart[1]
-			} else if len(typesPart) > 0 {
-				customTypesMap[typesPart[0]] = typesPart[0]
-			}
-		}
-	} else if strings.HasPrefix(comment, inplacePrefix) {
-		typesPart := comment[len(inplacePrefix):]
-		types := strings.Split(typesPart, ",")
-		for _, t := range types {
-			typesPart := strings.Split(t, "|")
-			if len(typesPart) > 1 {
-				inplaceConvertTypesPackages[typesPart[0]] = typesPart[1]
-			} else if len(typesPart) > 0 {
-				inplaceConvertTypesPackages[typesPart[0]] = typesPart[0]
-			}
-		}
-	} else if strings.HasPrefix(comment, typeSliceCustomPrefix) {
-		typesPart := comment[len(typeSliceCustomPrefix):]
-		types := strings.Split(typesPart, ",")
-		for _, t := range types {
-			typesPart := strings.Split(t, "|")
-			if len(typesPart) > 1 {
-				arrayTypes[typesPart[0]] = typesPart[1]
-			} else if len(typesPart) > 0 {
-				arrayTypes[typesPart[0]] = typesPart[0]
-			}
+	if opts.Path != "" {
+		sources = []cgogen.Source{{Path: opts.Path, OutputFileGO: opts.OutputFileGO, OutputFileCH: opts.OutputFileCH}}
+	} else if opts.BatchFile != "" {
+		if sources, err = cgogen.LoadBatchFile(opts.BatchFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
 		}
 	}
-}
-
-func IsBasicGoType(goType string) bool {
-	if _, ok := basicTypesMap[goType]; ok {
-		return true
-	} else {
-		return false
+	if len(sources) == 0 && !opts.FullTranspile && (opts.ProcessFunctions || opts.ProcessTypes) {
+		fmt.Fprintln(os.Stderr, "error: missing source file, set -i or -batch, or run with go generate")
+		return 1
 	}
-}
-
-/* Returns the corresponding C type for a GO type*/
-func GetCTypeFromGoType(goType string) (string, bool) {
-	if val, ok := basicTypesMap[goType]; ok {
-		return val, true
-	} else {
-		return goType, false
+	err = g.Run(sources)
+	for _, d := range g.Diagnostics() {
+		fmt.Fprintln(os.Stderr, d)
 	}
-}
-
-func GetBasicTypes() map[string]string {
-	return basicTypesMap
-}
-
-var basicTypesMap = map[string]string{
-	"int":        "GoInt_",
-	"uint":       "GoUint_",
-	"int8":       "GoInt8_",
-	"int16":      "GoInt16_",
-	"int32":      "GoInt32_",
-	"int64":      "GoInt64_",
-	"byte":       "GoUint8_",
-	"uint8":      "GoUint8_",
-	"uint16":     "GoUint16_",
-	"uint32":     "GoUint32_",
-	"uint64":     "GoUint64_",
-	"float32":    "GoFloat32_",
-	"float64":    "GoFloat64_",
-	"complex64":  "GoComplex64_",
-	"complex128": "GoComplex128_",
-	"string":     "GoString_",
-	"bool":       "bool",
-	"error":      "GoInt32_",
-}
-
-var packageSeparator = "__"
-
-func getPathPackage(path string) (packagePath_ string, mainPackagePath_ string) {
-
-	index := strings.LastIndex(path, "/")
-	if index == -1 {
-		mainPackagePath_ = path
-	} else {
-		mainPackagePath_ = string(path[:index])
+	if err != nil {
+		return 1
 	}
-	index = strings.LastIndex(mainPackagePath_, "/")
-	packagePath_ = string(mainPackagePath_[:index+1])
-	mainPackagePath_ = mainPackagePath_ + "/src/"
-
-	return
+	return 0
 }